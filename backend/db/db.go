@@ -9,7 +9,10 @@ import (
 )
 
 func InitDB() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+	// Timestamps are kept in UTC regardless of the server's zone; per-user
+	// zones are applied in the services. The session zone is UTC too, so
+	// MySQL converts TIMESTAMP columns and CURRENT_TIMESTAMP to match.
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC&time_zone=%%27%%2B00%%3A00%%27",
 		os.Getenv("DB_USER"),
 		os.Getenv("DB_PASSWORD"),
 		os.Getenv("DB_HOST"),
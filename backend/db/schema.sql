@@ -9,6 +9,7 @@ CREATE TABLE IF NOT EXISTS users (
     password_hash VARCHAR(255) NOT NULL,
     first_name VARCHAR(100),
     last_name VARCHAR(100),
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL,
@@ -19,13 +20,18 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE TABLE IF NOT EXISTS categories (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT UNSIGNED NOT NULL,
+    parent_id BIGINT UNSIGNED NULL,
     name VARCHAR(100) NOT NULL,
     color VARCHAR(7) DEFAULT '#000000',
+    position INT NOT NULL DEFAULT 0,
+    archived_at TIMESTAMP NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    INDEX idx_category_name (name)
+    FOREIGN KEY (parent_id) REFERENCES categories(id) ON DELETE SET NULL,
+    UNIQUE KEY idx_category_user_name (user_id, name),
+    INDEX idx_category_parent (user_id, parent_id, position)
 );
 
 -- Journal entries table
@@ -36,25 +42,49 @@ CREATE TABLE IF NOT EXISTS journal_entries (
     title VARCHAR(255) NOT NULL,
     content TEXT NOT NULL,
     mood VARCHAR(50),
+    mood_intensity TINYINT UNSIGNED NULL,
+    sentiment DOUBLE NULL,
     word_count INT UNSIGNED,
+    character_count INT UNSIGNED NOT NULL DEFAULT 0,
+    sentence_count INT UNSIGNED NOT NULL DEFAULT 0,
+    reading_seconds INT UNSIGNED NOT NULL DEFAULT 0,
+    readability DOUBLE NULL,
+    analyzed_at TIMESTAMP NULL,
+    version INT UNSIGNED NOT NULL DEFAULT 1,
+    is_draft BOOLEAN NOT NULL DEFAULT FALSE,
+    autosaved_at TIMESTAMP NULL,
+    entry_date DATE NOT NULL,
+    entry_time TIME NULL,
+    entry_timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    latitude DOUBLE NULL,
+    longitude DOUBLE NULL,
+    place_name VARCHAR(255) NOT NULL DEFAULT '',
+    location_accuracy DOUBLE NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
     FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL,
-    INDEX idx_user_created (user_id, created_at)
+    INDEX idx_user_created (user_id, created_at),
+    INDEX idx_entry_draft (user_id, is_draft),
+    INDEX idx_entry_analyzed (analyzed_at),
+    INDEX idx_entry_date (user_id, entry_date),
+    INDEX idx_entry_location (user_id, latitude, longitude)
 );
 
 -- Tags table
 CREATE TABLE IF NOT EXISTS tags (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     user_id BIGINT UNSIGNED NOT NULL,
+    parent_id BIGINT UNSIGNED NULL,
     name VARCHAR(100) NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    UNIQUE KEY unique_tag_per_user (user_id, name)
+    FOREIGN KEY (parent_id) REFERENCES tags(id),
+    UNIQUE KEY unique_tag_per_user (user_id, name),
+    INDEX idx_tag_parent (parent_id)
 );
 
 -- Journal entry tags (many-to-many relationship)
@@ -69,6 +99,93 @@ CREATE TABLE IF NOT EXISTS journal_entry_tags (
     FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
 );
 
+-- Read-only access to entries granted to other users
+CREATE TABLE IF NOT EXISTS entry_shares (
+    entry_id BIGINT UNSIGNED NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (entry_id, user_id),
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_entry_share_user (user_id)
+);
+
+-- Shares with emails that have no account yet, turned into entry_shares when
+-- someone registers with the email
+CREATE TABLE IF NOT EXISTS entry_invites (
+    entry_id BIGINT UNSIGNED NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (entry_id, email),
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id) ON DELETE CASCADE,
+    INDEX idx_entry_invite_email (email)
+);
+
+-- Writing goals
+CREATE TABLE IF NOT EXISTS goals (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    metric VARCHAR(20) NOT NULL,
+    period VARCHAR(20) NOT NULL,
+    target INT UNSIGNED NOT NULL,
+    weekdays VARCHAR(27),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_goal_user (user_id)
+);
+
+-- Per-user mood vocabulary; entries store the mood name
+CREATE TABLE IF NOT EXISTS moods (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    emoji VARCHAR(16),
+    color VARCHAR(7) NOT NULL,
+    valence INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY idx_mood_user_name (user_id, name)
+);
+
+-- Files attached to entries; the files themselves live in the blob store
+CREATE TABLE IF NOT EXISTS attachments (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    entry_id BIGINT UNSIGNED NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP NULL,
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY idx_attachment_storage_key (storage_key),
+    INDEX idx_attachment_entry (entry_id),
+    INDEX idx_attachment_user (user_id)
+);
+
+-- Published entry and word counts per user, day, category and mood, kept in
+-- step with journal_entries for fast stats. category_id 0 is uncategorized.
+CREATE TABLE IF NOT EXISTS daily_entry_stats (
+    user_id BIGINT UNSIGNED NOT NULL,
+    entry_date DATE NOT NULL,
+    category_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    mood VARCHAR(100) NOT NULL DEFAULT '',
+    entries BIGINT NOT NULL DEFAULT 0,
+    words BIGINT NOT NULL DEFAULT 0,
+    sentiment_sum DOUBLE NOT NULL DEFAULT 0,
+    sentiment_entries BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, entry_date, category_id, mood),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 -- User preferences table
 CREATE TABLE IF NOT EXISTS user_preferences (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
@@ -77,6 +194,8 @@ CREATE TABLE IF NOT EXISTS user_preferences (
     default_view VARCHAR(20) DEFAULT 'list',
     date_format VARCHAR(20) DEFAULT 'MM/DD/YYYY',
     email_notifications BOOLEAN DEFAULT FALSE,
+    timezone VARCHAR(64) DEFAULT 'UTC',
+    hide_location BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP NULL,
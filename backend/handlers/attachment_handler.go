@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"journal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// uploadOverhead leaves room in an upload request for the multipart framing
+// around the file
+const uploadOverhead = 64 << 10
+
+type AttachmentHandler struct {
+	attachmentService *services.AttachmentService
+}
+
+func NewAttachmentHandler(attachmentService *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentService: attachmentService,
+	}
+}
+
+// UploadAttachment attaches the file in the "file" field of a multipart form
+// to an entry
+func (h *AttachmentHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxAttachmentSize+uploadOverhead)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Attachments can be at most 10 MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Request must be a multipart form with a file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.attachmentService.UploadAttachment(uint(entryID), actor, header.Filename, file, header.Size)
+	if err != nil {
+		writeError(w, err, "Failed to upload attachment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// ListAttachments lists the files attached to an entry
+func (h *AttachmentHandler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	attachments, err := h.attachmentService.ListAttachments(uint(entryID), actor)
+	if err != nil {
+		writeError(w, err, "Failed to retrieve attachments")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// DownloadAttachment sends an attachment's file. Images, audio and video are
+// shown inline; anything else is downloaded. The file is sandboxed so it can
+// never run script in the app's origin.
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	entryID, attachmentID, ok := parseAttachmentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	attachment, content, err := h.attachmentService.OpenAttachment(entryID, attachmentID, actor)
+	if err != nil {
+		writeError(w, err, "Failed to retrieve attachment")
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	for _, inline := range []string{"image/", "audio/", "video/"} {
+		if strings.HasPrefix(attachment.ContentType, inline) {
+			disposition = "inline"
+		}
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("Failed to send attachment %d: %v", attachment.ID, err)
+	}
+}
+
+// DeleteAttachment removes a file from an entry
+func (h *AttachmentHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	entryID, attachmentID, ok := parseAttachmentIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.attachmentService.DeleteAttachment(entryID, attachmentID, actor); err != nil {
+		writeError(w, err, "Failed to delete attachment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAttachmentUsage reports how much of their attachment quota the current
+// user has used
+func (h *AttachmentHandler) GetAttachmentUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+
+	usage, err := h.attachmentService.GetAttachmentUsage(userID)
+	if err != nil {
+		writeError(w, err, "Failed to retrieve attachment usage")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
+
+// parseAttachmentIDs reads the entry and attachment IDs from the URL,
+// responding with 400 when either is invalid
+func parseAttachmentIDs(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	attachmentID, err := strconv.ParseUint(vars["attachmentId"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return uint(entryID), uint(attachmentID), true
+}
@@ -11,6 +11,15 @@ import (
 	"github.com/gorilla/mux"
 )
 
+type ReorderCategoriesRequest struct {
+	ParentID   *uint  `json:"parentId"`
+	OrderedIDs []uint `json:"orderedIds"`
+}
+
+type MergeCategoryRequest struct {
+	TargetID uint `json:"targetId"`
+}
+
 type CategoryHandler struct {
 	categoryService *services.CategoryService
 }
@@ -31,8 +40,11 @@ func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request)
 	// Get current userID from context
 	userID := r.Context().Value("userID").(uint)
 
+	// Archived categories are hidden from pickers unless asked for
+	includeArchived := r.URL.Query().Get("includeArchived") == "true"
+
 	// Get categories from service
-	categories, err := h.categoryService.GetCategories(userID)
+	categories, err := h.categoryService.GetCategories(userID, includeArchived)
 	if err != nil {
 		http.Error(w, "Failed to retrieve categories", http.StatusInternalServerError)
 		return
@@ -49,8 +61,8 @@ func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get current userID from context
-	userID := r.Context().Value("userID").(uint)
+	// Get the current actor from context
+	actor := currentActor(r)
 
 	// Parse category ID from URL
 	vars := mux.Vars(r)
@@ -61,9 +73,9 @@ func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get category from service
-	category, err := h.categoryService.GetCategory(uint(categoryID), userID)
+	category, err := h.categoryService.GetCategory(uint(categoryID), actor)
 	if err != nil {
-		http.Error(w, "Category not found", http.StatusNotFound)
+		writeError(w, err, "Failed to retrieve category")
 		return
 	}
 
@@ -71,6 +83,37 @@ func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(category)
 }
 
+// GetCategoryStats summarizes the entries in a category; pass
+// ?includeSubcategories=true to include its subcategories
+func (h *CategoryHandler) GetCategoryStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse category ID from URL
+	vars := mux.Vars(r)
+	categoryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	includeSubcategories := r.URL.Query().Get("includeSubcategories") == "true"
+
+	stats, err := h.categoryService.GetCategoryStats(uint(categoryID), actor, includeSubcategories)
+	if err != nil {
+		writeError(w, err, "Failed to get category stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
 // CreateCategory creates a new category for the current user
 func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -102,7 +145,7 @@ func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request)
 	// Create category using service
 	createdCategory, err := h.categoryService.CreateCategory(userID, categoryDTO)
 	if err != nil {
-		http.Error(w, "Failed to create category", http.StatusInternalServerError)
+		writeError(w, err, "Failed to create category")
 		return
 	}
 
@@ -119,8 +162,8 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get current userID from context
-	userID := r.Context().Value("userID").(uint)
+	// Get the current actor from context
+	actor := currentActor(r)
 
 	// Parse category ID from URL
 	vars := mux.Vars(r)
@@ -144,13 +187,9 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Update category using service
-	updatedCategory, err := h.categoryService.UpdateCategory(uint(categoryID), userID, categoryDTO)
+	updatedCategory, err := h.categoryService.UpdateCategory(uint(categoryID), actor, categoryDTO)
 	if err != nil {
-		if err.Error() == "category not found" {
-			http.Error(w, "Category not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Failed to update category", http.StatusInternalServerError)
-		}
+		writeError(w, err, "Failed to update category")
 		return
 	}
 
@@ -159,6 +198,104 @@ func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(updatedCategory)
 }
 
+// ReorderCategories sets the display order of the categories under one parent
+func (h *CategoryHandler) ReorderCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	// Decode request body
+	var req ReorderCategoriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	categories, err := h.categoryService.ReorderCategories(userID, req.ParentID, req.OrderedIDs)
+	if err != nil {
+		writeError(w, err, "Failed to reorder categories")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// ArchiveCategory hides a category from pickers without touching its entries
+func (h *CategoryHandler) ArchiveCategory(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// UnarchiveCategory restores an archived category
+func (h *CategoryHandler) UnarchiveCategory(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+func (h *CategoryHandler) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse category ID from URL
+	vars := mux.Vars(r)
+	categoryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryService.SetCategoryArchived(uint(categoryID), actor, archived)
+	if err != nil {
+		writeError(w, err, "Failed to update category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// MergeCategory moves all entries of a category into another and deletes it
+func (h *CategoryHandler) MergeCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse category ID from URL
+	vars := mux.Vars(r)
+	categoryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var req MergeCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TargetID == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryService.MergeCategory(uint(categoryID), req.TargetID, actor)
+	if err != nil {
+		writeError(w, err, "Failed to merge categories")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
 // DeleteCategory deletes a category
 func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -166,8 +303,8 @@ func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get current userID from context
-	userID := r.Context().Value("userID").(uint)
+	// Get the current actor from context
+	actor := currentActor(r)
 
 	// Parse category ID from URL
 	vars := mux.Vars(r)
@@ -178,12 +315,8 @@ func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Delete category using service
-	if err := h.categoryService.DeleteCategory(uint(categoryID), userID); err != nil {
-		if err.Error() == "category not found" {
-			http.Error(w, "Category not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Failed to delete category", http.StatusInternalServerError)
-		}
+	if err := h.categoryService.DeleteCategory(uint(categoryID), actor); err != nil {
+		writeError(w, err, "Failed to delete category")
 		return
 	}
 
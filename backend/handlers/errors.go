@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"journal/policy"
+	"journal/services"
+)
+
+// serviceErrors maps the sentinel errors returned by services to the status
+// and message every handler responds with
+var serviceErrors = []struct {
+	err     error
+	status  int
+	message string
+}{
+	{services.ErrInvalidEntryDate, http.StatusBadRequest, "Invalid entry date, time or timezone"},
+	{services.ErrEntryNotDraft, http.StatusConflict, "Only drafts can be autosaved"},
+	{services.ErrInvalidShareEmail, http.StatusBadRequest, "Invalid email address"},
+	{services.ErrShareWithOwner, http.StatusBadRequest, "An entry cannot be shared with its owner"},
+	{services.ErrInvalidInterval, http.StatusBadRequest, "Interval must be day, week or month"},
+	{services.ErrInvalidYear, http.StatusBadRequest, "Invalid year"},
+	{services.ErrInvalidStatsRange, http.StatusBadRequest, "Invalid date range: from must not be after to or span more than 1000 buckets"},
+	{services.ErrInvalidLocation, http.StatusBadRequest, "Location needs both latitude (-90 to 90) and longitude (-180 to 180), an accuracy only with coordinates, and a place name of at most 255 characters"},
+	{services.ErrInvalidBounds, http.StatusBadRequest, "Latitudes must be between -90 and 90 with south not above north, longitudes between -180 and 180, and radius positive and at most 20015 km"},
+	{services.ErrInvalidZoom, http.StatusBadRequest, "Zoom must be between 0 and 22"},
+
+	{services.ErrInvalidTagName, http.StatusBadRequest, "Invalid tag name"},
+	{services.ErrTagNameTaken, http.StatusConflict, "A tag with that name already exists"},
+	{services.ErrTagInUse, http.StatusConflict, "Tag is still used by entries"},
+	{services.ErrTagHasChildren, http.StatusConflict, "Tag has child tags"},
+
+	{services.ErrParentCategoryNotFound, http.StatusBadRequest, "Parent category not found"},
+	{services.ErrCategoryCycle, http.StatusConflict, "A category cannot be nested under or merged into itself or its subcategories"},
+	{services.ErrCategoryNameTaken, http.StatusConflict, "A category with that name already exists"},
+	{services.ErrCategoryArchived, http.StatusConflict, "Archived categories cannot be given to entries"},
+	{services.ErrInvalidCategoryName, http.StatusBadRequest, "Category name is required"},
+	{services.ErrInvalidCategoryColor, http.StatusBadRequest, "Color must be a hex value like #1A2B3C or a color name"},
+	{services.ErrInvalidCategoryOrder, http.StatusBadRequest, "orderedIds must list every category under the parent exactly once"},
+
+	{services.ErrInvalidGoalMetric, http.StatusBadRequest, "Goal metric must be words, entries or days"},
+	{services.ErrInvalidGoalPeriod, http.StatusBadRequest, "Goal period must be day, week or month"},
+	{services.ErrInvalidGoalTarget, http.StatusBadRequest, "Goal target must be a positive number that fits the period"},
+	{services.ErrInvalidGoalWeekdays, http.StatusBadRequest, "Weekdays must be day abbreviations like mon or fri, and only apply to daily goals"},
+
+	{services.ErrInvalidMoodName, http.StatusBadRequest, "Mood name is required and must be at most 50 characters"},
+	{services.ErrMoodNameTaken, http.StatusConflict, "A mood with that name already exists"},
+	{services.ErrInvalidMoodEmoji, http.StatusBadRequest, "Emoji must be at most 8 characters"},
+	{services.ErrInvalidMoodColor, http.StatusBadRequest, "Color must be a hex value like #1A2B3C or a color name"},
+	{services.ErrInvalidMoodValence, http.StatusBadRequest, "Valence must be between -2 and 2"},
+	{services.ErrMoodInUse, http.StatusConflict, "Mood is still used by entries"},
+	{services.ErrInvalidMoodIntensity, http.StatusBadRequest, "Mood intensity must be between 1 and 10 and needs a mood"},
+	{services.ErrUnknownMood, http.StatusBadRequest, "Mood is not one of your moods; set createMood to add it"},
+
+	{services.ErrEmptyAttachment, http.StatusBadRequest, "Attachment is empty"},
+	{services.ErrAttachmentTooLarge, http.StatusRequestEntityTooLarge, "Attachments can be at most 10 MB"},
+	{services.ErrAttachmentQuotaExceeded, http.StatusRequestEntityTooLarge, "Attachment storage quota exceeded"},
+	{services.ErrUnsupportedAttachmentType, http.StatusUnsupportedMediaType, "Attachments must be images, PDFs, plain text, audio or video"},
+
+	{services.ErrInvalidTimezone, http.StatusBadRequest, "Invalid timezone"},
+	{services.ErrIncorrectPassword, http.StatusForbidden, "Incorrect password"},
+}
+
+// writeError maps a service error to an HTTP response. Policy errors become
+// 404 or 403, version conflicts 412, known sentinel errors their fixed status,
+// and anything else a 500 with the fallback message.
+func writeError(w http.ResponseWriter, err error, fallback string) {
+	var policyErr *policy.Error
+	if errors.As(err, &policyErr) {
+		switch policyErr.Kind {
+		case policy.KindForbidden:
+			http.Error(w, "You do not have permission to change this "+policyErr.Resource, http.StatusForbidden)
+		default:
+			http.Error(w, capitalize(policyErr.Resource)+" not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	var conflict *services.VersionConflictError
+	if errors.As(err, &conflict) {
+		writeVersionConflict(w, conflict)
+		return
+	}
+
+	for _, known := range serviceErrors {
+		if errors.Is(err, known.err) {
+			http.Error(w, known.message, known.status)
+			return
+		}
+	}
+
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
+
+// currentActor builds the policy actor for the authenticated user
+func currentActor(r *http.Request) policy.Actor {
+	role, _ := r.Context().Value("role").(policy.Role)
+	return policy.Actor{
+		UserID: r.Context().Value("userID").(uint),
+		Role:   role,
+	}
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"journal/models"
+	"journal/services"
+
+	"github.com/gorilla/mux"
+)
+
+type GoalHandler struct {
+	goalService *services.GoalService
+}
+
+func NewGoalHandler(goalService *services.GoalService) *GoalHandler {
+	return &GoalHandler{
+		goalService: goalService,
+	}
+}
+
+// GetGoals retrieves all goals for the current user
+func (h *GoalHandler) GetGoals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	goals, err := h.goalService.GetGoals(userID)
+	if err != nil {
+		writeError(w, err, "Failed to retrieve goals")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goals)
+}
+
+// GetGoal retrieves a specific goal by ID
+func (h *GoalHandler) GetGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse goal ID from URL
+	vars := mux.Vars(r)
+	goalID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+
+	goal, err := h.goalService.GetGoal(uint(goalID), actor)
+	if err != nil {
+		writeError(w, err, "Failed to retrieve goal")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goal)
+}
+
+// CreateGoal creates a new goal for the current user
+func (h *GoalHandler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	var goalDTO models.GoalDTO
+	if err := json.NewDecoder(r.Body).Decode(&goalDTO); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	goal, err := h.goalService.CreateGoal(userID, goalDTO)
+	if err != nil {
+		writeError(w, err, "Failed to create goal")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(goal)
+}
+
+// UpdateGoal updates an existing goal
+func (h *GoalHandler) UpdateGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse goal ID from URL
+	vars := mux.Vars(r)
+	goalID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+
+	var goalDTO models.GoalDTO
+	if err := json.NewDecoder(r.Body).Decode(&goalDTO); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	goal, err := h.goalService.UpdateGoal(uint(goalID), actor, goalDTO)
+	if err != nil {
+		writeError(w, err, "Failed to update goal")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goal)
+}
+
+// DeleteGoal deletes a goal
+func (h *GoalHandler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse goal ID from URL
+	vars := mux.Vars(r)
+	goalID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.goalService.DeleteGoal(uint(goalID), actor); err != nil {
+		writeError(w, err, "Failed to delete goal")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAllGoalProgress reports progress for every goal of the current user
+func (h *GoalHandler) GetAllGoalProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	progress, err := h.goalService.GetAllGoalProgress(userID, parseHistory(r))
+	if err != nil {
+		writeError(w, err, "Failed to get goal progress")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+// GetGoalProgress reports the current period and recent history of one goal
+func (h *GoalHandler) GetGoalProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse goal ID from URL
+	vars := mux.Vars(r)
+	goalID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+
+	progress, err := h.goalService.GetGoalProgress(uint(goalID), actor, parseHistory(r))
+	if err != nil {
+		writeError(w, err, "Failed to get goal progress")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+// parseHistory reads how many past periods to report; -1 lets the service
+// pick its default
+func parseHistory(r *http.Request) int {
+	history, err := strconv.Atoi(r.URL.Query().Get("history"))
+	if err != nil || history < 0 {
+		return -1
+	}
+	return history
+}
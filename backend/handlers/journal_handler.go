@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"journal/models"
 	"journal/services"
@@ -11,6 +15,10 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// maxPreviewBody bounds a preview request, since previews are rendered on
+// every keystroke and never saved
+const maxPreviewBody = 64 << 10
+
 type JournalHandler struct {
 	journalService *services.JournalService
 }
@@ -22,19 +30,67 @@ func NewJournalHandler(journalService *services.JournalService) *JournalHandler
 }
 
 type CreateEntryRequest struct {
-	Title      string   `json:"title"`
-	Content    string   `json:"content"`
-	CategoryID *uint    `json:"categoryId"`
-	Mood       string   `json:"mood"`
-	Tags       []string `json:"tags"`
+	Title         string           `json:"title"`
+	Content       string           `json:"content"`
+	CategoryID    *uint            `json:"categoryId"`
+	Mood          string           `json:"mood"`
+	CreateMood    bool             `json:"createMood"`
+	MoodIntensity *uint8           `json:"moodIntensity"`
+	Tags          []string         `json:"tags"`
+	Draft         bool             `json:"draft"`
+	EntryDate     string           `json:"entryDate"`
+	EntryTime     string           `json:"entryTime"`
+	EntryTimezone string           `json:"entryTimezone"`
+	Location      *LocationRequest `json:"location"`
 }
 
 type UpdateEntryRequest struct {
-	Title      string   `json:"title"`
-	Content    string   `json:"content"`
-	CategoryID *uint    `json:"categoryId"`
-	Mood       string   `json:"mood"`
-	Tags       []string `json:"tags"`
+	Title         string   `json:"title"`
+	Content       string   `json:"content"`
+	CategoryID    *uint    `json:"categoryId"`
+	Mood          string   `json:"mood"`
+	CreateMood    bool     `json:"createMood"`
+	MoodIntensity *uint8   `json:"moodIntensity"`
+	Tags          []string `json:"tags"`
+	EntryDate     string   `json:"entryDate"`
+	EntryTime     string   `json:"entryTime"`
+	EntryTimezone string   `json:"entryTimezone"`
+	// Location is kept when omitted and cleared when null
+	Location json.RawMessage `json:"location"`
+}
+
+// LocationRequest is where an entry was written: coordinates in degrees, a
+// place name or both, and the accuracy of the coordinates in meters
+type LocationRequest struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	PlaceName string   `json:"placeName"`
+	Accuracy  *float64 `json:"accuracy"`
+}
+
+func (l *LocationRequest) input() *services.LocationInput {
+	if l == nil {
+		return nil
+	}
+	return &services.LocationInput{
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+		PlaceName: l.PlaceName,
+		Accuracy:  l.Accuracy,
+	}
+}
+
+type AutosaveRequest struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+type PreviewRequest struct {
+	Content string `json:"content"`
+}
+
+type ShareEntryRequest struct {
+	Email string `json:"email"`
 }
 
 func (h *JournalHandler) CreateEntry(w http.ResponseWriter, r *http.Request) {
@@ -51,20 +107,29 @@ func (h *JournalHandler) CreateEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entry, err := h.journalService.CreateEntry(
-		userID,
-		req.Title,
-		req.Content,
-		req.CategoryID,
-		req.Mood,
-		req.Tags,
-	)
+	entry, err := h.journalService.CreateEntry(userID, services.EntryInput{
+		Title:         req.Title,
+		Content:       req.Content,
+		CategoryID:    req.CategoryID,
+		Mood:          req.Mood,
+		CreateMood:    req.CreateMood,
+		MoodIntensity: req.MoodIntensity,
+		Tags:          req.Tags,
+		IsDraft:       req.Draft,
+		Date: services.EntryDateInput{
+			Date:     req.EntryDate,
+			Time:     req.EntryTime,
+			Timezone: req.EntryTimezone,
+		},
+		Location: req.Location.input(),
+	})
 	if err != nil {
-		http.Error(w, "Failed to create entry", http.StatusInternalServerError)
+		writeError(w, err, "Failed to create entry")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entryETag(entry))
 	json.NewEncoder(w).Encode(entry)
 }
 
@@ -74,7 +139,7 @@ func (h *JournalHandler) GetEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Context().Value("userID").(uint)
+	actor := currentActor(r)
 	vars := mux.Vars(r)
 	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
@@ -82,13 +147,26 @@ func (h *JournalHandler) GetEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entry, err := h.journalService.GetEntry(uint(entryID), userID)
+	// ?format=html adds the content rendered from Markdown
+	var entry *models.JournalEntryDTO
+	etag := entryETag
+	switch r.URL.Query().Get("format") {
+	case "", "markdown":
+		entry, err = h.journalService.GetEntry(uint(entryID), actor)
+	case "html":
+		entry, err = h.journalService.GetRenderedEntry(uint(entryID), actor)
+		etag = renderedEntryETag
+	default:
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Entry not found", http.StatusNotFound)
+		writeError(w, err, "Failed to get entry")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(entry))
 	json.NewEncoder(w).Encode(entry)
 }
 
@@ -98,7 +176,7 @@ func (h *JournalHandler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Context().Value("userID").(uint)
+	actor := currentActor(r)
 	vars := mux.Vars(r)
 	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
@@ -106,27 +184,198 @@ func (h *JournalHandler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
 	var req UpdateEntryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	entry, err := h.journalService.UpdateEntry(
-		uint(entryID),
-		userID,
-		req.Title,
-		req.Content,
-		req.CategoryID,
-		req.Mood,
-		req.Tags,
-	)
+	input := services.EntryInput{
+		Title:         req.Title,
+		Content:       req.Content,
+		CategoryID:    req.CategoryID,
+		Mood:          req.Mood,
+		CreateMood:    req.CreateMood,
+		MoodIntensity: req.MoodIntensity,
+		Tags:          req.Tags,
+		Date: services.EntryDateInput{
+			Date:     req.EntryDate,
+			Time:     req.EntryTime,
+			Timezone: req.EntryTimezone,
+		},
+	}
+	if req.Location != nil {
+		location, err := parseLocation(req.Location)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		input.SetLocation = true
+		input.Location = location
+	}
+
+	entry, err := h.journalService.UpdateEntry(uint(entryID), actor, expectedVersion, input)
+	if err != nil {
+		writeError(w, err, "Failed to update entry")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entryETag(entry))
+	json.NewEncoder(w).Encode(entry)
+}
+
+// PatchEntry applies a JSON Merge Patch (RFC 7396) to an entry so clients can
+// change individual fields without resending the whole entry
+func (h *JournalHandler) PatchEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := parseEntryPatch(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.journalService.PatchEntry(uint(entryID), actor, expectedVersion, patch)
+	if err != nil {
+		writeError(w, err, "Failed to update entry")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entryETag(entry))
+	json.NewEncoder(w).Encode(entry)
+}
+
+// AutosaveDraft accepts frequent small saves of a draft's title and content
+func (h *JournalHandler) AutosaveDraft(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	var req AutosaveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.journalService.AutosaveDraft(uint(entryID), actor, req.Title, req.Content)
+	if err != nil {
+		writeError(w, err, "Failed to autosave draft")
+		return
+	}
+
+	response := struct {
+		ID          uint       `json:"id"`
+		WordCount   uint       `json:"wordCount"`
+		AutosavedAt *time.Time `json:"autosavedAt"`
+	}{
+		ID:          entry.ID,
+		WordCount:   entry.WordCount,
+		AutosavedAt: entry.AutosavedAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PreviewContent renders Markdown to sanitized HTML the same way entries are
+// rendered, so editors can show a preview before saving
+func (h *JournalHandler) PreviewContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPreviewBody)
+	var req PreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Previews can be at most 64 KB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response := struct {
+		HTML string `json:"html"`
+	}{
+		HTML: h.journalService.PreviewContent(req.Content),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PublishEntry turns a draft into a regular entry
+func (h *JournalHandler) PublishEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		writeIfMatchError(w, err)
+		return
+	}
+
+	entry, err := h.journalService.PublishEntry(uint(entryID), actor, expectedVersion)
 	if err != nil {
-		http.Error(w, "Failed to update entry", http.StatusInternalServerError)
+		writeError(w, err, "Failed to publish entry")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entryETag(entry))
 	json.NewEncoder(w).Encode(entry)
 }
 
@@ -136,7 +385,86 @@ func (h *JournalHandler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Context().Value("userID").(uint)
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.journalService.DeleteEntry(uint(entryID), actor); err != nil {
+		writeError(w, err, "Failed to delete entry")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEntryShares lists the emails an entry is shared with
+func (h *JournalHandler) GetEntryShares(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	shares, err := h.journalService.GetEntryShares(uint(entryID), actor)
+	if err != nil {
+		writeError(w, err, "Failed to get entry shares")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// ShareEntry shares an entry read-only with an email
+func (h *JournalHandler) ShareEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ShareEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	shares, err := h.journalService.ShareEntry(uint(entryID), actor, req.Email)
+	if err != nil {
+		writeError(w, err, "Failed to share entry")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shares)
+}
+
+// UnshareEntry stops sharing an entry with an email
+func (h *JournalHandler) UnshareEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	actor := currentActor(r)
 	vars := mux.Vars(r)
 	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
@@ -144,14 +472,51 @@ func (h *JournalHandler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.journalService.DeleteEntry(uint(entryID), userID); err != nil {
-		http.Error(w, "Failed to delete entry", http.StatusInternalServerError)
+	if err := h.journalService.UnshareEntry(uint(entryID), actor, vars["email"]); err != nil {
+		writeError(w, err, "Failed to unshare entry")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ListSharedEntries lists entries other users have shared with the current user
+func (h *JournalHandler) ListSharedEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	entries, total, err := h.journalService.ListSharedEntries(userID, page, pageSize)
+	if err != nil {
+		writeError(w, err, "Failed to list shared entries")
+		return
+	}
+
+	response := struct {
+		Entries []models.JournalEntryDTO `json:"entries"`
+		Total   int64                    `json:"total"`
+	}{
+		Entries: entries,
+		Total:   total,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 func (h *JournalHandler) ListEntries(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -171,25 +536,68 @@ func (h *JournalHandler) ListEntries(w http.ResponseWriter, r *http.Request) {
 		pageSize = 10
 	}
 
-	var categoryID *uint
+	var filter services.EntryFilter
 	if catID := r.URL.Query().Get("categoryId"); catID != "" {
 		if id, err := strconv.ParseUint(catID, 10, 32); err == nil {
 			uid := uint(id)
-			categoryID = &uid
+			filter.CategoryID = &uid
 		}
 	}
+	filter.IncludeSubcategories = r.URL.Query().Get("includeSubcategories") == "true"
 
-	var tagID *uint
 	if tID := r.URL.Query().Get("tagId"); tID != "" {
 		if id, err := strconv.ParseUint(tID, 10, 32); err == nil {
 			uid := uint(id)
-			tagID = &uid
+			filter.TagID = &uid
+		}
+	}
+
+	// Filtering by a parent tag includes its descendants unless turned off
+	filter.IncludeSubtags = r.URL.Query().Get("includeSubtags") != "false"
+
+	// Drafts are hidden unless explicitly requested
+	filter.Drafts = r.URL.Query().Get("drafts")
+
+	if from := r.URL.Query().Get("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		filter.From = &date
+	}
+
+	if to := r.URL.Query().Get("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		filter.To = &date
+	}
+
+	if bbox := r.URL.Query().Get("bbox"); bbox != "" {
+		bounds, err := parseBoundingBox(bbox)
+		if err != nil {
+			http.Error(w, "Invalid bbox: expected west,south,east,north in degrees", http.StatusBadRequest)
+			return
+		}
+		filter.Bounds = bounds
+	}
+
+	// lat, lon and radius (in meters) go together
+	if r.URL.Query().Has("lat") || r.URL.Query().Has("lon") || r.URL.Query().Has("radius") {
+		near, err := parseRadius(r.URL.Query().Get("lat"), r.URL.Query().Get("lon"), r.URL.Query().Get("radius"))
+		if err != nil {
+			http.Error(w, "Invalid radius search: lat, lon and radius are all required", http.StatusBadRequest)
+			return
 		}
+		filter.Near = near
 	}
 
-	entries, total, err := h.journalService.ListEntries(userID, categoryID, tagID, page, pageSize)
+	entries, total, err := h.journalService.ListEntries(userID, filter, page, pageSize)
 	if err != nil {
-		http.Error(w, "Failed to list entries", http.StatusInternalServerError)
+		writeError(w, err, "Failed to list entries")
 		return
 	}
 
@@ -205,6 +613,44 @@ func (h *JournalHandler) ListEntries(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetEntryMap returns the current user's located entries as a GeoJSON
+// FeatureCollection, clustered for the given zoom level
+func (h *JournalHandler) GetEntryMap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+
+	zoom := 0
+	if z := r.URL.Query().Get("zoom"); z != "" {
+		var err error
+		if zoom, err = strconv.Atoi(z); err != nil {
+			http.Error(w, "Invalid zoom", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var bounds *services.BoundingBox
+	if bbox := r.URL.Query().Get("bbox"); bbox != "" {
+		var err error
+		if bounds, err = parseBoundingBox(bbox); err != nil {
+			http.Error(w, "Invalid bbox: expected west,south,east,north in degrees", http.StatusBadRequest)
+			return
+		}
+	}
+
+	collection, err := h.journalService.GetEntryMap(userID, zoom, bounds)
+	if err != nil {
+		writeError(w, err, "Failed to retrieve entry map")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(collection)
+}
+
 func (h *JournalHandler) GetEntryStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -213,12 +659,394 @@ func (h *JournalHandler) GetEntryStats(w http.ResponseWriter, r *http.Request) {
 
 	userID := r.Context().Value("userID").(uint)
 
-	stats, err := h.journalService.GetEntryStats(userID)
+	var tagID *uint
+	if tID := r.URL.Query().Get("tagId"); tID != "" {
+		if id, err := strconv.ParseUint(tID, 10, 32); err == nil {
+			uid := uint(id)
+			tagID = &uid
+		}
+	}
+
+	stats, err := h.journalService.GetEntryStats(userID, tagID)
+	if err != nil {
+		writeError(w, err, "Failed to get entry stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetEntryTimeSeries returns entry, word, mood and category counts per day,
+// week or month
+func (h *JournalHandler) GetEntryTimeSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+
+	from, to, ok := parseDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	series, err := h.journalService.GetEntryTimeSeries(userID, interval, from, to)
+	if err != nil {
+		writeError(w, err, "Failed to get entry time series")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// GetMoodStats returns mood trends, averages per weekday and correlations of
+// moods with tags and categories
+func (h *JournalHandler) GetMoodStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "week"
+	}
+
+	from, to, ok := parseDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.journalService.GetMoodStats(userID, interval, from, to)
 	if err != nil {
-		http.Error(w, "Failed to get entry stats", http.StatusInternalServerError)
+		writeError(w, err, "Failed to get mood stats")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
+
+// parseDateRange reads the optional from and to query dates (YYYY-MM-DD). On
+// a malformed date it writes a 400 and returns ok false.
+func parseDateRange(w http.ResponseWriter, r *http.Request) (from, to *time.Time, ok bool) {
+	if value := r.URL.Query().Get("from"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		from = &date
+	}
+
+	if value := r.URL.Query().Get("to"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		to = &date
+	}
+
+	return from, to, true
+}
+
+// GetEntryCalendar returns per-day entry counts for a year, defaulting to the
+// current one, plus the user's writing streaks
+func (h *JournalHandler) GetEntryCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.Context().Value("userID").(uint)
+
+	year := 0
+	if value := r.URL.Query().Get("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		year = parsed
+	}
+
+	calendar, err := h.journalService.GetEntryCalendar(userID, year)
+	if err != nil {
+		writeError(w, err, "Failed to get entry calendar")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
+
+// errIfMatchFailed is returned by parseIfMatch for entity tags that can never
+// match strongly: weak tags and tags of another representation
+var errIfMatchFailed = errors.New("entity tag cannot match strongly")
+
+// entryETag builds the strong validator clients send back in If-Match
+func entryETag(entry *models.JournalEntryDTO) string {
+	return fmt.Sprintf("\"%d\"", entry.Version)
+}
+
+// renderedEntryETag tags the ?format=html representation, which differs from
+// the plain one and so needs a validator of its own
+func renderedEntryETag(entry *models.JournalEntryDTO) string {
+	return fmt.Sprintf("\"%d-html\"", entry.Version)
+}
+
+// parseIfMatch extracts the expected entry version from an If-Match header.
+// A missing header or "*" means the client does not require a specific version.
+// If-Match uses strong comparison (RFC 9110, section 13.1.1), so weak tags and
+// the tag of the rendered HTML fail with errIfMatchFailed.
+func parseIfMatch(header string) (*uint, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	if strings.HasPrefix(header, "W/") {
+		return nil, errIfMatchFailed
+	}
+
+	tag := strings.Trim(header, "\"")
+	if strings.HasSuffix(tag, "-html") {
+		return nil, errIfMatchFailed
+	}
+	version, err := strconv.ParseUint(tag, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	v := uint(version)
+	return &v, nil
+}
+
+// writeIfMatchError responds to an If-Match header parseIfMatch rejected
+func writeIfMatchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errIfMatchFailed) {
+		http.Error(w, "If-Match needs the strong ETag of the entry", http.StatusPreconditionFailed)
+		return
+	}
+	http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+}
+
+// writeVersionConflict responds with 412 and the entry as currently stored so
+// the client can merge its changes
+func writeVersionConflict(w http.ResponseWriter, conflict *services.VersionConflictError) {
+	response := struct {
+		Error   string                  `json:"error"`
+		Current *models.JournalEntryDTO `json:"current"`
+	}{
+		Error:   "Entry has been modified since it was loaded",
+		Current: conflict.Current,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", entryETag(conflict.Current))
+	w.WriteHeader(http.StatusPreconditionFailed)
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseEntryPatch converts a merge patch document into an EntryPatch. Per
+// RFC 7396 a null member removes the field, which is only allowed for optional
+// fields.
+func parseEntryPatch(body map[string]json.RawMessage) (services.EntryPatch, error) {
+	var patch services.EntryPatch
+
+	for field, raw := range body {
+		isNull := string(raw) == "null"
+
+		switch field {
+		case "title":
+			if isNull {
+				return patch, errors.New("Title cannot be removed")
+			}
+			var title string
+			if err := json.Unmarshal(raw, &title); err != nil {
+				return patch, errors.New("Invalid title")
+			}
+			patch.Title = &title
+		case "content":
+			if isNull {
+				return patch, errors.New("Content cannot be removed")
+			}
+			var content string
+			if err := json.Unmarshal(raw, &content); err != nil {
+				return patch, errors.New("Invalid content")
+			}
+			patch.Content = &content
+		case "categoryId":
+			patch.SetCategory = true
+			if !isNull {
+				var categoryID uint
+				if err := json.Unmarshal(raw, &categoryID); err != nil {
+					return patch, errors.New("Invalid categoryId")
+				}
+				patch.CategoryID = &categoryID
+			}
+		case "mood":
+			mood := ""
+			if !isNull {
+				if err := json.Unmarshal(raw, &mood); err != nil {
+					return patch, errors.New("Invalid mood")
+				}
+			}
+			patch.Mood = &mood
+		case "createMood":
+			if err := json.Unmarshal(raw, &patch.CreateMood); err != nil {
+				return patch, errors.New("Invalid createMood")
+			}
+		case "moodIntensity":
+			patch.SetMoodIntensity = true
+			if !isNull {
+				var intensity uint8
+				if err := json.Unmarshal(raw, &intensity); err != nil {
+					return patch, errors.New("Invalid moodIntensity")
+				}
+				patch.MoodIntensity = &intensity
+			}
+		case "tags":
+			tags := []string{}
+			if !isNull {
+				if err := json.Unmarshal(raw, &tags); err != nil {
+					return patch, errors.New("Invalid tags")
+				}
+			}
+			patch.Tags = &tags
+		case "entryDate":
+			if isNull {
+				return patch, errors.New("Entry date cannot be removed")
+			}
+			var date string
+			if err := json.Unmarshal(raw, &date); err != nil {
+				return patch, errors.New("Invalid entryDate")
+			}
+			patch.EntryDate = &date
+		case "entryTime":
+			patch.SetEntryTime = true
+			if !isNull {
+				var entryTime string
+				if err := json.Unmarshal(raw, &entryTime); err != nil {
+					return patch, errors.New("Invalid entryTime")
+				}
+				patch.EntryTime = &entryTime
+			}
+		case "entryTimezone":
+			if isNull {
+				return patch, errors.New("Entry timezone cannot be removed")
+			}
+			var zone string
+			if err := json.Unmarshal(raw, &zone); err != nil {
+				return patch, errors.New("Invalid entryTimezone")
+			}
+			patch.EntryTimezone = &zone
+		case "location":
+			location, err := parseLocationPatch(raw)
+			if err != nil {
+				return patch, err
+			}
+			patch.SetLocation = true
+			patch.Location = location
+		default:
+			return patch, fmt.Errorf("Field %q cannot be patched", field)
+		}
+	}
+
+	return patch, nil
+}
+
+// parseLocation reads a location object, returning nil for null
+func parseLocation(raw json.RawMessage) (*services.LocationInput, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	var location LocationRequest
+	if err := json.Unmarshal(raw, &location); err != nil {
+		return nil, errors.New("Invalid location")
+	}
+	return location.input(), nil
+}
+
+// parseLocationPatch reads the location member of a merge patch, which is
+// itself merged: members left out keep their value and null members are
+// removed. A null location removes the whole location.
+func parseLocationPatch(raw json.RawMessage) (*services.LocationPatch, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return nil, errors.New("Invalid location")
+	}
+
+	var patch services.LocationPatch
+	for field, value := range members {
+		var err error
+		switch field {
+		case "latitude":
+			patch.SetLatitude = true
+			err = json.Unmarshal(value, &patch.Latitude)
+		case "longitude":
+			patch.SetLongitude = true
+			err = json.Unmarshal(value, &patch.Longitude)
+		case "accuracy":
+			patch.SetAccuracy = true
+			err = json.Unmarshal(value, &patch.Accuracy)
+		case "placeName":
+			placeName := ""
+			if string(value) != "null" {
+				err = json.Unmarshal(value, &placeName)
+			}
+			patch.PlaceName = &placeName
+		default:
+			return nil, fmt.Errorf("Field %q of location cannot be patched", field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid location %s", field)
+		}
+	}
+	return &patch, nil
+}
+
+// parseBoundingBox reads a bbox parameter in GeoJSON order,
+// "west,south,east,north"
+func parseBoundingBox(value string) (*services.BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, errors.New("bbox needs four values")
+	}
+
+	var coords [4]float64
+	for i, part := range parts {
+		coord, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		coords[i] = coord
+	}
+	return &services.BoundingBox{West: coords[0], South: coords[1], East: coords[2], North: coords[3]}, nil
+}
+
+// parseRadius reads the lat, lon and radius parameters of a radius search
+func parseRadius(lat, lon, radius string) (*services.Radius, error) {
+	var values [3]float64
+	for i, value := range []string{lat, lon, radius} {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return &services.Radius{Latitude: values[0], Longitude: values[1], Meters: values[2]}, nil
+}
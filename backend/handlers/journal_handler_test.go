@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"journal/models"
+	"journal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    uint
+		wantNil bool
+		wantErr bool
+		// wantFailed means the tag is well formed but can never match
+		wantFailed bool
+	}{
+		{header: "", wantNil: true},
+		{header: "   ", wantNil: true},
+		{header: "*", wantNil: true},
+		{header: `"3"`, want: 3},
+		{header: "3", want: 3},
+		{header: `W/"12"`, wantErr: true, wantFailed: true},
+		{header: `W/"abc"`, wantErr: true, wantFailed: true},
+		{header: `"12-html"`, wantErr: true, wantFailed: true},
+		{header: ` "7" `, want: 7},
+		{header: `"4294967295"`, want: 4294967295},
+		{header: `"4294967296"`, wantErr: true},
+		{header: `"-1"`, wantErr: true},
+		{header: `"abc"`, wantErr: true},
+		{header: `"1", "2"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseIfMatch(tt.header)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseIfMatch(%q) = %v, want an error", tt.header, got)
+			} else if errors.Is(err, errIfMatchFailed) != tt.wantFailed {
+				t.Errorf("parseIfMatch(%q) error = %v, want errIfMatchFailed %v", tt.header, err, tt.wantFailed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseIfMatch(%q) returned error %v", tt.header, err)
+			continue
+		}
+		if tt.wantNil {
+			if got != nil {
+				t.Errorf("parseIfMatch(%q) = %d, want nil", tt.header, *got)
+			}
+			continue
+		}
+		if got == nil || *got != tt.want {
+			t.Errorf("parseIfMatch(%q) = %v, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestParseEntryPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+		check   func(t *testing.T, patch services.EntryPatch)
+	}{
+		{
+			name: "empty patch changes nothing",
+			body: `{}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if patch.Title != nil || patch.Content != nil || patch.Mood != nil || patch.Tags != nil ||
+					patch.SetCategory || patch.SetMoodIntensity || patch.SetEntryTime || patch.SetLocation {
+					t.Errorf("patch = %+v, want no changes", patch)
+				}
+			},
+		},
+		{
+			name: "title and content",
+			body: `{"title":"New","content":"Body"}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if patch.Title == nil || *patch.Title != "New" || patch.Content == nil || *patch.Content != "Body" {
+					t.Errorf("patch = %+v", patch)
+				}
+			},
+		},
+		{name: "null title", body: `{"title":null}`, wantErr: true},
+		{name: "null content", body: `{"content":null}`, wantErr: true},
+		{name: "null entry date", body: `{"entryDate":null}`, wantErr: true},
+		{name: "null entry timezone", body: `{"entryTimezone":null}`, wantErr: true},
+		{name: "title of wrong type", body: `{"title":3}`, wantErr: true},
+		{name: "unknown field", body: `{"userId":2}`, wantErr: true},
+		{name: "negative category", body: `{"categoryId":-1}`, wantErr: true},
+		{name: "intensity out of range", body: `{"moodIntensity":300}`, wantErr: true},
+		{
+			name: "null category clears it",
+			body: `{"categoryId":null}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if !patch.SetCategory || patch.CategoryID != nil {
+					t.Errorf("SetCategory = %v, CategoryID = %v, want cleared", patch.SetCategory, patch.CategoryID)
+				}
+			},
+		},
+		{
+			name: "category",
+			body: `{"categoryId":4}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if !patch.SetCategory || patch.CategoryID == nil || *patch.CategoryID != 4 {
+					t.Errorf("SetCategory = %v, CategoryID = %v, want 4", patch.SetCategory, patch.CategoryID)
+				}
+			},
+		},
+		{
+			name: "null mood clears it",
+			body: `{"mood":null}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if patch.Mood == nil || *patch.Mood != "" {
+					t.Errorf("Mood = %v, want empty", patch.Mood)
+				}
+			},
+		},
+		{
+			name: "new mood",
+			body: `{"mood":"Restless","createMood":true}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if patch.Mood == nil || *patch.Mood != "Restless" || !patch.CreateMood {
+					t.Errorf("Mood = %v, CreateMood = %v, want Restless created", patch.Mood, patch.CreateMood)
+				}
+			},
+		},
+		{name: "createMood of wrong type", body: `{"createMood":"yes"}`, wantErr: true},
+		{
+			name: "null mood intensity clears it",
+			body: `{"moodIntensity":null}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if !patch.SetMoodIntensity || patch.MoodIntensity != nil {
+					t.Errorf("SetMoodIntensity = %v, MoodIntensity = %v", patch.SetMoodIntensity, patch.MoodIntensity)
+				}
+			},
+		},
+		{
+			name: "null tags remove all tags",
+			body: `{"tags":null}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if patch.Tags == nil || len(*patch.Tags) != 0 {
+					t.Errorf("Tags = %v, want empty", patch.Tags)
+				}
+			},
+		},
+		{
+			name: "tags",
+			body: `{"tags":["a","b"]}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if patch.Tags == nil || len(*patch.Tags) != 2 {
+					t.Errorf("Tags = %v, want [a b]", patch.Tags)
+				}
+			},
+		},
+		{
+			name: "null entry time clears it",
+			body: `{"entryTime":null,"entryDate":"2024-05-01"}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if !patch.SetEntryTime || patch.EntryTime != nil || patch.EntryDate == nil || *patch.EntryDate != "2024-05-01" {
+					t.Errorf("patch = %+v", patch)
+				}
+			},
+		},
+		{
+			name: "null location clears it",
+			body: `{"location":null}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				if !patch.SetLocation || patch.Location != nil {
+					t.Errorf("SetLocation = %v, Location = %+v, want cleared", patch.SetLocation, patch.Location)
+				}
+			},
+		},
+		{
+			name: "location members left out are kept",
+			body: `{"location":{"placeName":"Home"}}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				location := patch.Location
+				if !patch.SetLocation || location == nil {
+					t.Fatalf("SetLocation = %v, Location = %+v", patch.SetLocation, location)
+				}
+				if location.PlaceName == nil || *location.PlaceName != "Home" {
+					t.Errorf("PlaceName = %v, want Home", location.PlaceName)
+				}
+				if location.SetLatitude || location.SetLongitude || location.SetAccuracy {
+					t.Errorf("location = %+v, want coordinates untouched", location)
+				}
+			},
+		},
+		{
+			name: "null location members are removed",
+			body: `{"location":{"accuracy":null,"placeName":null,"latitude":1.5,"longitude":-2}}`,
+			check: func(t *testing.T, patch services.EntryPatch) {
+				location := patch.Location
+				if location == nil {
+					t.Fatal("Location = nil")
+				}
+				if !location.SetAccuracy || location.Accuracy != nil {
+					t.Errorf("SetAccuracy = %v, Accuracy = %v, want removed", location.SetAccuracy, location.Accuracy)
+				}
+				if location.PlaceName == nil || *location.PlaceName != "" {
+					t.Errorf("PlaceName = %v, want removed", location.PlaceName)
+				}
+				if !location.SetLatitude || *location.Latitude != 1.5 || !location.SetLongitude || *location.Longitude != -2 {
+					t.Errorf("location = %+v", location)
+				}
+			},
+		},
+		{name: "location of wrong type", body: `{"location":"Home"}`, wantErr: true},
+		{name: "location coordinate of wrong type", body: `{"location":{"latitude":"north"}}`, wantErr: true},
+		{name: "unknown location field", body: `{"location":{"altitude":12}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatal(err)
+			}
+
+			patch, err := parseEntryPatch(body)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseEntryPatch(%s) succeeded, want an error", tt.body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEntryPatch(%s) returned error %v", tt.body, err)
+			}
+			tt.check(t, patch)
+		})
+	}
+}
+
+func TestPreviewContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{name: "markdown", body: `{"content":"**hi**"}`, wantCode: http.StatusOK},
+		{name: "invalid json", body: `{"content":`, wantCode: http.StatusBadRequest},
+		{name: "at the limit", body: `{"content":"` + strings.Repeat("a", maxPreviewBody-len(`{"content":""}`)) + `"}`, wantCode: http.StatusOK},
+		{name: "over the limit", body: `{"content":"` + strings.Repeat("a", maxPreviewBody) + `"}`, wantCode: http.StatusRequestEntityTooLarge},
+	}
+
+	h := NewJournalHandler(&services.JournalService{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.PreviewContent(w, httptest.NewRequest(http.MethodPost, "/api/entries/preview", strings.NewReader(tt.body)))
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestEntryETags(t *testing.T) {
+	entry := &models.JournalEntryDTO{Version: 7}
+	if got := entryETag(entry); got != `"7"` {
+		t.Errorf("entryETag() = %s, want \"7\"", got)
+	}
+	if got := renderedEntryETag(entry); got != `"7-html"` {
+		t.Errorf("renderedEntryETag() = %s, want \"7-html\"", got)
+	}
+
+	// Each tag must round-trip through If-Match only for its own representation
+	if version, err := parseIfMatch(entryETag(entry)); err != nil || version == nil || *version != 7 {
+		t.Errorf("parseIfMatch(entryETag()) = %v, %v, want 7", version, err)
+	}
+	if _, err := parseIfMatch(renderedEntryETag(entry)); !errors.Is(err, errIfMatchFailed) {
+		t.Errorf("parseIfMatch(renderedEntryETag()) error = %v, want errIfMatchFailed", err)
+	}
+}
+
+func TestUpdateEntryRejectsWeakIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{header: `W/"1"`, want: http.StatusPreconditionFailed},
+		{header: `"1-html"`, want: http.StatusPreconditionFailed},
+		{header: `"one"`, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		db, conn := fakeDB(t, nil)
+		h := NewJournalHandler(services.NewJournalService(db, nil, nil, nil))
+
+		r := httptest.NewRequest(http.MethodPut, "/api/entries/3", strings.NewReader(`{"title":"t","content":"c"}`))
+		r.Header.Set("If-Match", tt.header)
+		r = mux.SetURLVars(r, map[string]string{"id": "3"})
+		r = r.WithContext(context.WithValue(r.Context(), "userID", uint(5)))
+		w := httptest.NewRecorder()
+		h.UpdateEntry(w, r)
+
+		if w.Code != tt.want {
+			t.Errorf("If-Match %s: status = %d, want %d", tt.header, w.Code, tt.want)
+		}
+		if len(conn.statements) != 0 {
+			t.Errorf("If-Match %s: ran %q, want no statements", tt.header, conn.statements)
+		}
+	}
+}
+
+func TestShareEntryHidesWhetherEmailIsRegistered(t *testing.T) {
+	sharedAt := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	entry := fakeRows{
+		columns: []string{"id", "user_id", "is_draft", "version"},
+		rows:    [][]driver.Value{{int64(3), int64(5), false, int64(1)}},
+	}
+	// The same rows answer both the preload of the entry's shares and the
+	// list of emails
+	listed := fakeRows{
+		columns: []string{"entry_id", "user_id", "created_at", "email", "shared_at"},
+		rows:    [][]driver.Value{{int64(3), int64(7), sharedAt, "Reader@Example.com", sharedAt}},
+	}
+
+	tests := []struct {
+		name   string
+		tables map[string]fakeRows
+		insert string
+	}{
+		{
+			name: "registered",
+			tables: map[string]fakeRows{
+				"journal_entries": entry,
+				"users": {
+					columns: []string{"id", "email"},
+					rows:    [][]driver.Value{{int64(7), "Reader@Example.com"}},
+				},
+				"entry_shares": listed,
+			},
+			insert: "INSERT INTO `entry_shares`",
+		},
+		{
+			name: "not registered",
+			tables: map[string]fakeRows{
+				"journal_entries": entry,
+				"entry_invites": {
+					columns: []string{"email", "shared_at"},
+					rows:    [][]driver.Value{{"reader@example.com", sharedAt}},
+				},
+			},
+			insert: "INSERT INTO `entry_invites`",
+		},
+	}
+
+	var bodies []string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, conn := fakeDB(t, tt.tables)
+			h := NewJournalHandler(services.NewJournalService(db, nil, nil, nil))
+
+			r := httptest.NewRequest(http.MethodPost, "/api/entries/3/shares", strings.NewReader(`{"email":" Reader@Example.com "}`))
+			r = mux.SetURLVars(r, map[string]string{"id": "3"})
+			r = r.WithContext(context.WithValue(r.Context(), "userID", uint(5)))
+			w := httptest.NewRecorder()
+			h.ShareEntry(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			bodies = append(bodies, w.Body.String())
+
+			inserted := false
+			for _, statement := range conn.statements {
+				if strings.HasPrefix(statement, tt.insert) {
+					inserted = true
+				}
+			}
+			if !inserted {
+				t.Errorf("statements = %q, want one starting with %q", conn.statements, tt.insert)
+			}
+		})
+	}
+
+	if len(bodies) == 2 && bodies[0] != bodies[1] {
+		t.Errorf("registered email got %s, unregistered got %s; want the same", bodies[0], bodies[1])
+	}
+	want := `[{"email":"reader@example.com","sharedAt":"2024-05-01T09:30:00Z"}]` + "\n"
+	for _, body := range bodies {
+		if body != want {
+			t.Errorf("body = %s, want %s", body, want)
+		}
+	}
+}
+
+func TestShareEntryInvalidEmail(t *testing.T) {
+	for _, email := range []string{"not an email", "Reader <reader@example.com>", "reader@"} {
+		db, _ := fakeDB(t, nil)
+		h := NewJournalHandler(services.NewJournalService(db, nil, nil, nil))
+
+		body, _ := json.Marshal(map[string]string{"email": email})
+		r := httptest.NewRequest(http.MethodPost, "/api/entries/3/shares", strings.NewReader(string(body)))
+		r = mux.SetURLVars(r, map[string]string{"id": "3"})
+		r = r.WithContext(context.WithValue(r.Context(), "userID", uint(5)))
+		w := httptest.NewRecorder()
+		h.ShareEntry(w, r)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ShareEntry(%q) status = %d, want %d", email, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestArchivedCategoryCannotBeAssigned(t *testing.T) {
+	archivedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	archived := fakeRows{
+		columns: []string{"id", "archived_at"},
+		rows:    [][]driver.Value{{int64(4), archivedAt}},
+	}
+	entryIn := func(categoryID int64) fakeRows {
+		return fakeRows{
+			columns: []string{"id", "user_id", "category_id", "title", "content", "is_draft", "version", "entry_date", "entry_timezone"},
+			rows:    [][]driver.Value{{int64(3), int64(5), categoryID, "Old", "Old", false, int64(1), archivedAt, "UTC"}},
+		}
+	}
+	body := `{"title":"Walk","content":"By the sea","categoryId":4}`
+
+	tests := []struct {
+		name   string
+		method string
+		tables map[string]fakeRows
+		want   int
+	}{
+		{
+			name:   "new entry",
+			method: http.MethodPost,
+			tables: map[string]fakeRows{"categories": archived},
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "moved into it",
+			method: http.MethodPut,
+			tables: map[string]fakeRows{"categories": archived, "journal_entries": entryIn(2)},
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "already in it",
+			method: http.MethodPut,
+			tables: map[string]fakeRows{"categories": archived, "journal_entries": entryIn(4)},
+			want:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, conn := fakeDB(t, tt.tables)
+			h := NewJournalHandler(services.NewJournalService(db, nil, nil, nil))
+
+			r := httptest.NewRequest(tt.method, "/api/entries/3", strings.NewReader(body))
+			r = mux.SetURLVars(r, map[string]string{"id": "3"})
+			r = r.WithContext(context.WithValue(r.Context(), "userID", uint(5)))
+			w := httptest.NewRecorder()
+			if tt.method == http.MethodPost {
+				h.CreateEntry(w, r)
+			} else {
+				h.UpdateEntry(w, r)
+			}
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s\n%s", w.Code, tt.want, w.Body, strings.Join(conn.statements, "\n"))
+			}
+		})
+	}
+}
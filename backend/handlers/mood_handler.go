@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"journal/models"
+	"journal/services"
+
+	"github.com/gorilla/mux"
+)
+
+type MoodHandler struct {
+	moodService *services.MoodService
+}
+
+func NewMoodHandler(moodService *services.MoodService) *MoodHandler {
+	return &MoodHandler{
+		moodService: moodService,
+	}
+}
+
+// GetMoods retrieves the current user's mood vocabulary
+func (h *MoodHandler) GetMoods(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	moods, err := h.moodService.GetMoods(userID)
+	if err != nil {
+		writeError(w, err, "Failed to retrieve moods")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(moods)
+}
+
+// CreateMood adds a mood to the current user's vocabulary
+func (h *MoodHandler) CreateMood(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	var moodDTO models.MoodDTO
+	if err := json.NewDecoder(r.Body).Decode(&moodDTO); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mood, err := h.moodService.CreateMood(userID, moodDTO)
+	if err != nil {
+		writeError(w, err, "Failed to create mood")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mood)
+}
+
+// UpdateMood changes a mood's name, emoji, color or valence
+func (h *MoodHandler) UpdateMood(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse mood ID from URL
+	vars := mux.Vars(r)
+	moodID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid mood ID", http.StatusBadRequest)
+		return
+	}
+
+	var moodDTO models.MoodDTO
+	if err := json.NewDecoder(r.Body).Decode(&moodDTO); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mood, err := h.moodService.UpdateMood(uint(moodID), actor, moodDTO)
+	if err != nil {
+		writeError(w, err, "Failed to update mood")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mood)
+}
+
+// DeleteMood removes a mood; pass ?detach=true to clear it from entries that use it
+func (h *MoodHandler) DeleteMood(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse mood ID from URL
+	vars := mux.Vars(r)
+	moodID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid mood ID", http.StatusBadRequest)
+		return
+	}
+
+	detach := r.URL.Query().Get("detach") == "true"
+
+	if err := h.moodService.DeleteMood(uint(moodID), actor, detach); err != nil {
+		writeError(w, err, "Failed to delete mood")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"journal/services"
+
+	"github.com/gorilla/mux"
+)
+
+type TagHandler struct {
+	tagService *services.TagService
+}
+
+func NewTagHandler(tagService *services.TagService) *TagHandler {
+	return &TagHandler{
+		tagService: tagService,
+	}
+}
+
+type RenameTagRequest struct {
+	Name  string `json:"name"`
+	Merge bool   `json:"merge"`
+}
+
+type MergeTagsRequest struct {
+	SourceIDs []uint `json:"sourceIds"`
+	TargetID  uint   `json:"targetId"`
+}
+
+// GetTags retrieves all tags for the current user with usage counts, as a flat
+// list or, with ?format=tree, nested by hierarchy
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	if r.URL.Query().Get("format") == "tree" {
+		tree, err := h.tagService.GetTagTree(userID)
+		if err != nil {
+			http.Error(w, "Failed to retrieve tags", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tree)
+		return
+	}
+
+	tags, err := h.tagService.GetTags(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// SuggestTags autocompletes tag names from the q prefix
+func (h *TagHandler) SuggestTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get current userID from context
+	userID := r.Context().Value("userID").(uint)
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	tags, err := h.tagService.SuggestTags(userID, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		http.Error(w, "Failed to suggest tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// SuggestTagsForEntry proposes existing tags for an entry based on its content
+func (h *TagHandler) SuggestTagsForEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse entry ID from URL
+	vars := mux.Vars(r)
+	entryID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid entry ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 50 {
+		limit = 5
+	}
+
+	suggestions, err := h.tagService.SuggestTagsForEntry(uint(entryID), actor, limit)
+	if err != nil {
+		writeError(w, err, "Failed to suggest tags")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// GetTagStats summarizes the entries carrying a tag, including its descendants
+// unless ?includeSubtags=false
+func (h *TagHandler) GetTagStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse tag ID from URL
+	vars := mux.Vars(r)
+	tagID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	includeSubtags := r.URL.Query().Get("includeSubtags") != "false"
+
+	stats, err := h.tagService.GetTagStats(uint(tagID), actor, includeSubtags)
+	if err != nil {
+		writeError(w, err, "Failed to get tag stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// RenameTag renames a tag, optionally merging it into an existing tag with the same name
+func (h *TagHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse tag ID from URL
+	vars := mux.Vars(r)
+	tagID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RenameTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.tagService.RenameTag(uint(tagID), actor, req.Name, req.Merge)
+	if err != nil {
+		writeError(w, err, "Failed to rename tag")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// MergeTags folds several tags into one
+func (h *TagHandler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	var req MergeTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.TargetID == 0 || len(req.SourceIDs) == 0 {
+		http.Error(w, "sourceIds and targetId are required", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.tagService.MergeTags(actor, req.SourceIDs, req.TargetID)
+	if err != nil {
+		writeError(w, err, "Failed to merge tags")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag deletes a tag; pass ?detach=true to remove it from entries that still use it
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the current actor from context
+	actor := currentActor(r)
+
+	// Parse tag ID from URL
+	vars := mux.Vars(r)
+	tagID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	detach := r.URL.Query().Get("detach") == "true"
+
+	if err := h.tagService.DeleteTag(uint(tagID), actor, detach); err != nil {
+		writeError(w, err, "Failed to delete tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -9,11 +9,20 @@ import (
 	"journal/services"
 )
 
+// UserPreferencesRequest updates preferences. Timezone and HideLocation are
+// optional and keep their stored values when left out.
 type UserPreferencesRequest struct {
-	Theme              string `json:"theme"`
-	DefaultView        string `json:"defaultView"`
-	DateFormat         string `json:"dateFormat"`
-	EmailNotifications bool   `json:"emailNotifications"`
+	Theme              string  `json:"theme"`
+	DefaultView        string  `json:"defaultView"`
+	DateFormat         string  `json:"dateFormat"`
+	EmailNotifications bool    `json:"emailNotifications"`
+	Timezone           *string `json:"timezone"`
+	HideLocation       *bool   `json:"hideLocation"`
+}
+
+// DeleteAccountRequest confirms an account deletion with the user's password
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
 }
 
 type UserHandler struct {
@@ -49,6 +58,8 @@ func (h *UserHandler) GetUserPreferences(w http.ResponseWriter, r *http.Request)
 		DefaultView:        prefs.DefaultView,
 		DateFormat:         prefs.DateFormat,
 		EmailNotifications: prefs.EmailNotifications,
+		Timezone:           prefs.Timezone,
+		HideLocation:       prefs.HideLocation,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -73,16 +84,18 @@ func (h *UserHandler) UpdateUserPreferences(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Update preferences in service
-	prefs := models.UserPreferences{
+	prefs := services.PreferencesInput{
 		Theme:              req.Theme,
 		DefaultView:        req.DefaultView,
 		DateFormat:         req.DateFormat,
 		EmailNotifications: req.EmailNotifications,
+		Timezone:           req.Timezone,
+		HideLocation:       req.HideLocation,
 	}
 
 	updatedPrefs, err := h.userService.UpdateUserPreferences(userID, prefs)
 	if err != nil {
-		http.Error(w, "Failed to update user preferences", http.StatusInternalServerError)
+		writeError(w, err, "Failed to update user preferences")
 		return
 	}
 
@@ -92,12 +105,39 @@ func (h *UserHandler) UpdateUserPreferences(w http.ResponseWriter, r *http.Reque
 		DefaultView:        updatedPrefs.DefaultView,
 		DateFormat:         updatedPrefs.DateFormat,
 		EmailNotifications: updatedPrefs.EmailNotifications,
+		Timezone:           updatedPrefs.Timezone,
+		HideLocation:       updatedPrefs.HideLocation,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// DeleteAccount deletes the current user's account with all their entries,
+// attachments and settings
+func (h *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user ID from context
+	userID := r.Context().Value("userID").(uint)
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.DeleteUser(userID, req.Password); err != nil {
+		writeError(w, err, "Failed to delete account")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // DebugUserPreferences is a debug endpoint to check raw user preferences
 func (h *UserHandler) DebugUserPreferences(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -135,6 +175,7 @@ func (h *UserHandler) DebugUserPreferences(w http.ResponseWriter, r *http.Reques
 		Theme              string    `json:"theme"`
 		DefaultView        string    `json:"defaultView"`
 		EmailNotifications bool      `json:"emailNotifications"`
+		Timezone           string    `json:"timezone"`
 		CreatedAt          time.Time `json:"createdAt"`
 		UpdatedAt          time.Time `json:"updatedAt"`
 	}{
@@ -143,6 +184,7 @@ func (h *UserHandler) DebugUserPreferences(w http.ResponseWriter, r *http.Reques
 		Theme:              prefs.Theme,
 		DefaultView:        prefs.DefaultView,
 		EmailNotifications: prefs.EmailNotifications,
+		Timezone:           prefs.Timezone,
 		CreatedAt:          prefs.CreatedAt,
 		UpdatedAt:          prefs.UpdatedAt,
 	}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"journal/models"
+	"journal/services"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeConn is a database connection that answers every query with the rows
+// of the first table whose name appears in it, and records every statement
+type fakeConn struct {
+	tables     map[string]fakeRows
+	statements []string
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (c *fakeConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeConn) Driver() driver.Driver                        { return nil }
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) Commit() error             { return nil }
+func (c *fakeConn) Rollback() error           { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.statements = append(s.conn.statements, s.query)
+	return fakeResult{}, nil
+}
+
+// fakeResult reports one row changed and no generated ID
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.statements = append(s.conn.statements, s.query)
+	for table, rows := range s.conn.tables {
+		if strings.Contains(s.query, "`"+table+"`") {
+			return &fakeCursor{fakeRows: rows}, nil
+		}
+	}
+	return &fakeCursor{}, nil
+}
+
+type fakeCursor struct {
+	fakeRows
+	next int
+}
+
+func (c *fakeCursor) Columns() []string { return c.columns }
+func (c *fakeCursor) Close() error      { return nil }
+
+func (c *fakeCursor) Next(dest []driver.Value) error {
+	if c.next >= len(c.rows) {
+		return io.EOF
+	}
+	copy(dest, c.rows[c.next])
+	c.next++
+	return nil
+}
+
+// fakeDB opens GORM on a fakeConn serving tables
+func fakeDB(t *testing.T, tables map[string]fakeRows) (*gorm.DB, *fakeConn) {
+	t.Helper()
+	conn := &fakeConn{tables: tables}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sql.OpenDB(conn),
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, conn
+}
+
+func TestUpdateUserPreferences(t *testing.T) {
+	now := time.Now()
+	stored := fakeRows{
+		columns: []string{"id", "created_at", "updated_at", "user_id", "theme", "default_view", "date_format", "email_notifications", "timezone", "hide_location"},
+		rows:    [][]driver.Value{{int64(1), now, now, int64(5), "light", "list", "MM/DD/YYYY", false, "Europe/Berlin", true}},
+	}
+
+	tests := []struct {
+		name         string
+		body         string
+		wantTimezone string
+		wantHide     bool
+	}{
+		{
+			name:         "fields left out are kept",
+			body:         `{"theme":"dark","defaultView":"grid","emailNotifications":true}`,
+			wantTimezone: "Europe/Berlin",
+			wantHide:     true,
+		},
+		{
+			name:         "empty timezone is kept",
+			body:         `{"theme":"dark","timezone":""}`,
+			wantTimezone: "Europe/Berlin",
+			wantHide:     true,
+		},
+		{
+			name:         "fields sent are changed",
+			body:         `{"theme":"dark","timezone":"Asia/Tokyo","hideLocation":false}`,
+			wantTimezone: "Asia/Tokyo",
+			wantHide:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, conn := fakeDB(t, map[string]fakeRows{"user_preferences": stored})
+			h := NewUserHandler(services.NewUserService(db, nil))
+
+			r := httptest.NewRequest(http.MethodPut, "/api/user/preferences", strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), "userID", uint(5)))
+			w := httptest.NewRecorder()
+			h.UpdateUserPreferences(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			var got models.UserPreferencesDTO
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Theme != "dark" || got.Timezone != tt.wantTimezone || got.HideLocation != tt.wantHide {
+				t.Errorf("preferences = %+v, want dark theme, timezone %q and hideLocation %v", got, tt.wantTimezone, tt.wantHide)
+			}
+			if last := conn.statements[len(conn.statements)-1]; !strings.HasPrefix(last, "UPDATE `user_preferences`") {
+				t.Errorf("last statement = %q, want the stored preferences updated", last)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -9,7 +10,9 @@ import (
 	"journal/db"
 	"journal/handlers"
 	"journal/internal/middleware"
+	"journal/pkg/blobstore"
 	"journal/pkg/redis"
+	"journal/pkg/sentiment"
 	"journal/router"
 	"journal/services"
 
@@ -40,17 +43,43 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Initialize attachment storage
+	blobs, err := newBlobStore()
+	if err != nil {
+		log.Fatalf("Failed to set up attachment storage: %v", err)
+	}
+
+	// Replace the embedded sentiment lexicon if one is configured
+	if path := os.Getenv("SENTIMENT_LEXICON"); path != "" {
+		if err := loadSentimentLexicon(path); err != nil {
+			log.Fatalf("Failed to load sentiment lexicon: %v", err)
+		}
+	}
+
 	// Initialize services
-	userService := services.NewUserService(database)
-	journalService := services.NewJournalService(database)
+	statsCache := services.NewStatsCache(redisClient)
+	renderCache := services.NewRenderCache(redisClient)
+	userService := services.NewUserService(database, blobs)
+	journalService := services.NewJournalService(database, statsCache, renderCache, blobs)
 	authService := services.NewAuthService(userService)
-	categoryService := services.NewCategoryService(database)
+	categoryService := services.NewCategoryService(database, statsCache)
+	tagService := services.NewTagService(database, statsCache)
+	goalService := services.NewGoalService(database)
+	moodService := services.NewMoodService(database, statsCache, renderCache)
+	attachmentService := services.NewAttachmentService(database, blobs)
+
+	// Analyze entries written before their current stats were tracked without holding up startup
+	go func() {
+		if err := journalService.AnalyzePendingEntries(); err != nil {
+			log.Printf("Failed to analyze existing entries: %v", err)
+		}
+	}()
 
 	// Initialize handler
 	authHandler := handlers.NewAuthHandler(authService)
 
 	// Setup router
-	r := router.SetupRouter(authService, journalService, categoryService, userService)
+	r := router.SetupRouter(authService, journalService, categoryService, userService, tagService, goalService, moodService, attachmentService)
 
 	// Configure rate limiting for auth routes
 	loginRateLimitConfig := middleware.RateLimitConfig{
@@ -81,8 +110,9 @@ func main() {
 	// Configure CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"}, // Vite's default port
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "If-Match"},
+		ExposedHeaders:   []string{"ETag"},
 		AllowCredentials: true,
 	})
 
@@ -100,3 +130,36 @@ func main() {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// loadSentimentLexicon replaces the embedded sentiment lexicon with the file at path
+func loadSentimentLexicon(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return sentiment.LoadLexicon(f)
+}
+
+// newBlobStore sets up where attachment files are kept: the local disk by
+// default, or an S3-compatible bucket when BLOB_STORE is "s3"
+func newBlobStore() (blobstore.BlobStore, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "data/attachments"
+		}
+		return blobstore.NewLocalStore(dir)
+	case "s3":
+		return blobstore.NewS3Store(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY_ID"),
+			os.Getenv("S3_SECRET_ACCESS_KEY"),
+		)
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, expected local or s3", os.Getenv("BLOB_STORE"))
+	}
+}
@@ -38,8 +38,9 @@ func AuthMiddleware(authService *services.AuthService) func(http.Handler) http.H
 				return
 			}
 
-			// Add user ID to context
+			// Add user ID and role to context
 			ctx := context.WithValue(r.Context(), "userID", claims.UserID)
+			ctx = context.WithValue(ctx, "role", claims.Role)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -12,10 +12,12 @@ type User struct {
 	PasswordHash string `gorm:"not null"`
 	FirstName    string
 	LastName     string
-	Preferences  UserPreferences
-	Categories   []Category
-	Entries      []JournalEntry
-	Tags         []Tag
+	// Role is "user" or "admin"; admins can read and change every user's data
+	Role        string `gorm:"size:20;not null;default:'user'"`
+	Preferences UserPreferences
+	Categories  []Category
+	Entries     []JournalEntry
+	Tags        []Tag
 }
 
 type UserPreferences struct {
@@ -25,36 +27,147 @@ type UserPreferences struct {
 	DefaultView        string `gorm:"default:'list'"`
 	DateFormat         string `gorm:"default:'MM/DD/YYYY'"`
 	EmailNotifications bool   `gorm:"default:false"`
+	Timezone           string `gorm:"size:64;default:'UTC'"`
+	// HideLocation keeps entry locations from the people entries are shared with
+	HideLocation bool `gorm:"not null;default:false"`
 }
 
 type Category struct {
 	gorm.Model
-	UserID  uint   `gorm:"not null"`
-	Name    string `gorm:"not null;index:idx_category_name,length:100"`
-	Color   string `gorm:"default:'#000000'"`
-	User    User   `gorm:"foreignKey:UserID"`
-	Entries []JournalEntry
+	UserID   uint   `gorm:"not null;uniqueIndex:idx_category_user_name"`
+	ParentID *uint  `gorm:"index:idx_category_parent"`
+	Name     string `gorm:"not null;uniqueIndex:idx_category_user_name,length:100"`
+	Color    string `gorm:"default:'#000000'"`
+	Position int    `gorm:"not null;default:0"`
+	// ArchivedAt hides the category from pickers while keeping its entries
+	ArchivedAt *time.Time
+	User       User       `gorm:"foreignKey:UserID"`
+	Children   []Category `gorm:"foreignKey:ParentID"`
+	Entries    []JournalEntry
 }
 
 type JournalEntry struct {
 	gorm.Model
-	UserID     uint `gorm:"not null"`
-	CategoryID *uint
-	Title      string `gorm:"not null;index:idx_entry_title,length:255"`
-	Content    string `gorm:"type:text;not null"`
-	Mood       string `gorm:"index:idx_entry_mood,length:50"`
-	WordCount  uint
-	User       User      `gorm:"foreignKey:UserID"`
-	Category   *Category `gorm:"foreignKey:CategoryID"`
-	Tags       []Tag     `gorm:"many2many:journal_entry_tags;joinForeignKey:entry_id;joinReferences:tag_id"`
+	UserID        uint `gorm:"not null"`
+	CategoryID    *uint
+	Title         string   `gorm:"not null;index:idx_entry_title,length:255"`
+	Content       string   `gorm:"type:text;not null"`
+	Mood          string   `gorm:"index:idx_entry_mood,length:50"`
+	MoodIntensity *uint8   // optional rating of the mood, 1 to 10
+	Sentiment     *float64 // -1 to 1, estimated from Content
+	WordCount     uint
+	// CharacterCount, SentenceCount, ReadingSeconds and Readability are
+	// measured from Content with its Markdown stripped
+	CharacterCount uint
+	SentenceCount  uint
+	ReadingSeconds uint
+	Readability    *float64 // Flesch reading ease; nil for short or non-Latin text
+	// AnalyzedAt is when the fields above were last derived from Content;
+	// nil until the current analysis has run on the entry
+	AnalyzedAt    *time.Time `gorm:"index:idx_entry_analyzed"`
+	Version       uint       `gorm:"not null;default:1"`
+	IsDraft       bool       `gorm:"not null;default:false;index:idx_entry_draft"`
+	AutosavedAt   *time.Time
+	EntryDate     time.Time `gorm:"type:date;not null;index:idx_entry_date"`
+	EntryTime     *string   `gorm:"type:time"`
+	EntryTimezone string    `gorm:"size:64;not null;default:'UTC'"`
+	// Latitude and Longitude are WGS 84 degrees and are either both set or
+	// both nil; LocationAccuracy is their uncertainty in meters
+	Latitude         *float64
+	Longitude        *float64
+	PlaceName        string `gorm:"size:255;not null;default:''"`
+	LocationAccuracy *float64
+	User             User         `gorm:"foreignKey:UserID"`
+	Category         *Category    `gorm:"foreignKey:CategoryID"`
+	Tags             []Tag        `gorm:"many2many:journal_entry_tags;joinForeignKey:entry_id;joinReferences:tag_id"`
+	Shares           []EntryShare `gorm:"foreignKey:EntryID"`
+}
+
+// EntryShare gives another user read-only access to an entry
+type EntryShare struct {
+	EntryID   uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"primaryKey;index:idx_entry_share_user"`
+	CreatedAt time.Time
+	User      User `gorm:"foreignKey:UserID"`
 }
 
+// EntryInvite is a share with an email address that has no account yet. It
+// becomes an EntryShare when someone registers with that email.
+type EntryInvite struct {
+	EntryID   uint   `gorm:"primaryKey"`
+	Email     string `gorm:"primaryKey;size:255;index:idx_entry_invite_email"`
+	CreatedAt time.Time
+}
+
+// Attachment is a file uploaded to an entry. The file itself lives in the
+// blob store under StorageKey; UserID is the entry owner's, whose quota the
+// file counts against.
+type Attachment struct {
+	gorm.Model
+	EntryID     uint         `gorm:"not null;index:idx_attachment_entry"`
+	UserID      uint         `gorm:"not null;index:idx_attachment_user"`
+	FileName    string       `gorm:"size:255;not null"`
+	ContentType string       `gorm:"size:100;not null"`
+	Size        int64        `gorm:"not null"`
+	StorageKey  string       `gorm:"size:255;not null;uniqueIndex:idx_attachment_storage_key"`
+	Entry       JournalEntry `gorm:"foreignKey:EntryID"`
+	User        User         `gorm:"foreignKey:UserID"`
+}
+
+// Tag names may be hierarchical ("project/alpha"); ParentID points at the tag
+// for the enclosing path
 type Tag struct {
 	gorm.Model
-	UserID  uint           `gorm:"not null"`
-	Name    string         `gorm:"not null;index:idx_tag_name,length:100"`
-	User    User           `gorm:"foreignKey:UserID"`
-	Entries []JournalEntry `gorm:"many2many:journal_entry_tags;"`
+	UserID   uint           `gorm:"not null"`
+	ParentID *uint          `gorm:"index:idx_tag_parent"`
+	Name     string         `gorm:"not null;index:idx_tag_name,length:100"`
+	User     User           `gorm:"foreignKey:UserID"`
+	Children []Tag          `gorm:"foreignKey:ParentID"`
+	Entries  []JournalEntry `gorm:"many2many:journal_entry_tags;"`
+}
+
+// Goal is a writing target such as 500 words a day or 5 entries a week.
+// Weekdays (e.g. "mon,tue,wed,thu,fri") limits a daily goal to those days.
+type Goal struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index:idx_goal_user"`
+	Name     string `gorm:"size:100;not null"`
+	Metric   string `gorm:"size:20;not null"`
+	Period   string `gorm:"size:20;not null"`
+	Target   uint   `gorm:"not null"`
+	Weekdays string `gorm:"size:27"`
+	User     User   `gorm:"foreignKey:UserID"`
+}
+
+// Mood is one entry of a user's mood vocabulary. Entries store the mood's
+// name; Valence places it from -2 (negative) to 2 (positive) for averaging.
+type Mood struct {
+	gorm.Model
+	UserID  uint   `gorm:"not null;uniqueIndex:idx_mood_user_name"`
+	Name    string `gorm:"size:50;not null;uniqueIndex:idx_mood_user_name"`
+	Emoji   string `gorm:"size:16"`
+	Color   string `gorm:"size:7;not null"`
+	Valence int    `gorm:"not null;default:0"`
+	User    User   `gorm:"foreignKey:UserID"`
+}
+
+// DailyEntryStats aggregates a user's published entries per day, category and
+// mood. It is kept up to date as entries are written so stats never have to
+// scan journal_entries. CategoryID is 0 for uncategorized entries.
+type DailyEntryStats struct {
+	UserID     uint      `gorm:"primaryKey"`
+	EntryDate  time.Time `gorm:"primaryKey;type:date"`
+	CategoryID uint      `gorm:"primaryKey"`
+	Mood       string    `gorm:"primaryKey;size:100"`
+	Entries    int64     `gorm:"not null;default:0"`
+	Words      int64     `gorm:"not null;default:0"`
+	// SentimentSum adds up the sentiment of the SentimentEntries scored entries
+	SentimentSum     float64 `gorm:"not null;default:0"`
+	SentimentEntries int64   `gorm:"not null;default:0"`
+}
+
+func (DailyEntryStats) TableName() string {
+	return "daily_entry_stats"
 }
 
 type JournalEntryTag struct {
@@ -79,18 +192,76 @@ type UserPreferencesDTO struct {
 	DefaultView        string `json:"defaultView"`
 	DateFormat         string `json:"dateFormat"`
 	EmailNotifications bool   `json:"emailNotifications"`
+	Timezone           string `json:"timezone"`
+	HideLocation       bool   `json:"hideLocation"`
 }
 
 type JournalEntryDTO struct {
-	ID         uint      `json:"id"`
-	Title      string    `json:"title"`
-	Content    string    `json:"content"`
-	CategoryID *uint     `json:"categoryId"`
-	Mood       string    `json:"mood"`
-	WordCount  uint      `json:"wordCount"`
-	Tags       []TagDTO  `json:"tags"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	ID             uint              `json:"id"`
+	Title          string            `json:"title"`
+	Content        string            `json:"content"`
+	ContentHTML    string            `json:"contentHtml,omitempty"` // rendered Content, only with ?format=html
+	CategoryID     *uint             `json:"categoryId"`
+	Mood           string            `json:"mood"`
+	MoodIntensity  *uint8            `json:"moodIntensity"`
+	Sentiment      *float64          `json:"sentiment"`
+	SuggestedMood  string            `json:"suggestedMood,omitempty"` // offered when Mood is empty
+	WordCount      uint              `json:"wordCount"`
+	CharacterCount uint              `json:"characterCount"`
+	SentenceCount  uint              `json:"sentenceCount"`
+	ReadingSeconds uint              `json:"readingSeconds"`
+	Readability    *float64          `json:"readability"`
+	Version        uint              `json:"version"`
+	IsDraft        bool              `json:"isDraft"`
+	AutosavedAt    *time.Time        `json:"autosavedAt,omitempty"`
+	EntryDate      string            `json:"entryDate"`
+	EntryTime      *string           `json:"entryTime"`
+	EntryTimezone  string            `json:"entryTimezone"`
+	Location       *EntryLocationDTO `json:"location"` // nil when the entry has none or it is hidden
+	Tags           []TagDTO          `json:"tags"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	UpdatedAt      time.Time         `json:"updatedAt"`
+}
+
+// EntryLocationDTO is where an entry was written. Latitude and Longitude are
+// nil when only a place name was given.
+type EntryLocationDTO struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	PlaceName string   `json:"placeName"`
+	Accuracy  *float64 `json:"accuracy"` // meters
+}
+
+// GeoJSONFeatureCollectionDTO is the response of GET /api/entries/map
+type GeoJSONFeatureCollectionDTO struct {
+	Type     string              `json:"type"` // always "FeatureCollection"
+	Features []GeoJSONFeatureDTO `json:"features"`
+}
+
+// GeoJSONFeatureDTO is a single entry or a cluster of nearby entries. BBox
+// bounds the entries of a cluster as [west, south, east, north].
+type GeoJSONFeatureDTO struct {
+	Type       string                  `json:"type"` // always "Feature"
+	Geometry   GeoJSONPointDTO         `json:"geometry"`
+	Properties MapFeaturePropertiesDTO `json:"properties"`
+	BBox       []float64               `json:"bbox,omitempty"`
+}
+
+type GeoJSONPointDTO struct {
+	Type        string     `json:"type"`        // always "Point"
+	Coordinates [2]float64 `json:"coordinates"` // longitude, latitude
+}
+
+// MapFeaturePropertiesDTO describes a map feature. Clusters carry only the
+// number of entries in them; single entries their ID and summary.
+type MapFeaturePropertiesDTO struct {
+	Cluster    bool   `json:"cluster"`
+	PointCount int    `json:"pointCount"`
+	EntryID    uint   `json:"entryId,omitempty"`
+	Title      string `json:"title,omitempty"`
+	EntryDate  string `json:"entryDate,omitempty"`
+	PlaceName  string `json:"placeName,omitempty"`
+	Mood       string `json:"mood,omitempty"`
 }
 
 type TagDTO struct {
@@ -98,8 +269,231 @@ type TagDTO struct {
 	Name string `json:"name"`
 }
 
+type TagUsageDTO struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	ParentID   *uint      `json:"parentId"`
+	EntryCount int64      `json:"entryCount"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+type TagTreeDTO struct {
+	ID         uint         `json:"id"`
+	Name       string       `json:"name"`
+	Label      string       `json:"label"`
+	EntryCount int64        `json:"entryCount"`
+	TotalCount int64        `json:"totalCount"`
+	Children   []TagTreeDTO `json:"children"`
+}
+
+type TagSuggestionDTO struct {
+	ID     uint    `json:"id"`
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
 type CategoryDTO struct {
-	ID    uint   `json:"id"`
-	Name  string `json:"name"`
-	Color string `json:"color"`
+	ID       uint   `json:"id"`
+	ParentID *uint  `json:"parentId"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	Position int    `json:"position"`
+	Archived bool   `json:"archived"`
+}
+
+// EntryShareDTO is one email an entry has been shared with. Shares with
+// registered users and pending invites look the same, so the owner cannot
+// tell which emails have an account.
+type EntryShareDTO struct {
+	Email    string    `json:"email"`
+	SharedAt time.Time `json:"sharedAt"`
+}
+
+type AttachmentDTO struct {
+	ID          uint      `json:"id"`
+	EntryID     uint      `json:"entryId"`
+	FileName    string    `json:"fileName"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	URL         string    `json:"url"` // downloads the file
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// AttachmentUsageDTO reports how much of their attachment quota a user has
+// used, in bytes
+type AttachmentUsageDTO struct {
+	Used        int64 `json:"used"`
+	Quota       int64 `json:"quota"`
+	Attachments int64 `json:"attachments"`
+}
+
+type MoodCountDTO struct {
+	Mood  string `json:"mood"`
+	Count int64  `json:"count"`
+}
+
+type MonthlyTrendDTO struct {
+	Month   string `json:"month"` // YYYY-MM
+	Entries int64  `json:"entries"`
+	Words   int64  `json:"words"`
+}
+
+// SliceStatsDTO summarizes the published entries in one category or tag
+type SliceStatsDTO struct {
+	EntryCount       int64             `json:"entryCount"`
+	TotalWords       int64             `json:"totalWords"`
+	AvgWordsPerEntry float64           `json:"avgWordsPerEntry"`
+	FirstEntryDate   *string           `json:"firstEntryDate"`
+	LastEntryDate    *string           `json:"lastEntryDate"`
+	MoodDistribution []MoodCountDTO    `json:"moodDistribution"`
+	MonthlyTrend     []MonthlyTrendDTO `json:"monthlyTrend"`
+}
+
+type CategoryStatsDTO struct {
+	Category              CategoryDTO   `json:"category"`
+	IncludesSubcategories bool          `json:"includesSubcategories"`
+	Stats                 SliceStatsDTO `json:"stats"`
+}
+
+type TagStatsDTO struct {
+	Tag             TagDTO        `json:"tag"`
+	IncludesSubtags bool          `json:"includesSubtags"`
+	Stats           SliceStatsDTO `json:"stats"`
+}
+
+type CategoryCountDTO struct {
+	CategoryID *uint  `json:"categoryId"`
+	Name       string `json:"name"`
+	Count      int64  `json:"count"`
+}
+
+type TimeSeriesBucketDTO struct {
+	Start      string             `json:"start"` // first day of the bucket, YYYY-MM-DD
+	Entries    int64              `json:"entries"`
+	Words      int64              `json:"words"`
+	Moods      []MoodCountDTO     `json:"moods"`
+	Categories []CategoryCountDTO `json:"categories"`
+	// AverageSentiment is nil when no entry in the bucket has been scored
+	AverageSentiment *float64 `json:"averageSentiment"`
+}
+
+type TimeSeriesDTO struct {
+	Interval string                `json:"interval"`
+	From     string                `json:"from"`
+	To       string                `json:"to"`
+	Buckets  []TimeSeriesBucketDTO `json:"buckets"`
+}
+
+// MoodSummaryDTO describes the moods of the entries in one trend bucket or on
+// one weekday. AverageScore is on a -2 (negative) to 2 (positive) scale and is
+// nil when none of the moods has a known score.
+type MoodSummaryDTO struct {
+	Start        string         `json:"start,omitempty"`
+	Weekday      string         `json:"weekday,omitempty"`
+	Entries      int64          `json:"entries"`
+	AverageScore *float64       `json:"averageScore"`
+	TopMood      string         `json:"topMood"`
+	Moods        []MoodCountDTO `json:"moods"`
+}
+
+// MoodCorrelationDTO compares how often entries with a tag or category have a
+// mood against how often all entries do. Lift 0.4 means 40% more often.
+type MoodCorrelationDTO struct {
+	ID            uint    `json:"id"`
+	Name          string  `json:"name"`
+	Mood          string  `json:"mood"`
+	Entries       int64   `json:"entries"`
+	MoodEntries   int64   `json:"moodEntries"`
+	Share         float64 `json:"share"`
+	BaselineShare float64 `json:"baselineShare"`
+	Lift          float64 `json:"lift"`
+}
+
+type MoodStatsDTO struct {
+	Interval   string               `json:"interval"`
+	From       string               `json:"from"`
+	To         string               `json:"to"`
+	Entries    int64                `json:"entries"`
+	Trend      []MoodSummaryDTO     `json:"trend"`
+	Weekdays   []MoodSummaryDTO     `json:"weekdays"`
+	Tags       []MoodCorrelationDTO `json:"tags"`
+	Categories []MoodCorrelationDTO `json:"categories"`
+}
+
+type CalendarDayDTO struct {
+	Date    string `json:"date"`
+	Entries int64  `json:"entries"`
+	Words   int64  `json:"words"`
+}
+
+type CalendarDTO struct {
+	Year          int              `json:"year"`
+	TotalEntries  int64            `json:"totalEntries"`
+	ActiveDays    int              `json:"activeDays"`
+	CurrentStreak int              `json:"currentStreak"`
+	LongestStreak int              `json:"longestStreak"`
+	Days          []CalendarDayDTO `json:"days"`
+}
+
+type MoodDTO struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Emoji   string `json:"emoji"`
+	Color   string `json:"color"`
+	Valence int    `json:"valence"`
+	Entries int64  `json:"entries"`
+}
+
+type GoalDTO struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Metric    string    `json:"metric"`
+	Period    string    `json:"period"`
+	Target    uint      `json:"target"`
+	Weekdays  []string  `json:"weekdays"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type GoalPeriodDTO struct {
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Value      int64   `json:"value"`
+	Target     uint    `json:"target"`
+	Completion float64 `json:"completion"`
+	Achieved   bool    `json:"achieved"`
+}
+
+type GoalProgressDTO struct {
+	Goal    GoalDTO         `json:"goal"`
+	Current GoalPeriodDTO   `json:"current"`
+	History []GoalPeriodDTO `json:"history"`
+	// Streak counts the achieved periods in a row within the reported
+	// history, plus the current one once it is achieved
+	Streak int `json:"streak"`
+}
+
+// EntryStatsDTO is the response of GET /api/entries/stats. The distribution
+// items keep the capitalized field names clients have always received.
+type EntryStatsDTO struct {
+	TotalEntries         int64                     `json:"totalEntries"`
+	TotalWords           int64                     `json:"totalWords"`
+	AvgWordsPerEntry     float64                   `json:"avgWordsPerEntry"`
+	AverageSentiment     *float64                  `json:"averageSentiment"`
+	CategoryCount        int64                     `json:"categoryCount"`
+	TagCount             int64                     `json:"tagCount"`
+	CurrentStreak        int                       `json:"currentStreak"`
+	LongestStreak        int                       `json:"longestStreak"`
+	MoodDistribution     []MoodDistributionDTO     `json:"moodDistribution"`
+	CategoryDistribution []CategoryDistributionDTO `json:"categoryDistribution"`
+}
+
+type MoodDistributionDTO struct {
+	Mood  string `json:"Mood"`
+	Count int64  `json:"Count"`
+}
+
+type CategoryDistributionDTO struct {
+	Category string `json:"Category"`
+	Count    int64  `json:"Count"`
 }
@@ -0,0 +1,39 @@
+package models
+
+// The methods below let entries, categories, tags, goals and moods be checked
+// by the policy package
+
+func (e *JournalEntry) ResourceName() string { return "entry" }
+func (e *JournalEntry) ResourceID() uint     { return e.ID }
+func (e *JournalEntry) OwnerID() uint        { return e.UserID }
+
+// SharedWith reports whether userID is one of the entry's readers. Shares
+// must have been preloaded. Drafts are not shared until they are published,
+// so readers are told they do not exist.
+func (e *JournalEntry) SharedWith(userID uint) bool {
+	if e.IsDraft {
+		return false
+	}
+	for _, share := range e.Shares {
+		if share.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Category) ResourceName() string { return "category" }
+func (c *Category) ResourceID() uint     { return c.ID }
+func (c *Category) OwnerID() uint        { return c.UserID }
+
+func (t *Tag) ResourceName() string { return "tag" }
+func (t *Tag) ResourceID() uint     { return t.ID }
+func (t *Tag) OwnerID() uint        { return t.UserID }
+
+func (g *Goal) ResourceName() string { return "goal" }
+func (g *Goal) ResourceID() uint     { return g.ID }
+func (g *Goal) OwnerID() uint        { return g.UserID }
+
+func (m *Mood) ResourceName() string { return "mood" }
+func (m *Mood) ResourceID() uint     { return m.ID }
+func (m *Mood) OwnerID() uint        { return m.UserID }
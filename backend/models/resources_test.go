@@ -0,0 +1,58 @@
+package models
+
+import (
+	"testing"
+
+	"journal/policy"
+)
+
+func TestEntryPolicy(t *testing.T) {
+	const owner, reader, stranger, admin = 1, 2, 3, 4
+	published := &JournalEntry{UserID: owner, Shares: []EntryShare{{EntryID: 10, UserID: reader}}}
+	published.ID = 10
+	draft := &JournalEntry{UserID: owner, IsDraft: true, Shares: []EntryShare{{EntryID: 11, UserID: reader}}}
+	draft.ID = 11
+
+	type outcome int
+	const (
+		allowed outcome = iota
+		notFound
+		forbidden
+	)
+
+	tests := []struct {
+		name      string
+		entry     *JournalEntry
+		actor     policy.Actor
+		wantRead  outcome
+		wantWrite outcome
+	}{
+		{"owner of published entry", published, policy.Actor{UserID: owner, Role: policy.RoleUser}, allowed, allowed},
+		{"reader of published entry", published, policy.Actor{UserID: reader, Role: policy.RoleUser}, allowed, forbidden},
+		{"stranger to published entry", published, policy.Actor{UserID: stranger, Role: policy.RoleUser}, notFound, notFound},
+		{"admin of published entry", published, policy.Actor{UserID: admin, Role: policy.RoleAdmin}, allowed, allowed},
+		{"owner of draft", draft, policy.Actor{UserID: owner, Role: policy.RoleUser}, allowed, allowed},
+		{"reader of draft", draft, policy.Actor{UserID: reader, Role: policy.RoleUser}, notFound, notFound},
+		{"stranger to draft", draft, policy.Actor{UserID: stranger, Role: policy.RoleUser}, notFound, notFound},
+	}
+
+	check := func(err error) outcome {
+		switch {
+		case err == nil:
+			return allowed
+		case policy.IsNotFound(err):
+			return notFound
+		default:
+			return forbidden
+		}
+	}
+
+	for _, tt := range tests {
+		if got := check(policy.CanRead(tt.actor, tt.entry)); got != tt.wantRead {
+			t.Errorf("%s: CanRead outcome %d, want %d", tt.name, got, tt.wantRead)
+		}
+		if got := check(policy.CanWrite(tt.actor, tt.entry)); got != tt.wantWrite {
+			t.Errorf("%s: CanWrite outcome %d, want %d", tt.name, got, tt.wantWrite)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package blobstore keeps opaque files, such as entry attachments, by key.
+// Keys are slash-separated paths chosen by the caller.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned by Get for a key that has no blob
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys that are empty or try to escape the store
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore stores blobs. Deleting a key that has no blob is not an error.
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// checkKey rejects keys that are empty, absolute or contain path traversal
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,612 @@
+package markdown
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	thematicBreakBlock
+	codeBlock
+	quoteBlock
+	listBlock
+	itemBlock
+	tableBlock
+)
+
+// block is a block-level element. Paragraphs, headings and table cells keep
+// their inline source, which is parsed when the document is rendered.
+type block struct {
+	kind     blockKind
+	text     string // inline source, or the literal text of a code block
+	level    int    // heading level
+	info     string // code block language
+	ordered  bool
+	start    int
+	tight    bool
+	task     bool
+	checked  bool
+	align    []string
+	header   []string
+	rows     [][]string
+	children []*block
+}
+
+var (
+	atxHeadingPattern     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ ]+(.*))?$`)
+	setextPattern         = regexp.MustCompile(`^ {0,3}(=+|-+)[ ]*$`)
+	thematicBreakPattern  = regexp.MustCompile(`^ {0,3}(?:(?:\*[ ]*){3,}|(?:-[ ]*){3,}|(?:_[ ]*){3,})$`)
+	fencePattern          = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+	quotePattern          = regexp.MustCompile(`^ {0,3}> ?`)
+	listItemPattern       = regexp.MustCompile(`^( {0,3})([-+*]|[0-9]{1,9}[.)])(?:( +)(.*))?$`)
+	taskPattern           = regexp.MustCompile(`^\[([ xX])\] +`)
+	tableDelimiterPattern = regexp.MustCompile(`^ {0,3}\|?[ ]*:?-+:?[ ]*(?:\|[ ]*:?-+:?[ ]*)*\|?[ ]*$`)
+	footnoteDefPattern    = regexp.MustCompile(`^ {0,3}\[\^([^\]\s]+)\]:[ ]*(.*)$`)
+)
+
+type blockParser struct {
+	doc   *document
+	depth int
+	// loose is set by parse when blank lines separate the blocks it parsed
+	loose bool
+}
+
+// parse splits lines into blocks, recording link reference and footnote
+// definitions on the document as it goes
+func (p *blockParser) parse(lines []string) []*block {
+	var blocks []*block
+	blank, content, loose := false, false, false
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		nested := p.depth < maxNesting
+		if isBlank(line) {
+			blank = true
+			i++
+			continue
+		}
+		if blank && content {
+			loose = true
+		}
+		blank, content = false, true
+
+		var b *block
+		switch {
+		case indentation(line) >= 4:
+			b, i = parseIndentedCode(lines, i)
+		case isFence(line):
+			b, i = parseFencedCode(lines, i)
+		case atxHeadingPattern.MatchString(line):
+			b, i = parseATXHeading(line), i+1
+		case thematicBreakPattern.MatchString(line):
+			b, i = &block{kind: thematicBreakBlock}, i+1
+		case nested && quotePattern.MatchString(line):
+			b, i = p.parseQuote(lines, i)
+		case nested && listItemPattern.MatchString(line):
+			b, i = p.parseList(lines, i)
+		case p.isTableStart(lines, i):
+			b, i = p.parseTable(lines, i)
+		case nested && footnoteDefPattern.MatchString(line):
+			i = p.parseFootnoteDef(lines, i)
+			continue
+		default:
+			// A paragraph made only of link reference definitions has no block
+			if b, i = p.parseParagraph(lines, i); b == nil {
+				continue
+			}
+		}
+		blocks = append(blocks, b)
+	}
+	p.loose = loose
+	return blocks
+}
+
+// interrupts reports whether lines[i] starts a block that ends a paragraph
+func (p *blockParser) interrupts(lines []string, i int) bool {
+	line := lines[i]
+	if indentation(line) >= 4 {
+		return false
+	}
+	if isFence(line) || atxHeadingPattern.MatchString(line) || thematicBreakPattern.MatchString(line) || quotePattern.MatchString(line) {
+		return true
+	}
+	// Only list items with content can interrupt, and ordered ones only when
+	// they start at 1, so a line like "2014. What a year." is left alone
+	if m, ok := parseListMarker(line); ok && m.content != "" {
+		return !m.ordered || m.start == 1
+	}
+	return false
+}
+
+// parseParagraph parses a paragraph, or a setext heading, after recording
+// the link reference definitions it starts with. It returns a nil block when
+// nothing but definitions is left.
+func (p *blockParser) parseParagraph(lines []string, i int) (*block, int) {
+	text := []string{strings.TrimLeft(lines[i], " ")}
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			break
+		}
+		if m := setextPattern.FindStringSubmatch(line); m != nil {
+			// An underline after nothing but definitions is paragraph text
+			if text = p.parseLinkDefs(text); len(text) > 0 {
+				level := 2
+				if m[1][0] == '=' {
+					level = 1
+				}
+				return &block{kind: headingBlock, level: level, text: joinLines(text)}, i + 1
+			}
+		}
+		if p.interrupts(lines, i) || p.isTableStart(lines, i) {
+			break
+		}
+		text = append(text, strings.TrimLeft(line, " "))
+	}
+
+	if text = p.parseLinkDefs(text); len(text) == 0 {
+		return nil, i
+	}
+	return &block{kind: paragraphBlock, text: joinLines(text)}, i
+}
+
+func parseATXHeading(line string) *block {
+	m := atxHeadingPattern.FindStringSubmatch(line)
+	text := strings.TrimSpace(m[2])
+
+	// Drop an optional closing sequence of #s, which must follow a space
+	if trimmed := strings.TrimRight(text, "#"); trimmed == "" {
+		text = ""
+	} else if len(trimmed) < len(text) && strings.HasSuffix(trimmed, " ") {
+		text = strings.TrimSpace(trimmed)
+	}
+	return &block{kind: headingBlock, level: len(m[1]), text: text}
+}
+
+// parseIndentedCode parses indented code, leaving the blank lines after it
+// to the caller
+func parseIndentedCode(lines []string, i int) (*block, int) {
+	var code []string
+	end := i
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) {
+			code = append(code, trimIndent(line, 4))
+			continue
+		}
+		if indentation(line) < 4 {
+			break
+		}
+		code = append(code, line[4:])
+		end = i + 1
+	}
+	code = code[:len(code)-(i-end)]
+	return &block{kind: codeBlock, text: strings.Join(code, "\n") + "\n"}, end
+}
+
+func isFence(line string) bool {
+	m := fencePattern.FindStringSubmatch(line)
+	// Backtick fences cannot have backticks in their info string, or inline
+	// code at the start of a line would open a block
+	return m != nil && !(m[2][0] == '`' && strings.Contains(m[3], "`"))
+}
+
+func parseFencedCode(lines []string, i int) (*block, int) {
+	m := fencePattern.FindStringSubmatch(lines[i])
+	indent, fence := len(m[1]), m[2]
+	info := strings.Fields(unescape(m[3]))
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		if isClosingFence(line, fence) {
+			i++
+			break
+		}
+		code = append(code, trimIndent(line, indent))
+	}
+
+	b := &block{kind: codeBlock}
+	if len(info) > 0 {
+		b.info = info[0]
+	}
+	if len(code) > 0 {
+		b.text = strings.Join(code, "\n") + "\n"
+	}
+	return b, i
+}
+
+// isClosingFence reports whether line closes a block opened by fence: the
+// same character, at least as many times, and nothing after it
+func isClosingFence(line, fence string) bool {
+	if indentation(line) >= 4 {
+		return false
+	}
+	line = strings.TrimSpace(line)
+	return len(line) >= len(fence) && strings.Trim(line, fence[:1]) == ""
+}
+
+func (p *blockParser) parseQuote(lines []string, i int) (*block, int) {
+	var inner []string
+	var state paragraphState
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if marker := quotePattern.FindString(line); marker != "" {
+			inner = append(inner, line[len(marker):])
+			state.add(line[len(marker):])
+			continue
+		}
+		// A paragraph inside the quote can carry on without the marker
+		if !isBlank(line) && state.open && !p.interrupts(lines, i) {
+			inner = append(inner, lazyLine(line))
+			continue
+		}
+		break
+	}
+
+	p.depth++
+	children := p.parse(inner)
+	p.depth--
+	return &block{kind: quoteBlock, children: children}, i
+}
+
+// listMarker is the start of a list item
+type listMarker struct {
+	ordered bool
+	char    byte // bullet character, or the delimiter after an ordered number
+	start   int
+	// offset is the column the item's content starts at; continuation lines
+	// must be indented at least this far
+	offset  int
+	content string
+}
+
+func parseListMarker(line string) (listMarker, bool) {
+	g := listItemPattern.FindStringSubmatch(line)
+	if g == nil {
+		return listMarker{}, false
+	}
+
+	marker := g[2]
+	m := listMarker{char: marker[len(marker)-1]}
+	if len(marker) > 1 {
+		m.ordered = true
+		m.start, _ = strconv.Atoi(marker[:len(marker)-1])
+	}
+
+	width, spaces := len(g[1])+len(marker), len(g[3])
+	switch {
+	case strings.TrimSpace(g[4]) == "":
+		m.offset = width + 1
+	case spaces > 4:
+		// The content is indented code, which keeps all but one of the spaces
+		m.offset = width + 1
+		m.content = strings.Repeat(" ", spaces-1) + g[4]
+	default:
+		m.offset = width + spaces
+		m.content = g[4]
+	}
+	return m, true
+}
+
+func (p *blockParser) parseList(lines []string, i int) (*block, int) {
+	first, _ := parseListMarker(lines[i])
+	list := &block{kind: listBlock, ordered: first.ordered, start: first.start, tight: true}
+
+	p.depth++
+	defer func() { p.depth-- }()
+
+	// end is where the list stops, before the blank lines after its last item
+	end := i
+	for i < len(lines) {
+		m, ok := parseListMarker(lines[i])
+		if !ok || m.ordered != first.ordered || m.char != first.char || thematicBreakPattern.MatchString(lines[i]) {
+			break
+		}
+
+		item := &block{kind: itemBlock}
+		content := m.content
+		if t := taskPattern.FindStringSubmatch(content); t != nil {
+			item.task = true
+			item.checked = t[1] != " "
+			content = content[len(t[0]):]
+		}
+
+		itemLines := []string{content}
+		var state paragraphState
+		state.add(content)
+		j := i + 1
+		// An item can start with at most one blank line, so an empty marker
+		// followed by one is an empty item
+		if content != "" || j >= len(lines) || !isBlank(lines[j]) {
+			for ; j < len(lines); j++ {
+				line := lines[j]
+				if isBlank(line) {
+					itemLines = append(itemLines, "")
+					state.add("")
+					continue
+				}
+				if indentation(line) >= m.offset {
+					itemLines = append(itemLines, line[m.offset:])
+					state.add(line[m.offset:])
+					continue
+				}
+				// Any list marker outdented from the content starts a new item
+				if _, ok := parseListMarker(line); ok {
+					break
+				}
+				// Lazy continuation of the item's paragraph
+				if state.open && !p.interrupts(lines, j) && !p.isTableStart(lines, j) {
+					itemLines = append(itemLines, lazyLine(line))
+					continue
+				}
+				break
+			}
+		} else {
+			for ; j < len(lines) && isBlank(lines[j]); j++ {
+				itemLines = append(itemLines, "")
+			}
+		}
+
+		trailing := 0
+		for len(itemLines) > 1 && itemLines[len(itemLines)-1] == "" {
+			itemLines = itemLines[:len(itemLines)-1]
+			trailing++
+		}
+
+		item.children = p.parse(itemLines)
+		// A list is loose when blank lines separate its items or the blocks
+		// directly inside an item
+		if p.loose {
+			list.tight = false
+		}
+		if trailing > 0 && j < len(lines) {
+			if next, ok := parseListMarker(lines[j]); ok && next.ordered == first.ordered && next.char == first.char && !thematicBreakPattern.MatchString(lines[j]) {
+				list.tight = false
+			}
+		}
+
+		list.children = append(list.children, item)
+		i, end = j, j-trailing
+	}
+	return list, end
+}
+
+func (p *blockParser) isTableStart(lines []string, i int) bool {
+	if i+1 >= len(lines) || indentation(lines[i]) >= 4 || !strings.Contains(lines[i], "|") {
+		return false
+	}
+	if !tableDelimiterPattern.MatchString(lines[i+1]) {
+		return false
+	}
+	return len(splitTableRow(lines[i])) == len(splitTableRow(lines[i+1]))
+}
+
+func (p *blockParser) parseTable(lines []string, i int) (*block, int) {
+	table := &block{kind: tableBlock, header: splitTableRow(lines[i])}
+	for _, cell := range splitTableRow(lines[i+1]) {
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			table.align = append(table.align, "center")
+		case left:
+			table.align = append(table.align, "left")
+		case right:
+			table.align = append(table.align, "right")
+		default:
+			table.align = append(table.align, "")
+		}
+	}
+
+	for i += 2; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) || p.interrupts(lines, i) {
+			break
+		}
+		// Rows are padded or cut to the header's width
+		cells := splitTableRow(line)
+		row := make([]string, len(table.header))
+		copy(row, cells)
+		table.rows = append(table.rows, row)
+	}
+	return table, i
+}
+
+// splitTableRow splits a row into trimmed cells on pipes that are not
+// escaped, ignoring a leading and trailing pipe
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// parseFootnoteDef records a footnote definition, whose content continues on
+// lines indented by four spaces, and returns the line after it
+func (p *blockParser) parseFootnoteDef(lines []string, i int) int {
+	m := footnoteDefPattern.FindStringSubmatch(lines[i])
+	body := []string{m[2]}
+	var state paragraphState
+	state.add(m[2])
+
+	j := i + 1
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if isBlank(line) {
+			body = append(body, "")
+			state.add("")
+			continue
+		}
+		if indentation(line) >= 4 {
+			body = append(body, line[4:])
+			state.add(line[4:])
+			continue
+		}
+		if state.open && !p.interrupts(lines, j) && !footnoteDefPattern.MatchString(line) {
+			body = append(body, lazyLine(line))
+			continue
+		}
+		break
+	}
+
+	// The first definition of a label wins
+	label := normalizeLabel(m[1])
+	if _, exists := p.doc.footnotes[label]; !exists {
+		p.depth++
+		p.doc.footnotes[label] = &footnote{blocks: p.parse(body)}
+		p.depth--
+	}
+	return j
+}
+
+// parseLinkDefs records the link reference definitions at the start of a
+// paragraph's lines and returns the lines after them
+func (p *blockParser) parseLinkDefs(lines []string) []string {
+	src := strings.Join(lines, "\n")
+	pos, consumed := 0, 0
+	for {
+		end, ok := p.parseLinkDef(src, pos)
+		if !ok {
+			break
+		}
+		consumed += strings.Count(src[pos:end], "\n")
+		if end == len(src) {
+			return nil
+		}
+		pos = end
+	}
+	return lines[consumed:]
+}
+
+// parseLinkDef records the link reference definition starting at pos, which
+// may span lines, and returns the offset of the line after it
+func (p *blockParser) parseLinkDef(src string, pos int) (int, bool) {
+	label, i, ok := scanLinkLabel(src, pos)
+	if !ok || i >= len(src) || src[i] != ':' || normalizeLabel(label) == "" {
+		return 0, false
+	}
+
+	i = skipWhitespace(src, i+1)
+	dest, i, ok := parseDestination(src, i)
+	if !ok || (dest == "" && src[i-1] != '>') {
+		return 0, false
+	}
+	// Without a title the definition ends with the destination's line
+	end, endsLine := lineEnd(src, i)
+	if i < len(src) && !endsLine && src[i] != ' ' && src[i] != '\t' {
+		return 0, false
+	}
+
+	title := ""
+	if k := skipWhitespace(src, i); k > i && k < len(src) && strings.IndexByte(`"'(`, src[k]) >= 0 {
+		if t, after, ok := parseTitle(src, k, nil); ok {
+			if titleEnd, ok := lineEnd(src, after); ok {
+				title, end, endsLine = t, titleEnd, true
+			}
+		}
+	}
+	if !endsLine {
+		return 0, false
+	}
+
+	// The first definition of a label wins
+	key := normalizeLabel(label)
+	if _, exists := p.doc.refs[key]; !exists {
+		p.doc.refs[key] = linkRef{url: unescape(dest), title: unescape(title)}
+	}
+	return end, true
+}
+
+// lineEnd reports whether only spaces follow i on its line, and returns the
+// offset of the next line
+func lineEnd(src string, i int) (int, bool) {
+	for ; i < len(src); i++ {
+		switch src[i] {
+		case '\n':
+			return i + 1, true
+		case ' ', '\t':
+		default:
+			return 0, false
+		}
+	}
+	return len(src), true
+}
+
+// paragraphState follows the lines of a container to tell whether they end
+// in an open paragraph, which lines without the container's marker may
+// lazily continue
+type paragraphState struct {
+	fence string // the fence of an open code block
+	open  bool
+}
+
+func (s *paragraphState) add(line string) {
+	switch {
+	case s.fence != "":
+		if isClosingFence(line, s.fence) {
+			s.fence = ""
+		}
+	case isBlank(line):
+		s.open = false
+	case indentation(line) >= 4:
+		// Indented code, unless it carries on a paragraph
+	case isFence(line):
+		s.fence = fencePattern.FindStringSubmatch(line)[2]
+		s.open = false
+	case atxHeadingPattern.MatchString(line) || thematicBreakPattern.MatchString(line):
+		s.open = false
+	case s.open && setextPattern.MatchString(line):
+		s.open = false
+	default:
+		s.open = true
+	}
+}
+
+// lazyLine indents a lazy continuation line so the container's content reads
+// it as paragraph text, never as the start of a block or a setext underline
+func lazyLine(line string) string {
+	return "    " + strings.TrimLeft(line, " ")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// trimIndent removes up to n leading spaces
+func trimIndent(line string, n int) string {
+	if indent := indentation(line); indent < n {
+		n = indent
+	}
+	return line[n:]
+}
+
+// joinLines joins paragraph lines, dropping trailing spaces that would
+// otherwise read as a hard line break at the very end
+func joinLines(lines []string) string {
+	return strings.TrimRight(strings.Join(lines, "\n"), " ")
+}
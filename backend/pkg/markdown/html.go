@@ -0,0 +1,301 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// allowedSchemes are the URL schemes links may use. Anything else, such as
+// javascript: or data:, is dropped along with the link.
+var allowedSchemes = map[string]bool{"http": true, "https": true, "mailto": true}
+
+// schemePattern is what browsers read as a URL scheme. Text before a colon
+// that does not match, as in "foo):", makes a relative URL.
+var schemePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.\-]*$`)
+
+type renderer struct {
+	doc *document
+	out *strings.Builder
+}
+
+func (r *renderer) document() {
+	r.blocks(r.doc.blocks, false)
+
+	if len(r.doc.used) == 0 {
+		return
+	}
+	r.out.WriteString("<section class=\"footnotes\">\n<ol>\n")
+	// Footnotes can reference further footnotes, which are appended as they go
+	for i := 0; i < len(r.doc.used); i++ {
+		fn := r.doc.used[i]
+		content := r.capture(func() { r.blocks(fn.blocks, false) })
+		backref := fmt.Sprintf(` <a href="#fnref-%d" class="footnote-backref">↩</a>`, fn.index)
+		if strings.HasSuffix(content, "</p>\n") {
+			content = strings.TrimSuffix(content, "</p>\n") + backref + "</p>\n"
+		} else {
+			content += backref + "\n"
+		}
+		fmt.Fprintf(r.out, "<li id=\"fn-%d\">\n%s</li>\n", fn.index, content)
+	}
+	r.out.WriteString("</ol>\n</section>\n")
+}
+
+// capture returns what write renders instead of adding it to the output
+func (r *renderer) capture(write func()) string {
+	out := r.out
+	r.out = &strings.Builder{}
+	write()
+	captured := r.out.String()
+	r.out = out
+	return captured
+}
+
+// blocks renders a run of blocks. In tight lists paragraphs are rendered
+// without <p> tags.
+func (r *renderer) blocks(blocks []*block, tight bool) {
+	for _, b := range blocks {
+		r.block(b, tight)
+	}
+}
+
+func (r *renderer) block(b *block, tight bool) {
+	switch b.kind {
+	case paragraphBlock:
+		if tight {
+			r.inlines(r.doc.parseInlines(b.text), false)
+			r.out.WriteString("\n")
+			return
+		}
+		r.out.WriteString("<p>")
+		r.inlines(r.doc.parseInlines(b.text), false)
+		r.out.WriteString("</p>\n")
+
+	case headingBlock:
+		fmt.Fprintf(r.out, "<h%d>", b.level)
+		r.inlines(r.doc.parseInlines(b.text), false)
+		fmt.Fprintf(r.out, "</h%d>\n", b.level)
+
+	case thematicBreakBlock:
+		r.out.WriteString("<hr>\n")
+
+	case codeBlock:
+		r.out.WriteString("<pre><code")
+		if lang := languageClass(b.info); lang != "" {
+			fmt.Fprintf(r.out, ` class="language-%s"`, lang)
+		}
+		r.out.WriteString(">")
+		r.out.WriteString(html.EscapeString(b.text))
+		r.out.WriteString("</code></pre>\n")
+
+	case quoteBlock:
+		r.out.WriteString("<blockquote>\n")
+		r.blocks(b.children, false)
+		r.out.WriteString("</blockquote>\n")
+
+	case listBlock:
+		tag := "ul"
+		if b.ordered {
+			tag = "ol"
+		}
+		if b.ordered && b.start != 1 {
+			fmt.Fprintf(r.out, "<ol start=\"%d\">\n", b.start)
+		} else {
+			fmt.Fprintf(r.out, "<%s>\n", tag)
+		}
+		for _, item := range b.children {
+			r.item(item, b.tight)
+		}
+		fmt.Fprintf(r.out, "</%s>\n", tag)
+
+	case tableBlock:
+		r.table(b)
+	}
+}
+
+func (r *renderer) item(item *block, tight bool) {
+	if !item.task {
+		r.out.WriteString("<li>")
+	} else {
+		r.out.WriteString(`<li class="task-list-item"><input type="checkbox" disabled`)
+		if item.checked {
+			r.out.WriteString(" checked")
+		}
+		r.out.WriteString("> ")
+	}
+
+	content := r.capture(func() { r.blocks(item.children, tight) })
+	if !tight && content != "" {
+		r.out.WriteString("\n")
+	}
+	// Tight items end without a line break, as in "<li>one</li>"
+	if tight {
+		content = strings.TrimSuffix(content, "\n")
+	}
+	r.out.WriteString(content)
+	r.out.WriteString("</li>\n")
+}
+
+func (r *renderer) table(b *block) {
+	r.out.WriteString("<table>\n<thead>\n<tr>\n")
+	r.row("th", b.header, b.align)
+	r.out.WriteString("</tr>\n</thead>\n")
+	if len(b.rows) > 0 {
+		r.out.WriteString("<tbody>\n")
+		for _, row := range b.rows {
+			r.out.WriteString("<tr>\n")
+			r.row("td", row, b.align)
+			r.out.WriteString("</tr>\n")
+		}
+		r.out.WriteString("</tbody>\n")
+	}
+	r.out.WriteString("</table>\n")
+}
+
+func (r *renderer) row(tag string, cells, align []string) {
+	for i, cell := range cells {
+		if i < len(align) && align[i] != "" {
+			fmt.Fprintf(r.out, "<%s align=\"%s\">", tag, align[i])
+		} else {
+			fmt.Fprintf(r.out, "<%s>", tag)
+		}
+		r.inlines(r.doc.parseInlines(cell), false)
+		fmt.Fprintf(r.out, "</%s>\n", tag)
+	}
+}
+
+// inlines renders inline nodes. Inside a link, autolinks are rendered as
+// text so links never nest.
+func (r *renderer) inlines(nodes []*inline, inLink bool) {
+	for _, n := range nodes {
+		switch n.kind {
+		case textInline:
+			r.out.WriteString(html.EscapeString(n.text))
+		case softBreakInline:
+			r.out.WriteString("\n")
+		case hardBreakInline:
+			r.out.WriteString("<br>\n")
+		case codeInline:
+			r.out.WriteString("<code>" + html.EscapeString(n.text) + "</code>")
+		case emphasisInline:
+			r.wrap("em", n.children, inLink)
+		case strongInline:
+			r.wrap("strong", n.children, inLink)
+		case strikethroughInline:
+			r.wrap("del", n.children, inLink)
+		case linkInline:
+			r.link(n, inLink)
+		case imageInline:
+			r.image(n)
+		case footnoteRefInline:
+			fmt.Fprintf(r.out, `<sup class="footnote-ref"><a href="#fn-%d"`, n.footnote.index)
+			if n.firstRef {
+				fmt.Fprintf(r.out, ` id="fnref-%d"`, n.footnote.index)
+			}
+			fmt.Fprintf(r.out, ">%d</a></sup>", n.footnote.index)
+		}
+	}
+}
+
+func (r *renderer) wrap(tag string, children []*inline, inLink bool) {
+	r.out.WriteString("<" + tag + ">")
+	r.inlines(children, inLink)
+	r.out.WriteString("</" + tag + ">")
+}
+
+func (r *renderer) link(n *inline, inLink bool) {
+	url, ok := safeURL(n.url, false)
+	if inLink || !ok {
+		r.inlines(n.children, inLink)
+		return
+	}
+
+	r.out.WriteString(`<a href="` + html.EscapeString(url) + `"`)
+	if n.title != "" {
+		r.out.WriteString(` title="` + html.EscapeString(n.title) + `"`)
+	}
+	r.out.WriteString(` rel="nofollow noopener noreferrer">`)
+	r.inlines(n.children, true)
+	r.out.WriteString("</a>")
+}
+
+func (r *renderer) image(n *inline) {
+	alt := plainText(n.children)
+	url, ok := safeURL(n.url, true)
+	if !ok {
+		r.out.WriteString(html.EscapeString(alt))
+		return
+	}
+
+	r.out.WriteString(`<img src="` + html.EscapeString(url) + `" alt="` + html.EscapeString(alt) + `"`)
+	if n.title != "" {
+		r.out.WriteString(` title="` + html.EscapeString(n.title) + `"`)
+	}
+	r.out.WriteString(` loading="lazy">`)
+}
+
+// plainText flattens inline nodes to their text, for image alt text
+func plainText(nodes []*inline) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.kind {
+		case textInline, codeInline:
+			b.WriteString(n.text)
+		case softBreakInline, hardBreakInline:
+			b.WriteString(" ")
+		default:
+			b.WriteString(plainText(n.children))
+		}
+	}
+	return b.String()
+}
+
+// safeURL returns raw percent-encoded for use in an attribute, reporting
+// false when its scheme is not allowed. Images may not use mailto.
+func safeURL(raw string, image bool) (string, bool) {
+	// Browsers ignore control characters and spaces in a scheme, so
+	// "java\tscript:" must be caught as javascript:
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+
+	if i := strings.IndexAny(cleaned, ":/?#"); i >= 0 && cleaned[i] == ':' {
+		scheme := strings.ToLower(cleaned[:i])
+		if schemePattern.MatchString(scheme) && (!allowedSchemes[scheme] || (image && scheme == "mailto")) {
+			return "", false
+		}
+	}
+	return encodeURL(strings.TrimSpace(raw)), true
+}
+
+// encodeURL percent-encodes the bytes of url that cannot appear in one,
+// leaving existing escapes alone
+func encodeURL(url string) string {
+	const allowed = "-._~:/?#@!$&'()*+,;=%"
+	var b strings.Builder
+	for i := 0; i < len(url); i++ {
+		c := url[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(allowed, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// languageClass keeps only the characters of a code block's language that
+// are safe in a class name
+func languageClass(info string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_+#.", r) {
+			return r
+		}
+		return -1
+	}, info)
+}
@@ -0,0 +1,750 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type inlineKind int
+
+const (
+	textInline inlineKind = iota
+	softBreakInline
+	hardBreakInline
+	codeInline
+	emphasisInline
+	strongInline
+	strikethroughInline
+	linkInline
+	imageInline
+	footnoteRefInline
+)
+
+// inline is an inline element. While a paragraph is being parsed its
+// top-level elements form a linked list, so emphasis and links can wrap runs
+// of them without copying.
+type inline struct {
+	kind     inlineKind
+	text     string
+	url      string
+	title    string
+	autolink bool
+	footnote *footnote
+	firstRef bool // the first reference to footnote, which its backlink targets
+	children []*inline
+
+	prev, next *inline
+}
+
+// delimiter is a run of *, _ or ~ that may open or close emphasis
+type delimiter struct {
+	node     *inline
+	char     byte
+	count    int // characters not yet used for emphasis
+	length   int // characters in the original run
+	canOpen  bool
+	canClose bool
+
+	prev, next *delimiter
+}
+
+// openerKey groups delimiters for CommonMark's "openers bottom"
+// optimization: once no opener of a kind was found below a point, later
+// closers of the same kind need not look there again
+type openerKey struct {
+	char     byte
+	canOpen  bool
+	modThree int
+}
+
+// bracket is a [ or ![ that may open a link or image
+type bracket struct {
+	node   *inline
+	image  bool
+	pos    int        // source offset just after the bracket
+	bottom *delimiter // top of the delimiter stack when the bracket was found
+}
+
+var (
+	entityPattern           = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[A-Za-z][A-Za-z0-9]{1,31});`)
+	uriAutolinkPattern      = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.\-]{1,31}:[^<>\x00-\x20]*)>`)
+	emailAutolinkPattern    = regexp.MustCompile(`^<([A-Za-z0-9.!#$%&'*+/=?^_` + "`" + `{|}~\-]+@[A-Za-z0-9](?:[A-Za-z0-9\-]{0,61}[A-Za-z0-9])?(?:\.[A-Za-z0-9](?:[A-Za-z0-9\-]{0,61}[A-Za-z0-9])?)*)>`)
+	extendedAutolinkPattern = regexp.MustCompile(`^(?:[Hh][Tt][Tt][Pp][Ss]?://|[Ww][Ww][Ww]\.)[^\s<]*`)
+)
+
+// specialChars are the bytes that may start inline syntax
+const specialChars = "\\`*_~[]!<&\n"
+
+// maxLabelLength is the longest link label CommonMark allows
+const maxLabelLength = 999
+
+// maxLinkParens limits the nesting of parentheses in a link destination, as
+// CommonMark allows, so an unbalanced one cannot send every link after it
+// scanning to the end of the paragraph
+const maxLinkParens = 32
+
+type inlineParser struct {
+	doc        *document
+	src        string
+	pos        int
+	head, tail *inline
+	delims     *delimiter // top of the delimiter stack
+	brackets   []*bracket
+	// inactive is how many brackets at the bottom of the stack can no
+	// longer open links, because a link was found after them
+	inactive int
+	// lastRun maps the lengths of backtick runs to the offset of the last
+	// run of each length, once a code span has failed to close and the
+	// rest of the source has been scanned
+	lastRun map[int]int
+	// unclosed maps title closers to the offset from which the source is
+	// known to lack one
+	unclosed map[byte]int
+}
+
+// parseInlines parses the inline content of a paragraph, heading or table cell
+func (d *document) parseInlines(src string) []*inline {
+	p := &inlineParser{doc: d, src: src}
+	for p.pos < len(p.src) {
+		p.step()
+	}
+	p.processEmphasis(nil)
+	return p.list(p.head, nil)
+}
+
+func (p *inlineParser) step() {
+	switch c := p.src[p.pos]; c {
+	case '\\':
+		p.parseEscape()
+	case '`':
+		p.parseCodeSpan()
+	case '*', '_', '~':
+		p.parseDelimiterRun(c)
+	case '[':
+		if !p.parseFootnoteRef() {
+			p.openBracket(false)
+		}
+	case '!':
+		if p.pos+1 < len(p.src) && p.src[p.pos+1] == '[' {
+			p.openBracket(true)
+		} else {
+			p.pos++
+			p.text("!")
+		}
+	case ']':
+		p.closeBracket()
+	case '<':
+		p.parseAutolink()
+	case '&':
+		p.parseEntity()
+	case '\n':
+		p.parseNewline()
+	default:
+		if !p.parseExtendedAutolink() {
+			p.parseText()
+		}
+	}
+}
+
+func (p *inlineParser) parseText() {
+	start := p.pos
+	for p.pos++; p.pos < len(p.src); p.pos++ {
+		if strings.IndexByte(specialChars, p.src[p.pos]) >= 0 || p.extendedAutolink() != "" {
+			break
+		}
+	}
+	p.text(p.src[start:p.pos])
+}
+
+func (p *inlineParser) parseEscape() {
+	p.pos++
+	switch {
+	case p.pos < len(p.src) && p.src[p.pos] == '\n':
+		p.pos++
+		p.append(&inline{kind: hardBreakInline})
+		p.skipSpaces()
+	case p.pos < len(p.src) && isASCIIPunct(p.src[p.pos]):
+		p.text(p.src[p.pos : p.pos+1])
+		p.pos++
+	default:
+		p.text(`\`)
+	}
+}
+
+func (p *inlineParser) parseCodeSpan() {
+	start := p.pos
+	p.pos = skipByte(p.src, p.pos, '`')
+	ticks := p.pos - start
+
+	if p.lastRun != nil && p.lastRun[ticks] <= start {
+		p.text(p.src[start:p.pos])
+		return
+	}
+
+	runs := make(map[int]int)
+	for i := p.pos; i < len(p.src); {
+		if p.src[i] != '`' {
+			i++
+			continue
+		}
+		end := skipByte(p.src, i, '`')
+		runs[end-i] = i
+		if end-i == ticks {
+			code := strings.ReplaceAll(p.src[p.pos:i], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			p.append(&inline{kind: codeInline, text: code})
+			p.pos = end
+			return
+		}
+		i = end
+	}
+
+	// No closing run of the same length, so the backticks are literal. The
+	// runs seen on the way let later ones fail without scanning again.
+	p.lastRun = runs
+	p.text(p.src[start:p.pos])
+}
+
+func (p *inlineParser) parseDelimiterRun(c byte) {
+	start := p.pos
+	p.pos = skipByte(p.src, p.pos, c)
+	run := p.src[start:p.pos]
+
+	before, after := ' ', ' '
+	if start > 0 {
+		before, _ = utf8.DecodeLastRuneInString(p.src[:start])
+	}
+	if p.pos < len(p.src) {
+		after, _ = utf8.DecodeRuneInString(p.src[p.pos:])
+	}
+
+	leftFlanking := !unicode.IsSpace(after) && (!isPunct(after) || unicode.IsSpace(before) || isPunct(before))
+	rightFlanking := !unicode.IsSpace(before) && (!isPunct(before) || unicode.IsSpace(after) || isPunct(after))
+
+	d := &delimiter{char: c, count: len(run), length: len(run), canOpen: leftFlanking, canClose: rightFlanking}
+	if c == '_' {
+		// Underscores inside words, as in snake_case, are not emphasis
+		d.canOpen = leftFlanking && (!rightFlanking || isPunct(before))
+		d.canClose = rightFlanking && (!leftFlanking || isPunct(after))
+	}
+
+	d.node = p.text(run)
+	if c == '~' && len(run) > 2 {
+		return
+	}
+	d.prev = p.delims
+	if p.delims != nil {
+		p.delims.next = d
+	}
+	p.delims = d
+}
+
+// parseFootnoteRef handles [^label] for a defined footnote, reporting whether it did
+func (p *inlineParser) parseFootnoteRef() bool {
+	start := p.pos + 2
+	if start >= len(p.src) || p.src[p.pos+1] != '^' {
+		return false
+	}
+	// Labels cannot hold whitespace or brackets, so the scan stops early
+	end := start
+	for end < len(p.src) && end-start <= maxLabelLength && !strings.ContainsRune(" \t\n[]", rune(p.src[end])) {
+		end++
+	}
+	if end == start || end >= len(p.src) || p.src[end] != ']' {
+		return false
+	}
+	fn, ok := p.doc.footnotes[normalizeLabel(p.src[start:end])]
+	if !ok {
+		return false
+	}
+
+	p.append(&inline{kind: footnoteRefInline, footnote: fn, firstRef: fn.refs == 0})
+	p.doc.useFootnote(fn)
+	p.pos = end + 1
+	return true
+}
+
+func (p *inlineParser) openBracket(image bool) {
+	start := p.pos
+	p.pos++
+	if image {
+		p.pos++
+	}
+	node := p.text(p.src[start:p.pos])
+	p.brackets = append(p.brackets, &bracket{node: node, image: image, pos: p.pos, bottom: p.delims})
+}
+
+func (p *inlineParser) closeBracket() {
+	p.pos++
+	if len(p.brackets) == 0 {
+		p.text("]")
+		return
+	}
+
+	opener := p.brackets[len(p.brackets)-1]
+	p.brackets = p.brackets[:len(p.brackets)-1]
+	if len(p.brackets) < p.inactive {
+		p.inactive = len(p.brackets)
+		if !opener.image {
+			p.text("]")
+			return
+		}
+	}
+
+	url, title, ok := p.parseLinkTarget(p.src[opener.pos : p.pos-1])
+	if !ok {
+		p.text("]")
+		return
+	}
+
+	// Emphasis inside the brackets is resolved before they become the link text
+	p.processEmphasis(opener.bottom)
+	kind := linkInline
+	if opener.image {
+		kind = imageInline
+	}
+	link := &inline{kind: kind, url: url, title: title, children: p.list(opener.node.next, nil)}
+
+	link.prev = opener.node.prev
+	if link.prev != nil {
+		link.prev.next = link
+	} else {
+		p.head = link
+	}
+	p.tail = link
+
+	// Links cannot contain other links, so no bracket before this one can
+	// open another
+	if !opener.image {
+		p.inactive = len(p.brackets)
+	}
+}
+
+// parseLinkTarget parses what follows the closing bracket of label: an
+// inline destination and title, or a reference to a link definition
+func (p *inlineParser) parseLinkTarget(label string) (url, title string, ok bool) {
+	if p.pos < len(p.src) && p.src[p.pos] == '(' {
+		if p.unclosed == nil {
+			p.unclosed = make(map[byte]int)
+		}
+		if url, title, end, ok := parseInlineTarget(p.src, p.pos, p.unclosed); ok {
+			p.pos = end
+			return url, title, true
+		}
+	}
+
+	start := p.pos
+	ref := label
+	if p.pos < len(p.src) && p.src[p.pos] == '[' {
+		if r, end, ok := scanLinkLabel(p.src, p.pos); ok {
+			// [text][] uses text as the label, [text][ref] uses ref
+			if r != "" {
+				ref = r
+			}
+			p.pos = end
+		}
+	}
+
+	if len(ref) <= maxLabelLength {
+		if r, found := p.doc.refs[normalizeLabel(ref)]; found && normalizeLabel(ref) != "" {
+			return r.url, r.title, true
+		}
+	}
+	p.pos = start
+	return "", "", false
+}
+
+// parseInlineTarget parses (destination "title") starting at the opening
+// parenthesis, returning the offset after the closing one. Titles that
+// failed to close are remembered in unclosed.
+func parseInlineTarget(src string, pos int, unclosed map[byte]int) (url, title string, end int, ok bool) {
+	dest, i, ok := parseDestination(src, skipWhitespace(src, pos+1))
+	if !ok {
+		return "", "", 0, false
+	}
+
+	if k := skipWhitespace(src, i); k > i && k < len(src) && strings.IndexByte(`"'(`, src[k]) >= 0 {
+		if title, i, ok = parseTitle(src, k, unclosed); !ok {
+			return "", "", 0, false
+		}
+	}
+
+	i = skipWhitespace(src, i)
+	if i >= len(src) || src[i] != ')' {
+		return "", "", 0, false
+	}
+	return unescape(dest), unescape(title), i + 1, true
+}
+
+// scanLinkLabel scans the [label] at pos, which may not hold unescaped
+// brackets, returning it and the offset after it
+func scanLinkLabel(src string, pos int) (label string, end int, ok bool) {
+	for i := pos + 1; i < len(src) && i-pos <= maxLabelLength+1; i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			return "", 0, false
+		case ']':
+			return src[pos+1 : i], i + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// parseDestination parses a link destination, either <bracketed> or bare
+// with balanced parentheses, returning it still escaped and the offset
+// after it. A bare destination may be empty.
+func parseDestination(src string, i int) (dest string, end int, ok bool) {
+	if i < len(src) && src[i] == '<' {
+		j := i + 1
+		for j < len(src) && src[j] != '>' && src[j] != '<' && src[j] != '\n' {
+			if src[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(src) || src[j] != '>' {
+			return "", 0, false
+		}
+		return src[i+1 : j], j + 1, true
+	}
+
+	depth, j := 0, i
+	for ; j < len(src); j++ {
+		c := src[j]
+		if c == '\\' && j+1 < len(src) && isASCIIPunct(src[j+1]) {
+			j++
+			continue
+		}
+		if c == '(' {
+			if depth++; depth > maxLinkParens {
+				return "", 0, false
+			}
+		} else if c == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		} else if c <= ' ' {
+			break
+		}
+	}
+	if depth != 0 {
+		return "", 0, false
+	}
+	return src[i:j], j, true
+}
+
+// parseTitle parses a link title in quotes or parentheses starting at k,
+// returning it still escaped and the offset after it. When unclosed is not
+// nil it records where closers are missing, so no later title scans there.
+func parseTitle(src string, k int, unclosed map[byte]int) (title string, end int, ok bool) {
+	closer := src[k]
+	if closer == '(' {
+		closer = ')'
+	}
+	if from, seen := unclosed[closer]; seen && k+1 >= from {
+		return "", 0, false
+	}
+
+	m := k + 1
+	for m < len(src) && src[m] != closer {
+		if src[m] == '\\' {
+			m++
+		}
+		m++
+	}
+	if m >= len(src) {
+		if unclosed != nil {
+			unclosed[closer] = k + 1
+		}
+		return "", 0, false
+	}
+	return src[k+1 : m], m + 1, true
+}
+
+func (p *inlineParser) parseAutolink() {
+	rest := p.src[p.pos:]
+	if m := uriAutolinkPattern.FindStringSubmatch(rest); m != nil {
+		p.autolinkNode(m[1], m[1])
+		p.pos += len(m[0])
+		return
+	}
+	if m := emailAutolinkPattern.FindStringSubmatch(rest); m != nil {
+		p.autolinkNode("mailto:"+m[1], m[1])
+		p.pos += len(m[0])
+		return
+	}
+
+	// Raw HTML is not supported, so the angle bracket is plain text
+	p.pos++
+	p.text("<")
+}
+
+// extendedAutolink returns the bare URL starting at the current position,
+// if there is one. URLs must start a word, and trailing punctuation and
+// unbalanced closing parentheses are left out of them.
+func (p *inlineParser) extendedAutolink() string {
+	c := p.src[p.pos] | 0x20
+	if c != 'h' && c != 'w' {
+		return ""
+	}
+	if p.pos > 0 && strings.IndexByte(" \n*_~(", p.src[p.pos-1]) < 0 {
+		return ""
+	}
+
+	url := extendedAutolinkPattern.FindString(p.src[p.pos:])
+	for url != "" {
+		last := url[len(url)-1]
+		if strings.IndexByte(`?!.,:*_~'"`, last) >= 0 {
+			url = url[:len(url)-1]
+			continue
+		}
+		if last == ')' && strings.Count(url, ")") > strings.Count(url, "(") {
+			url = url[:len(url)-1]
+			continue
+		}
+		break
+	}
+
+	// Require something after the scheme or "www."
+	host := url[strings.IndexAny(url, "/.")+1:]
+	if strings.TrimLeft(host, "/") == "" {
+		return ""
+	}
+	return url
+}
+
+func (p *inlineParser) parseExtendedAutolink() bool {
+	url := p.extendedAutolink()
+	if url == "" {
+		return false
+	}
+
+	target := url
+	if url[0]|0x20 == 'w' {
+		target = "http://" + url
+	}
+	p.autolinkNode(target, url)
+	p.pos += len(url)
+	return true
+}
+
+func (p *inlineParser) autolinkNode(url, text string) {
+	p.append(&inline{kind: linkInline, url: url, autolink: true, children: []*inline{{kind: textInline, text: text}}})
+}
+
+func (p *inlineParser) parseEntity() {
+	if m := entityPattern.FindString(p.src[p.pos:]); m != "" {
+		if decoded := decodeEntities(m); decoded != m {
+			p.text(decoded)
+			p.pos += len(m)
+			return
+		}
+	}
+	p.pos++
+	p.text("&")
+}
+
+// parseNewline ends a line with a hard break when it ends in two or more
+// spaces, and a soft break otherwise
+func (p *inlineParser) parseNewline() {
+	p.pos++
+	kind := softBreakInline
+	if last := p.tail; last != nil && last.kind == textInline {
+		trimmed := strings.TrimRight(last.text, " ")
+		if len(last.text)-len(trimmed) >= 2 {
+			kind = hardBreakInline
+		}
+		last.text = trimmed
+	}
+	p.append(&inline{kind: kind})
+	p.skipSpaces()
+}
+
+// processEmphasis matches the delimiters above bottom on the stack into
+// emphasis, strong emphasis and strikethrough, then drops them
+func (p *inlineParser) processEmphasis(bottom *delimiter) {
+	var closer *delimiter
+	for d := p.delims; d != nil && d != bottom; d = d.prev {
+		closer = d
+	}
+	openersBottom := make(map[openerKey]*delimiter)
+
+	for closer != nil {
+		if !closer.canClose {
+			closer = closer.next
+			continue
+		}
+
+		key := openerKey{char: closer.char, canOpen: closer.canOpen, modThree: closer.length % 3}
+		if closer.char == '~' {
+			key.modThree = closer.count
+		}
+		stop, seen := openersBottom[key]
+		if !seen {
+			stop = bottom
+		}
+
+		var opener *delimiter
+		for o := closer.prev; o != nil && o != bottom && o != stop; o = o.prev {
+			if o.char != closer.char || !o.canOpen {
+				continue
+			}
+			if closer.char == '~' {
+				if o.count == closer.count {
+					opener = o
+					break
+				}
+				continue
+			}
+			// The "rule of three" keeps *foo**bar* from pairing up wrongly
+			if (o.canClose || closer.canOpen) && (o.length+closer.length)%3 == 0 &&
+				!(o.length%3 == 0 && closer.length%3 == 0) {
+				continue
+			}
+			opener = o
+			break
+		}
+
+		if opener == nil {
+			openersBottom[key] = closer.prev
+			next := closer.next
+			if !closer.canOpen {
+				p.removeDelimiter(closer)
+			}
+			closer = next
+			continue
+		}
+
+		use, kind := 1, emphasisInline
+		switch {
+		case closer.char == '~':
+			use, kind = closer.count, strikethroughInline
+		case opener.count >= 2 && closer.count >= 2:
+			use, kind = 2, strongInline
+		}
+
+		wrapped := &inline{kind: kind, children: p.list(opener.node.next, closer.node)}
+		opener.node.next, wrapped.prev = wrapped, opener.node
+		wrapped.next, closer.node.prev = closer.node, wrapped
+
+		opener.count -= use
+		opener.node.text = opener.node.text[:opener.count]
+		closer.count -= use
+		closer.node.text = closer.node.text[:closer.count]
+
+		// Delimiters between the two are now inside the wrapped node
+		for d := closer.prev; d != opener; d = d.prev {
+			p.removeDelimiter(d)
+		}
+		if opener.count == 0 {
+			p.unlink(opener.node)
+			p.removeDelimiter(opener)
+		}
+		if closer.count == 0 {
+			next := closer.next
+			p.unlink(closer.node)
+			p.removeDelimiter(closer)
+			closer = next
+		}
+	}
+
+	p.delims = bottom
+	if bottom != nil {
+		bottom.next = nil
+	}
+}
+
+func (p *inlineParser) removeDelimiter(d *delimiter) {
+	if d.prev != nil {
+		d.prev.next = d.next
+	}
+	if d.next != nil {
+		d.next.prev = d.prev
+	} else {
+		p.delims = d.prev
+	}
+}
+
+// text appends a text node
+func (p *inlineParser) text(s string) *inline {
+	node := &inline{kind: textInline, text: s}
+	p.append(node)
+	return node
+}
+
+func (p *inlineParser) append(node *inline) {
+	node.prev = p.tail
+	if p.tail != nil {
+		p.tail.next = node
+	} else {
+		p.head = node
+	}
+	p.tail = node
+}
+
+func (p *inlineParser) unlink(node *inline) {
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		p.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		p.tail = node.prev
+	}
+}
+
+// list collects the nodes from first up to, but not including, stop
+func (p *inlineParser) list(first, stop *inline) []*inline {
+	var nodes []*inline
+	for n := first; n != nil && n != stop; n = n.next {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func (p *inlineParser) skipSpaces() {
+	p.pos = skipByte(p.src, p.pos, ' ')
+}
+
+// skipWhitespace skips spaces and at most one line break
+func skipWhitespace(src string, i int) int {
+	i = skipByte(src, i, ' ')
+	if i < len(src) && src[i] == '\n' {
+		i = skipByte(src, i+1, ' ')
+	}
+	return i
+}
+
+func skipByte(src string, i int, c byte) int {
+	for i < len(src) && src[i] == c {
+		i++
+	}
+	return i
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// decodeEntities resolves HTML entities, turning the NUL character into the
+// replacement character as CommonMark requires
+func decodeEntities(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	return strings.ReplaceAll(html.UnescapeString(s), "\x00", "�")
+}
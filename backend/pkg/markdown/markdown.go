@@ -0,0 +1,116 @@
+// Package markdown renders CommonMark, with the GitHub Flavored Markdown
+// tables, task lists, strikethrough, autolinks and footnotes extensions, to
+// HTML that is safe to put straight into a page.
+//
+// Sanitization is strict by construction: raw HTML in the source is never
+// passed through but shown as text, the renderer only ever writes a fixed set
+// of tags and attributes, and link and image URLs are limited to http, https,
+// mailto (links only) and relative URLs.
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNesting bounds how deeply block quotes, lists and footnotes may nest.
+// Deeper markers are rendered as text, so hostile input cannot exhaust the
+// stack.
+const maxNesting = 32
+
+// Render converts Markdown source to sanitized HTML
+func Render(source string) string {
+	doc := parse(source)
+	r := &renderer{doc: doc, out: &strings.Builder{}}
+	r.document()
+	return r.out.String()
+}
+
+// linkRef is the target of a link reference definition
+type linkRef struct {
+	url   string
+	title string
+}
+
+// footnote is a footnote definition. Footnotes are numbered in the order
+// they are first referenced; unreferenced ones are not rendered.
+type footnote struct {
+	blocks []*block
+	index  int
+	refs   int
+}
+
+// document is parsed Markdown. Link references and footnotes are collected
+// from the whole source before any inline content is parsed, so they can be
+// used before they are defined.
+type document struct {
+	blocks    []*block
+	refs      map[string]linkRef
+	footnotes map[string]*footnote
+	used      []*footnote
+}
+
+func parse(source string) *document {
+	source = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "�").Replace(source)
+	if !utf8.ValidString(source) {
+		source = strings.ToValidUTF8(source, "�")
+	}
+
+	// A final line break ends the last line rather than starting another
+	lines := strings.Split(strings.TrimSuffix(source, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+
+	doc := &document{
+		refs:      make(map[string]linkRef),
+		footnotes: make(map[string]*footnote),
+	}
+	p := &blockParser{doc: doc}
+	doc.blocks = p.parse(lines)
+	return doc
+}
+
+// useFootnote numbers fn on its first reference
+func (d *document) useFootnote(fn *footnote) {
+	if fn.index == 0 {
+		d.used = append(d.used, fn)
+		fn.index = len(d.used)
+	}
+	fn.refs++
+}
+
+// normalizeLabel matches link and footnote labels case-insensitively and
+// regardless of how whitespace inside them is spaced
+func normalizeLabel(label string) string {
+	return strings.Join(strings.Fields(strings.ToLower(label)), " ")
+}
+
+var escapedPunctPattern = regexp.MustCompile(`\\([!-/:-@\[-` + "`" + `{-~])`)
+
+// unescape resolves backslash escapes and entities in link destinations and titles
+func unescape(s string) string {
+	return decodeEntities(escapedPunctPattern.ReplaceAllString(s, "$1"))
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of four columns
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := 4 - column%4
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
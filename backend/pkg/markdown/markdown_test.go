@@ -0,0 +1,230 @@
+package markdown
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// specExample is an example from the CommonMark spec. testdata/spec.json
+// holds those of version 0.31.2 (https://spec.commonmark.org/0.31.2/,
+// CC BY-SA 4.0).
+type specExample struct {
+	Markdown string `json:"markdown"`
+	HTML     string `json:"html"`
+	Example  int    `json:"example"`
+	Section  string `json:"section"`
+}
+
+// specDeviations are the spec examples the renderer deliberately does not
+// follow, with the reason
+var specDeviations = map[int]string{
+	1:   "tabs are expanded to spaces",
+	2:   "tabs are expanded to spaces",
+	3:   "tabs are expanded to spaces",
+	13:  "tabs are expanded to spaces",
+	21:  "raw HTML is escaped",
+	31:  "raw HTML is escaped",
+	144: "language classes keep only letters, digits and -_+#.",
+	201: "raw HTML is escaped",
+	308: "raw HTML is escaped",
+	309: "raw HTML is escaped",
+	344: "raw HTML is escaped",
+	475: "raw HTML is escaped",
+	476: "raw HTML is escaped",
+	477: "raw HTML is escaped",
+	491: "raw HTML is escaped",
+	494: "raw HTML is escaped",
+	524: "raw HTML is escaped",
+	536: "raw HTML is escaped",
+	540: "labels are lowercased, not Unicode case folded",
+	596: "only http, https and mailto links are allowed",
+	598: "only http, https and mailto links are allowed",
+	599: "only http, https and mailto links are allowed",
+	601: "only http, https and mailto links are allowed",
+	608: "bare URLs are autolinked",
+	611: "bare URLs are autolinked",
+	642: "raw HTML is escaped",
+	643: "raw HTML is escaped",
+}
+
+// specDeviantSections are sections about raw HTML, which is always escaped
+var specDeviantSections = map[string]bool{"HTML blocks": true, "Raw HTML": true}
+
+var (
+	// blockTagSpace is the line breaks around block tags, which the spec
+	// places differently in a few lists and which browsers ignore
+	blockTagSpace = regexp.MustCompile(`\s*(</?(?:p|h[1-6]|hr|pre|blockquote|ul|ol|li)\b[^>]*>)\s*`)
+	// extraAttributes are the attributes the renderer adds to links and
+	// images, and the spellings it uses for some, that the spec lacks
+	extraAttributes = strings.NewReplacer(` rel="nofollow noopener noreferrer"`, "", ` loading="lazy"`, "",
+		" />", ">", "&#34;", "&quot;", "&#39;", "'")
+)
+
+func normalizeHTML(s string) string {
+	return blockTagSpace.ReplaceAllString(extraAttributes.Replace(s), "$1")
+}
+
+func TestSpec(t *testing.T) {
+	data, err := os.ReadFile("testdata/spec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var examples []specExample
+	if err := json.Unmarshal(data, &examples); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ex := range examples {
+		if specDeviantSections[ex.Section] || specDeviations[ex.Example] != "" {
+			continue
+		}
+		if got, want := normalizeHTML(Render(ex.Markdown)), normalizeHTML(ex.HTML); got != want {
+			t.Errorf("example %d (%s): Render(%q)\n got %q\nwant %q", ex.Example, ex.Section, ex.Markdown, got, want)
+		}
+	}
+}
+
+func TestRenderExtensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "table",
+			markdown: "| a | b |\n|:--|--:|\n| 1 | 2 |",
+			want:     "<table>\n<thead>\n<tr>\n<th align=\"left\">a</th>\n<th align=\"right\">b</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td align=\"left\">1</td>\n<td align=\"right\">2</td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		{
+			name:     "task list",
+			markdown: "- [x] done\n- [ ] todo",
+			want:     "<ul>\n<li class=\"task-list-item\"><input type=\"checkbox\" disabled checked> done</li>\n<li class=\"task-list-item\"><input type=\"checkbox\" disabled> todo</li>\n</ul>\n",
+		},
+		{
+			name:     "strikethrough",
+			markdown: "~~gone~~ ~kept~~",
+			want:     "<p><del>gone</del> ~kept~~</p>\n",
+		},
+		{
+			name:     "bare url",
+			markdown: "see www.example.com.",
+			want:     "<p>see <a href=\"http://www.example.com\" rel=\"nofollow noopener noreferrer\">www.example.com</a>.</p>\n",
+		},
+		{
+			name:     "footnote",
+			markdown: "true[^1]\n\n[^1]: Source",
+			want:     "<p>true<sup class=\"footnote-ref\"><a href=\"#fn-1\" id=\"fnref-1\">1</a></sup></p>\n<section class=\"footnotes\">\n<ol>\n<li id=\"fn-1\">\n<p>Source <a href=\"#fnref-1\" class=\"footnote-backref\">↩</a></p>\n</li>\n</ol>\n</section>\n",
+		},
+		{
+			name:     "undefined footnote",
+			markdown: "true[^1]",
+			want:     "<p>true[^1]</p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.markdown); got != tt.want {
+				t.Errorf("Render(%q)\n got %q\nwant %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+var (
+	unsafeTag = regexp.MustCompile(`(?i)<(?:script|style|iframe|object|embed|svg|math|form|input type="(?:text|submit))`)
+	// unsafeAttribute skips over quoted values, so only real attribute
+	// names count
+	unsafeAttribute = regexp.MustCompile(`(?i)<[a-z0-9]+(?:\s+[a-z-]+(?:="[^"]*")?)*\s+on[a-z]+`)
+	unsafeURL       = regexp.MustCompile(`(?i)(?:href|src)="[^"]*?(?:javascript|vbscript|data):`)
+)
+
+func TestRenderXSS(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		// want, if set, is part of the expected output
+		want string
+	}{
+		{name: "javascript link", markdown: "[x](javascript:alert(1))", want: "<p>x</p>"},
+		{name: "mixed case scheme", markdown: "[x](JaVaScRiPt:alert(1))", want: "<p>x</p>"},
+		{name: "entity encoded scheme", markdown: "[x](&#106;avascript:alert(1))", want: "<p>x</p>"},
+		{name: "hex entity colon", markdown: "[x](javascript&#x3A;alert(1))", want: "<p>x</p>"},
+		{name: "named entity colon", markdown: "[x](javascript&colon;alert(1))", want: "<p>x</p>"},
+		{name: "escaped scheme", markdown: `[x](java\script:alert(1))`},
+		{name: "tab in scheme", markdown: "[x](<java&#9;script:alert(1)>)", want: "<p>x</p>"},
+		{name: "newline in scheme", markdown: "[x](java&#10;script:alert(1))", want: "<p>x</p>"},
+		{name: "leading control character", markdown: "[x](&#1;javascript:alert(1))", want: "<p>x</p>"},
+		{name: "vbscript link", markdown: "[x](vbscript:msgbox(1))", want: "<p>x</p>"},
+		{name: "data link", markdown: "[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)", want: "<p>x</p>"},
+		{name: "data image", markdown: "![x](data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+)", want: "<p>x</p>"},
+		{name: "javascript image", markdown: "![x](javascript:alert(1))", want: "<p>x</p>"},
+		{name: "mailto image", markdown: "![x](mailto:a@example.com)", want: "<p>x</p>"},
+		{name: "javascript reference", markdown: "[x][r]\n\n[r]: javascript:alert(1)", want: "<p>x</p>"},
+		{name: "javascript autolink", markdown: "<javascript:alert(1)>", want: "<p>javascript:alert(1)</p>"},
+		{name: "script tag", markdown: "<script>alert(1)</script>", want: "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{name: "script block", markdown: "<script>\nalert(1)\n</script>"},
+		{name: "event handler", markdown: "<img src=x onerror=alert(1)>", want: "&lt;img src=x onerror=alert(1)&gt;"},
+		{name: "quoted event handler", markdown: `<b onclick="alert(1)">x</b>`},
+		{name: "inline svg", markdown: "<svg onload=alert(1)>"},
+		{name: "html comment", markdown: "<!-- <script>alert(1)</script> -->"},
+		{name: "quote in url", markdown: `[x](https://example.com/"onmouseover="alert(1))`, want: `href="https://example.com/%22onmouseover=%22alert(1)"`},
+		{name: "quote in title", markdown: `[x](https://example.com "a\" onmouseover=\"alert(1)")`, want: `title="a&#34; onmouseover=&#34;alert(1)"`},
+		{name: "quote in alt", markdown: `![a" onerror="alert(1)](https://example.com/x.png)`, want: `alt="a&#34; onerror=&#34;alert(1)"`},
+		{name: "code block language", markdown: "```\"><script>alert(1)</script>\nx\n```", want: `<pre><code class="language-scriptalert1script">`},
+		{name: "link inside link", markdown: "[[x](javascript:alert(1))](https://example.com)"},
+		{name: "bare url", markdown: `www.example.com/"onmouseover="alert(1)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.markdown)
+			if unsafeTag.MatchString(got) || unsafeAttribute.MatchString(got) || unsafeURL.MatchString(got) {
+				t.Errorf("Render(%q) = %q, which is unsafe", tt.markdown, got)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Render(%q) = %q, want it to contain %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderPathological renders inputs that make naive Markdown parsers
+// take quadratic time or recurse without bound
+func TestRenderPathological(t *testing.T) {
+	if testing.Short() {
+		t.Skip("renders large inputs")
+	}
+
+	repeated := []string{
+		"[^", "[^a", "[", "[a]", "[a][", "[a](", "[](", "![a](", "![", "[a](b (", "[a](b \"",
+		"_a", "*a* ", "**a", "~~a", "`a", "<", "<a:", "&#", `\`, "(http://", "www.a",
+		">", "> - ", "- ", "1. ", "* a\n", "a\n", "[a]: b\n", "[a]: <", "[^a]: b\n", "|a|\n",
+	}
+	const size = 128 << 10
+	inputs := make(map[string]string)
+	for _, unit := range repeated {
+		inputs["repeated "+unit] = strings.Repeat(unit, size/len(unit))
+	}
+	inputs["nested brackets before links"] = strings.Repeat("[", size/2) + strings.Repeat("[a](b)", size/12)
+	// Backtick runs of every length, none of which closes another
+	var ticks strings.Builder
+	for n := 1; ticks.Len() < size; n++ {
+		ticks.WriteString(strings.Repeat("`", n) + "a")
+	}
+	inputs["backtick runs"] = ticks.String()
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			Render(input)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("rendering %d bytes took %v", len(input), elapsed)
+			}
+		})
+	}
+}
@@ -44,7 +44,7 @@ return 0
 `
 )
 
-// Client wraps the Redis client with rate limiting functionality
+// Client wraps the Redis client with rate limiting and caching functionality
 type Client struct {
 	rdb *redis.Client
 }
@@ -79,6 +79,31 @@ func (c *Client) RateLimit(ctx context.Context, key string, tokens int, refillRa
 	return result == 0, nil // true if rate limited (no tokens available)
 }
 
+// Get returns the value stored at key. found is false when the key does not exist.
+func (c *Client) Get(ctx context.Context, key string) (value []byte, found bool, err error) {
+	value, err = c.rdb.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores value at key for ttl
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.rdb.Set(ctx, key, value, ttl).Err()
+}
+
+// Delete removes keys, ignoring ones that do not exist
+func (c *Client) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.rdb.Del(ctx, keys...).Err()
+}
+
 // Close closes the Redis connection
 func (c *Client) Close() error {
 	return c.rdb.Close()
@@ -0,0 +1,152 @@
+// Package sentiment estimates how positive or negative a piece of text is
+// from a word lexicon, without calling any external service. An embedded
+// lexicon is used unless LoadLexicon replaces it.
+package sentiment
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed lexicon.txt
+var lexiconData string
+
+// lexicon maps lower-case words to valences from -4 to 4
+var lexicon = mustParseLexicon(lexiconData)
+
+// maxValence bounds the valences a lexicon may assign
+const maxValence = 4
+
+// negators flip the valence of the words that follow them
+var negators = map[string]bool{
+	"not": true, "no": true, "never": true, "nothing": true, "nobody": true,
+	"hardly": true, "without": true, "isnt": true, "wasnt": true, "arent": true,
+	"werent": true, "dont": true, "doesnt": true, "didnt": true, "cant": true,
+	"cannot": true, "couldnt": true, "wont": true, "wouldnt": true, "shouldnt": true,
+	"havent": true, "hasnt": true, "hadnt": true, "aint": true,
+}
+
+// intensifiers scale the valence of the word right after them
+var intensifiers = map[string]float64{
+	"very": 1.5, "really": 1.5, "so": 1.3, "extremely": 1.8, "incredibly": 1.8,
+	"totally": 1.5, "truly": 1.4, "absolutely": 1.8, "completely": 1.5,
+	"slightly": 0.5, "somewhat": 0.6, "kinda": 0.6, "barely": 0.4, "little": 0.6,
+}
+
+const (
+	// negationWindow is how many words after a negator it still applies to
+	negationWindow = 3
+	// negationFactor softens flipped words: "not good" is less bad than "bad"
+	negationFactor = -0.75
+	// normalizationAlpha controls how quickly the summed valence approaches
+	// ±1; larger values need more sentiment words to reach a strong score
+	normalizationAlpha = 15
+)
+
+// Result is the sentiment of a text
+type Result struct {
+	// Score runs from -1 (very negative) through 0 (neutral) to 1 (very positive)
+	Score float64
+	// Words is how many lexicon words contributed to the score
+	Words int
+}
+
+// Analyze scores text. Text without any lexicon words scores 0.
+func Analyze(text string) Result {
+	var result Result
+	var sum float64
+	negated := 0
+	scale := 1.0
+
+	for _, token := range tokenize(text) {
+		if negators[token] {
+			negated = negationWindow
+			continue
+		}
+		if factor, ok := intensifiers[token]; ok {
+			scale *= factor
+			continue
+		}
+
+		if valence, ok := lexicon[token]; ok {
+			value := valence * scale
+			if negated > 0 {
+				value *= negationFactor
+			}
+			sum += value
+			result.Words++
+		}
+		scale = 1
+		if negated > 0 {
+			negated--
+		}
+	}
+
+	result.Score = sum / math.Sqrt(sum*sum+normalizationAlpha)
+	return result
+}
+
+// tokenize lower-cases text and splits it into words, dropping apostrophes so
+// "don't" and "dont" match the same negator
+func tokenize(text string) []string {
+	text = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(text))
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+// LoadLexicon replaces the embedded lexicon with one read from r. Each line
+// holds a word and its valence from -4 to 4 separated by a tab; further
+// tab-separated fields are ignored, so the vader_lexicon.txt file of VADER can
+// be loaded as is. Lines that are empty or start with # are skipped. It must
+// be called before Analyze is first used.
+func LoadLexicon(r io.Reader) error {
+	words, err := parseLexicon(r)
+	if err != nil {
+		return err
+	}
+	lexicon = words
+	return nil
+}
+
+func mustParseLexicon(data string) map[string]float64 {
+	words, err := parseLexicon(strings.NewReader(data))
+	if err != nil {
+		panic(err)
+	}
+	return words
+}
+
+func parseLexicon(r io.Reader) (map[string]float64, error) {
+	words := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("lexicon line %d: expected a word and a valence separated by a tab", line)
+		}
+		valence, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil || math.Abs(valence) > maxValence {
+			return nil, fmt.Errorf("lexicon line %d: valence %q is not a number from -4 to 4", line, fields[1])
+		}
+		words[strings.ToLower(strings.TrimSpace(fields[0]))] = valence
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("lexicon has no words")
+	}
+	return words, nil
+}
@@ -0,0 +1,173 @@
+package sentiment
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		words int
+		sign  int
+	}{
+		{name: "empty", text: "", words: 0, sign: 0},
+		{name: "no lexicon words", text: "I went to the shop on Tuesday.", words: 0, sign: 0},
+		{name: "positive", text: "What a wonderful, happy day.", words: 2, sign: 1},
+		{name: "negative", text: "I felt lonely and exhausted.", words: 2, sign: -1},
+		{name: "case and punctuation", text: "HAPPY!!! (so happy)", words: 2, sign: 1},
+		{name: "negated", text: "I was not happy", words: 1, sign: -1},
+		{name: "negated with apostrophe", text: "I don't feel good", words: 1, sign: -1},
+		{name: "curly apostrophe", text: "I didn’t enjoy it", words: 1, sign: -1},
+		{name: "negation ends after window", text: "not that it was ever so bad, but great", words: 2, sign: 1},
+		{name: "mixed", text: "The trip was great but the flight was awful and I was exhausted", words: 3, sign: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Analyze(tt.text)
+			if got.Words != tt.words {
+				t.Errorf("Analyze(%q).Words = %d, want %d", tt.text, got.Words, tt.words)
+			}
+			if sign := sign(got.Score); sign != tt.sign {
+				t.Errorf("Analyze(%q).Score = %v, want sign %d", tt.text, got.Score, tt.sign)
+			}
+		})
+	}
+}
+
+func TestAnalyzeModifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		stronger string
+		weaker   string
+	}{
+		{name: "intensifier", stronger: "very happy", weaker: "happy"},
+		{name: "stacked intensifiers", stronger: "really very happy", weaker: "very happy"},
+		{name: "diminisher", stronger: "tired", weaker: "slightly tired"},
+		{name: "negation softens", stronger: "good", weaker: "not good"},
+		{name: "more words", stronger: "happy and grateful", weaker: "happy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stronger := math.Abs(Analyze(tt.stronger).Score)
+			weaker := math.Abs(Analyze(tt.weaker).Score)
+			if stronger <= weaker {
+				t.Errorf("|score(%q)| = %v, want more than |score(%q)| = %v", tt.stronger, stronger, tt.weaker, weaker)
+			}
+		})
+	}
+}
+
+func TestAnalyzeBounds(t *testing.T) {
+	tests := []string{
+		strings.Repeat("wonderful ", 10000),
+		strings.Repeat("extremely incredibly absolutely ", 50) + "wonderful",
+		strings.Repeat("horrible ", 10000),
+	}
+
+	for _, text := range tests {
+		score := Analyze(text).Score
+		if math.IsNaN(score) || score < -1 || score > 1 {
+			t.Errorf("Analyze(%.20q...).Score = %v, want a number from -1 to 1", text, score)
+		}
+	}
+}
+
+func TestParseLexicon(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name: "word and valence",
+			data: "# comment\n\nhappy\t3\nSad\t-2.5\n",
+			want: map[string]float64{"happy": 3, "sad": -2.5},
+		},
+		{
+			name: "vader columns",
+			data: "happy\t2.7\t0.78102\t[3, 3, 2, 3, 2, 3, 3, 3, 2, 3]\n",
+			want: map[string]float64{"happy": 2.7},
+		},
+		{name: "missing valence", data: "happy\n", wantErr: true},
+		{name: "space separated", data: "happy 3\n", wantErr: true},
+		{name: "not a number", data: "happy\tvery\n", wantErr: true},
+		{name: "out of range", data: "outstanding\t5\n", wantErr: true},
+		{name: "empty", data: "# nothing here\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLexicon(strings.NewReader(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseLexicon(%q) = %v, want an error", tt.data, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLexicon(%q) failed: %v", tt.data, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseLexicon(%q) = %v, want %v", tt.data, got, tt.want)
+			}
+			for word, valence := range tt.want {
+				if got[word] != valence {
+					t.Errorf("parseLexicon(%q)[%q] = %v, want %v", tt.data, word, got[word], valence)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadLexicon(t *testing.T) {
+	embedded := lexicon
+	defer func() { lexicon = embedded }()
+
+	if err := LoadLexicon(strings.NewReader("splendiferous\t4\n")); err != nil {
+		t.Fatalf("LoadLexicon failed: %v", err)
+	}
+	if got := Analyze("splendiferous but happy"); got.Words != 1 || got.Score <= 0 {
+		t.Errorf("Analyze with the loaded lexicon = %+v, want only the loaded word scored", got)
+	}
+
+	if err := LoadLexicon(strings.NewReader("broken")); err == nil {
+		t.Error("LoadLexicon accepted a malformed lexicon")
+	}
+	if _, ok := lexicon["splendiferous"]; !ok {
+		t.Error("a failed LoadLexicon replaced the lexicon")
+	}
+}
+
+func TestEmbeddedLexicon(t *testing.T) {
+	if len(lexicon) < 1000 {
+		t.Errorf("embedded lexicon has %d words, want at least 1000", len(lexicon))
+	}
+	for word := range lexicon {
+		if word != strings.ToLower(word) || strings.ContainsFunc(word, func(r rune) bool { return r < 'a' || r > 'z' }) {
+			t.Errorf("lexicon word %q would never match a token", word)
+		}
+		if negators[word] {
+			t.Errorf("lexicon word %q is also a negator", word)
+		}
+		if _, ok := intensifiers[word]; ok {
+			t.Errorf("lexicon word %q is also an intensifier", word)
+		}
+	}
+}
+
+func sign(x float64) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	default:
+		return 0
+	}
+}
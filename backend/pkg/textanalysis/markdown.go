@@ -0,0 +1,96 @@
+package textanalysis
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	fencePattern       = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	headingPattern     = regexp.MustCompile(`^\s{0,3}#{1,6}(\s+|$)`)
+	closingHashPattern = regexp.MustCompile(`\s+#+\s*$`)
+	quotePattern       = regexp.MustCompile(`^\s{0,3}(>\s?)+`)
+	listPattern        = regexp.MustCompile(`^\s*([-*+]|\d{1,9}[.)])\s+(\[[ xX]\]\s+)?`)
+	rulePattern        = regexp.MustCompile(`^\s{0,3}((-\s*){3,}|(\*\s*){3,}|(_\s*){3,})$`)
+	tableRulePattern   = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+	linkDefPattern     = regexp.MustCompile(`^\s{0,3}\[[^\]^][^\]]*\]:\s*\S+`)
+	footnoteDefPattern = regexp.MustCompile(`^\s{0,3}\[\^[^\]]+\]:\s*`)
+
+	imagePattern       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	refLinkPattern     = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+	footnoteRefPattern = regexp.MustCompile(`\[\^[^\]]+\]`)
+	autolinkPattern    = regexp.MustCompile(`<(https?://|mailto:)[^>]*>`)
+	htmlTagPattern     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	emphasisPattern    = regexp.MustCompile("\\*+|~~+|`+")
+	// Underscores only mark emphasis at word edges, so snake_case survives
+	underscorePattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_+|_+([^\p{L}\p{N}_]|$)`)
+	escapePattern     = regexp.MustCompile(`\\([!-/:-@\[-` + "`" + `{-~])`)
+)
+
+// PlainText strips Markdown syntax from text, keeping the words a reader
+// would see: link and image text stay, URLs, markup and code fences go. Each
+// block (paragraph line, heading, list item, table row) ends up on its own
+// line. Code inside fences is kept as written.
+func PlainText(markdown string) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+
+	inFence := false
+	for _, line := range lines {
+		if fencePattern.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+
+		if rulePattern.MatchString(line) || tableRulePattern.MatchString(line) || linkDefPattern.MatchString(line) {
+			continue
+		}
+
+		line = quotePattern.ReplaceAllString(line, "")
+		if headingPattern.MatchString(line) {
+			line = headingPattern.ReplaceAllString(line, "")
+			line = closingHashPattern.ReplaceAllString(line, "")
+		}
+		line = listPattern.ReplaceAllString(line, "")
+		line = footnoteDefPattern.ReplaceAllString(line, "")
+
+		out = append(out, inlinePlainText(line))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// inlinePlainText strips inline Markdown and HTML from one line
+func inlinePlainText(line string) string {
+	line = imagePattern.ReplaceAllString(line, "$1")
+	line = linkPattern.ReplaceAllString(line, "$1")
+	line = refLinkPattern.ReplaceAllString(line, "$1")
+	line = footnoteRefPattern.ReplaceAllString(line, "")
+	line = autolinkPattern.ReplaceAllString(line, "")
+	line = htmlTagPattern.ReplaceAllString(line, "")
+
+	// Escaped characters are literal, so keep them out of the markup passes
+	var escaped []string
+	line = escapePattern.ReplaceAllStringFunc(line, func(match string) string {
+		escaped = append(escaped, match[1:])
+		return "\x00"
+	})
+	line = emphasisPattern.ReplaceAllString(line, "")
+	line = underscorePattern.ReplaceAllString(line, "$1$2")
+	for _, char := range escaped {
+		line = strings.Replace(line, "\x00", char, 1)
+	}
+
+	// Table cells become words separated by spaces
+	if strings.Contains(line, "|") {
+		line = strings.Trim(strings.ReplaceAll(line, "|", " "), " ")
+	}
+
+	return html.UnescapeString(line)
+}
@@ -0,0 +1,302 @@
+// Package textanalysis measures journal text: it strips Markdown, counts
+// words, and derives character, sentence and reading-time counts and a
+// readability score. Words are exact for scripts that separate them with
+// spaces; for scripts that do not, such as Chinese, Japanese and Thai, there
+// is no dictionary to segment against, so the count is estimated from the
+// number of characters.
+package textanalysis
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// wordsPerMinute is a typical silent reading speed for alphabetic text
+	wordsPerMinute = 230
+	// cjkCharactersPerMinute is the equivalent for Chinese and Japanese
+	cjkCharactersPerMinute = 500
+	// minReadabilityWords is how many words a text needs before its
+	// readability means anything
+	minReadabilityWords = 10
+	// minLatinShare is the share of words that must be in Latin script for
+	// the English-based readability formula to apply
+	minLatinShare = 0.8
+)
+
+// spacelessScripts are the scripts written without spaces between words,
+// with the average length of their words in runes, which estimates how many
+// words a run of them holds
+var spacelessScripts = []struct {
+	table      *unicode.RangeTable
+	wordLength float64
+	// cjk marks Chinese and Japanese, which are read by the character
+	cjk bool
+}{
+	{unicode.Han, 1.5, true},
+	{unicode.Hiragana, 2, true},
+	{unicode.Katakana, 4, true},
+	{unicode.Thai, 4, false},
+	{unicode.Lao, 4, false},
+	{unicode.Khmer, 5, false},
+	{unicode.Myanmar, 4, false},
+}
+
+// Stats describes a text
+type Stats struct {
+	// Words is exact for text with spaces between words and estimated from
+	// its length for scripts without
+	Words int
+	// Characters counts letters, digits and punctuation, but not whitespace
+	Characters     int
+	Sentences      int
+	ReadingSeconds int
+	// Readability is the Flesch reading ease, 0 (very hard) to 100 (very
+	// easy). It is nil for short texts and texts mostly not in Latin script.
+	Readability *float64
+}
+
+// Analyze measures Markdown text as a reader would see it
+func Analyze(markdown string) Stats {
+	return AnalyzePlainText(PlainText(markdown))
+}
+
+// AnalyzePlainText measures text that has no markup
+func AnalyzePlainText(text string) Stats {
+	var stats Stats
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			stats.Characters++
+		}
+	}
+
+	segments := segment(text)
+	var cjkWords, cjkRunes, latin, syllables int
+	for _, seg := range segments {
+		stats.Words += seg.words
+		if seg.cjk {
+			cjkWords += seg.words
+			cjkRunes += utf8.RuneCountInString(seg.text)
+		}
+		if seg.latin {
+			latin++
+			syllables += countSyllables(seg.text)
+		}
+	}
+	stats.Sentences = countSentences(text)
+
+	minutes := float64(stats.Words-cjkWords)/wordsPerMinute + float64(cjkRunes)/cjkCharactersPerMinute
+	stats.ReadingSeconds = int(math.Ceil(minutes * 60))
+
+	if latin >= minReadabilityWords && stats.Sentences > 0 && float64(latin) >= minLatinShare*float64(stats.Words) {
+		score := 206.835 - 1.015*float64(latin)/float64(stats.Sentences) - 84.6*float64(syllables)/float64(latin)
+		score = math.Max(0, math.Min(100, score))
+		stats.Readability = &score
+	}
+
+	return stats
+}
+
+// Words splits text into the runs its words are counted from. Runs of a
+// script written with spaces are single words; a run of Chinese, Japanese or
+// a script like Thai may hold several.
+func Words(text string) []string {
+	segments := segment(text)
+	words := make([]string, len(segments))
+	for i, seg := range segments {
+		words[i] = seg.text
+	}
+	return words
+}
+
+// segmentInfo is one word-like run of text
+type segmentInfo struct {
+	text string
+	// words is how many words the run counts as
+	words int
+	cjk   bool
+	latin bool
+}
+
+// plainScript marks runs of scripts written with spaces between words
+const plainScript = -1
+
+// segment splits text into runs of letters, digits and marks. Apostrophes,
+// hyphens and underscores between letters or digits keep a run together
+// ("don't", "well-known", "snake_case"), as do decimal points and thousands
+// separators between digits ("3.14", "1,000"). A run of a script written
+// without spaces ends where the script changes.
+func segment(text string) []segmentInfo {
+	var segments []segmentInfo
+	runes := []rune(text)
+	var current []rune
+	script := plainScript
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		segments = append(segments, classify(string(current), script))
+		current = current[:0]
+	}
+
+	for i, r := range runes {
+		switch {
+		case unicode.IsMark(r) && len(current) > 0:
+			// Combining marks belong to the run they follow
+			current = append(current, r)
+		case isWordRune(r):
+			if s := spacelessScript(r); s != script {
+				flush()
+				script = s
+			}
+			current = append(current, r)
+		case script == plainScript && len(current) > 0 && i+1 < len(runes) && joins(r, runes[i-1], runes[i+1]):
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return segments
+}
+
+// joins reports whether r keeps the run it sits in together, given the runes
+// before and after it
+func joins(r, before, after rune) bool {
+	switch r {
+	case '\'', '’', '-', '_':
+		return isWordRune(after) && spacelessScript(after) == plainScript
+	case '.', ',':
+		return unicode.IsDigit(before) && unicode.IsDigit(after)
+	}
+	return false
+}
+
+// classify works out how many words a run counts as and which script it is in
+func classify(run string, script int) segmentInfo {
+	if script != plainScript {
+		// Vowel signs and tones are combining marks, not part of the length
+		length := 0
+		for _, r := range run {
+			if !unicode.IsMark(r) {
+				length++
+			}
+		}
+		info := spacelessScripts[script]
+		return segmentInfo{text: run, words: int(math.Ceil(float64(length) / info.wordLength)), cjk: info.cjk}
+	}
+
+	seg := segmentInfo{text: run, words: 1, latin: true}
+	letters := 0
+	for _, r := range run {
+		if unicode.IsLetter(r) {
+			letters++
+			if !unicode.Is(unicode.Latin, r) {
+				seg.latin = false
+			}
+		}
+	}
+	if letters == 0 {
+		// Numbers count as words but have no syllables to rate
+		seg.latin = false
+	}
+	return seg
+}
+
+// countSentences counts runs of text ending in sentence punctuation or a line
+// break, ignoring ones without any letters or digits
+func countSentences(text string) int {
+	runes := []rune(text)
+	sentences := 0
+	hasContent := false
+	for i, r := range runes {
+		switch {
+		case r == '.' && !endsSentence(runes[i+1:]):
+		case isSentenceEnd(r) || r == '\n':
+			if hasContent {
+				sentences++
+				hasContent = false
+			}
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			hasContent = true
+		}
+	}
+	if hasContent {
+		sentences++
+	}
+	return sentences
+}
+
+// endsSentence reports whether a full stop followed by rest ends a sentence.
+// It has to be followed, after any closing quotes or brackets, by the end of
+// the text or by whitespace, which rules out decimals such as 3.14 and the
+// inside of "e.g."; a lower-case word after the space continues the
+// sentence, as it does after an abbreviation.
+func endsSentence(rest []rune) bool {
+	i := 0
+	for i < len(rest) && strings.ContainsRune(`"')]»”’`, rest[i]) {
+		i++
+	}
+	if i == len(rest) {
+		return true
+	}
+	if !unicode.IsSpace(rest[i]) {
+		return false
+	}
+	for i < len(rest) && unicode.IsSpace(rest[i]) {
+		if rest[i] == '\n' {
+			return true
+		}
+		i++
+	}
+	return i == len(rest) || !unicode.IsLower(rest[i])
+}
+
+// countSyllables estimates the syllables of an English word from its vowel
+// groups, not counting a silent final "e"
+func countSyllables(word string) int {
+	word = strings.ToLower(word)
+	count := 0
+	previousVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouyàáâäèéêëìíîïòóôöùúûü", r)
+		if vowel && !previousVowel {
+			count++
+		}
+		previousVowel = vowel
+	}
+	if count > 1 && strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") {
+		count--
+	}
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
+
+// spacelessScript returns the index in spacelessScripts of the script of r,
+// or plainScript. The prolonged sound mark, which Unicode shares between
+// hiragana and katakana, is almost always written in katakana words.
+func spacelessScript(r rune) int {
+	if r == 'ー' {
+		r = 'ア'
+	}
+	for i, script := range spacelessScripts {
+		if unicode.Is(script.table, r) {
+			return i
+		}
+	}
+	return plainScript
+}
+
+func isSentenceEnd(r rune) bool {
+	return strings.ContainsRune(".!?。！？…", r)
+}
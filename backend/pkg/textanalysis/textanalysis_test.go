@@ -0,0 +1,178 @@
+package textanalysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "empty", text: "", want: []string{}},
+		{name: "spaces and punctuation", text: "Hello, world!  Again?", want: []string{"Hello", "world", "Again"}},
+		{name: "comma between words", text: "apples,oranges", want: []string{"apples", "oranges"}},
+		{name: "period between words", text: "the end.Next day", want: []string{"the", "end", "Next", "day"}},
+		{name: "decimal and thousands", text: "3.14 and 1,000,000", want: []string{"3.14", "and", "1,000,000"}},
+		{name: "trailing period after number", text: "I ran 5.", want: []string{"I", "ran", "5"}},
+		{name: "joiners inside words", text: "don't well-known snake_case it’s", want: []string{"don't", "well-known", "snake_case", "it’s"}},
+		{name: "joiners at edges", text: "-dash 'quoted' under_", want: []string{"dash", "quoted", "under"}},
+		{name: "combining marks", text: "café naïve", want: []string{"café", "naïve"}},
+		{name: "script changes", text: "hello世界", want: []string{"hello", "世界"}},
+		{name: "japanese runs", text: "東京に行きました", want: []string{"東京", "に", "行", "きました"}},
+		{name: "prolonged sound mark", text: "コーヒーを", want: []string{"コーヒー", "を"}},
+		{name: "no joiner into han", text: "a-世界", want: []string{"a", "世界"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Words(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Words(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzePlainText(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		words      int
+		characters int
+		sentences  int
+	}{
+		{name: "empty", text: "", words: 0, characters: 0, sentences: 0},
+		{name: "english", text: "I walked home. It rained!", words: 5, characters: 21, sentences: 2},
+		{name: "list without spaces", text: "apples,oranges,pears", words: 3, characters: 20, sentences: 1},
+		{name: "line breaks end sentences", text: "first line\nsecond line", words: 4, characters: 19, sentences: 2},
+		{name: "punctuation only", text: "... !!!", words: 0, characters: 6, sentences: 0},
+		{name: "decimal", text: "It cost 3.14 today.", words: 4, characters: 16, sentences: 1},
+		{name: "abbreviation", text: "Pack fruit, e.g. apples. Then leave.", words: 7, characters: 31, sentences: 2},
+		{name: "abbreviation at the end", text: "We saw owls, bats, etc.", words: 5, characters: 19, sentences: 1},
+		{name: "version number", text: "Upgraded to v1.2.3 at last", words: 5, characters: 22, sentences: 1},
+		{name: "quoted", text: `She said "stop." Then left.`, words: 5, characters: 23, sentences: 2},
+		{name: "ellipsis", text: "Well... maybe. Fine!", words: 3, characters: 18, sentences: 2},
+		// 6 Han characters at 1.5 per word
+		{name: "chinese", text: "我今天很高兴。", words: 4, characters: 7, sentences: 1},
+		// 東京 2, に 1, 行 1, きました 2
+		{name: "japanese", text: "東京に行きました。", words: 6, characters: 9, sentences: 1},
+		// 7 letters at 4 per word; vowel and tone marks do not count
+		{name: "thai", text: "สวัสดีครับ", words: 2, characters: 10, sentences: 1},
+		{name: "mixed scripts", text: "Lunch in 東京 today", words: 5, characters: 14, sentences: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzePlainText(tt.text)
+			if got.Words != tt.words || got.Characters != tt.characters || got.Sentences != tt.sentences {
+				t.Errorf("AnalyzePlainText(%q) = %d words, %d characters, %d sentences; want %d, %d, %d",
+					tt.text, got.Words, got.Characters, got.Sentences, tt.words, tt.characters, tt.sentences)
+			}
+		})
+	}
+}
+
+func TestReadingSeconds(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{name: "empty", text: "", want: 0},
+		{name: "one word", text: "hello", want: 1},
+		{name: "a minute of english", text: strings.Repeat("word ", wordsPerMinute), want: 60},
+		{name: "a minute of chinese", text: strings.Repeat("字", cjkCharactersPerMinute), want: 60},
+		{name: "half and half", text: strings.Repeat("word ", wordsPerMinute/2) + strings.Repeat("字", cjkCharactersPerMinute/2), want: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnalyzePlainText(tt.text).ReadingSeconds; got != tt.want {
+				t.Errorf("ReadingSeconds = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadability(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// min and max bound the score; both zero means no score
+		min, max float64
+	}{
+		{name: "too short", text: "The cat sat on the mat."},
+		{name: "not latin", text: strings.Repeat("Привет мир. ", 10)},
+		{name: "mostly not latin", text: strings.Repeat("我很高兴 ", 10) + "one two three four five six seven eight nine ten."},
+		{name: "easy", text: "The cat sat on the mat. The dog ran to the park. We had fun.", min: 90, max: 100},
+		{name: "hard", text: "Institutional accountability necessitates comprehensive organizational transparency, particularly regarding administrative expenditure.", min: 0, max: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzePlainText(tt.text).Readability
+			if tt.min == 0 && tt.max == 0 {
+				if got != nil {
+					t.Errorf("Readability = %v, want nil", *got)
+				}
+				return
+			}
+			if got == nil || *got < tt.min || *got > tt.max {
+				t.Errorf("Readability = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestCountSyllables(t *testing.T) {
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"cat", 1},
+		{"make", 1},
+		{"table", 2},
+		{"happy", 2},
+		{"beautiful", 3},
+		{"rhythm", 1},
+		{"Café", 2},
+	}
+
+	for _, tt := range tests {
+		if got := countSyllables(tt.word); got != tt.want {
+			t.Errorf("countSyllables(%q) = %d, want %d", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{name: "heading", markdown: "## Today ##", want: "Today"},
+		{name: "emphasis", markdown: "a **bold** and _light_ day", want: "a bold and light day"},
+		{name: "snake case kept", markdown: "my_var_name", want: "my_var_name"},
+		{name: "link", markdown: "see [the docs](https://example.com)", want: "see the docs"},
+		{name: "image", markdown: "![a cat](cat.png)", want: "a cat"},
+		{name: "list and quote", markdown: "> - [x] done", want: "done"},
+		{name: "footnote", markdown: "true[^1]\n[^1]: Source", want: "true\nSource"},
+		{name: "table", markdown: "| a | b |\n|---|---|\n| 1 | 2 |", want: "a   b\n1   2"},
+		{name: "fenced code kept", markdown: "```\n**x**\n```", want: "**x**"},
+		{name: "escapes", markdown: `\*not emphasis\*`, want: "*not emphasis*"},
+		{name: "html and entities", markdown: "<b>fish &amp; chips</b>", want: "fish & chips"},
+		{name: "unterminated footnote refs", markdown: strings.Repeat("[^", 3), want: strings.Repeat("[^", 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PlainText(tt.markdown); got != tt.want {
+				t.Errorf("PlainText(%q) = %q, want %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
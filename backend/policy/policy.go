@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Role is the system-wide role of a user
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
+// Actor is the authenticated user an action is performed for
+type Actor struct {
+	UserID uint
+	Role   Role
+}
+
+// IsAdmin reports whether the actor may access every user's resources
+func (a Actor) IsAdmin() bool {
+	return a.Role == RoleAdmin
+}
+
+// Resource is anything that belongs to a single user
+type Resource interface {
+	ResourceName() string
+	ResourceID() uint
+	OwnerID() uint
+}
+
+// Shareable resources can be opened read-only by users other than the owner
+type Shareable interface {
+	Resource
+	SharedWith(userID uint) bool
+}
+
+// Kind classifies authorization failures
+type Kind int
+
+const (
+	// KindNotFound hides resources the actor may not even know exist
+	KindNotFound Kind = iota
+	// KindForbidden is for resources the actor can see but not change
+	KindForbidden
+)
+
+// Error is returned by the policy checks and by services for missing resources
+type Error struct {
+	Kind     Kind
+	Resource string
+	ID       uint
+}
+
+func (e *Error) Error() string {
+	if e.Kind == KindForbidden {
+		return fmt.Sprintf("%s %d: forbidden", e.Resource, e.ID)
+	}
+	return fmt.Sprintf("%s %d not found", e.Resource, e.ID)
+}
+
+// NotFound builds the error for a resource that does not exist or belongs to
+// another user. The two cases are deliberately indistinguishable.
+func NotFound(resource string, id uint) error {
+	return &Error{Kind: KindNotFound, Resource: resource, ID: id}
+}
+
+// Forbidden builds the error for a visible resource the actor may not change
+func Forbidden(resource string, id uint) error {
+	return &Error{Kind: KindForbidden, Resource: resource, ID: id}
+}
+
+// IsNotFound reports whether err is a not-found policy error
+func IsNotFound(err error) bool {
+	var policyErr *Error
+	return errors.As(err, &policyErr) && policyErr.Kind == KindNotFound
+}
+
+// Check is CanRead or CanWrite
+type Check func(actor Actor, resource Resource) error
+
+// CanRead allows owners, admins and users the resource is shared with
+func CanRead(actor Actor, resource Resource) error {
+	if actor.IsAdmin() || resource.OwnerID() == actor.UserID {
+		return nil
+	}
+	if shared, ok := resource.(Shareable); ok && shared.SharedWith(actor.UserID) {
+		return nil
+	}
+	return NotFound(resource.ResourceName(), resource.ResourceID())
+}
+
+// CanWrite allows owners and admins. Shared readers are told they may not
+// change the resource; everyone else gets not-found.
+func CanWrite(actor Actor, resource Resource) error {
+	if actor.IsAdmin() || resource.OwnerID() == actor.UserID {
+		return nil
+	}
+	if shared, ok := resource.(Shareable); ok && shared.SharedWith(actor.UserID) {
+		return Forbidden(resource.ResourceName(), resource.ResourceID())
+	}
+	return NotFound(resource.ResourceName(), resource.ResourceID())
+}
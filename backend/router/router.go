@@ -15,6 +15,10 @@ func SetupRouter(
 	journalService *services.JournalService,
 	categoryService *services.CategoryService,
 	userService *services.UserService,
+	tagService *services.TagService,
+	goalService *services.GoalService,
+	moodService *services.MoodService,
+	attachmentService *services.AttachmentService,
 ) *mux.Router {
 	r := mux.NewRouter()
 
@@ -22,6 +26,10 @@ func SetupRouter(
 	journalHandler := handlers.NewJournalHandler(journalService)
 	categoryHandler := handlers.NewCategoryHandler(categoryService)
 	userHandler := handlers.NewUserHandler(userService)
+	tagHandler := handlers.NewTagHandler(tagService)
+	goalHandler := handlers.NewGoalHandler(goalService)
+	moodHandler := handlers.NewMoodHandler(moodService)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
 
 	// Apply middleware
 	r.Use(middleware.CORSMiddleware())
@@ -31,18 +39,67 @@ func SetupRouter(
 	r.HandleFunc("/api/entries", journalHandler.CreateEntry).Methods("POST")
 	r.HandleFunc("/api/entries", journalHandler.ListEntries).Methods("GET")
 	r.HandleFunc("/api/entries/stats", journalHandler.GetEntryStats).Methods("GET")
+	r.HandleFunc("/api/entries/stats/timeseries", journalHandler.GetEntryTimeSeries).Methods("GET")
+	r.HandleFunc("/api/entries/stats/calendar", journalHandler.GetEntryCalendar).Methods("GET")
+	r.HandleFunc("/api/entries/stats/mood", journalHandler.GetMoodStats).Methods("GET")
+	r.HandleFunc("/api/entries/shared", journalHandler.ListSharedEntries).Methods("GET")
+	r.HandleFunc("/api/entries/preview", journalHandler.PreviewContent).Methods("POST")
+	r.HandleFunc("/api/entries/map", journalHandler.GetEntryMap).Methods("GET")
 	r.HandleFunc("/api/entries/{id}", journalHandler.GetEntry).Methods("GET")
 	r.HandleFunc("/api/entries/{id}", journalHandler.UpdateEntry).Methods("PUT")
+	r.HandleFunc("/api/entries/{id}", journalHandler.PatchEntry).Methods("PATCH")
 	r.HandleFunc("/api/entries/{id}", journalHandler.DeleteEntry).Methods("DELETE")
+	r.HandleFunc("/api/entries/{id}/autosave", journalHandler.AutosaveDraft).Methods("PUT")
+	r.HandleFunc("/api/entries/{id}/publish", journalHandler.PublishEntry).Methods("POST")
+	r.HandleFunc("/api/entries/{id}/suggested-tags", tagHandler.SuggestTagsForEntry).Methods("GET")
+	r.HandleFunc("/api/entries/{id}/shares", journalHandler.GetEntryShares).Methods("GET")
+	r.HandleFunc("/api/entries/{id}/shares", journalHandler.ShareEntry).Methods("POST")
+	r.HandleFunc("/api/entries/{id}/shares/{email}", journalHandler.UnshareEntry).Methods("DELETE")
+
+	// Attachment routes
+	r.HandleFunc("/api/entries/{id}/attachments", attachmentHandler.UploadAttachment).Methods("POST")
+	r.HandleFunc("/api/entries/{id}/attachments", attachmentHandler.ListAttachments).Methods("GET")
+	r.HandleFunc("/api/entries/{id}/attachments/{attachmentId}", attachmentHandler.DownloadAttachment).Methods("GET")
+	r.HandleFunc("/api/entries/{id}/attachments/{attachmentId}", attachmentHandler.DeleteAttachment).Methods("DELETE")
+	r.HandleFunc("/api/attachments/usage", attachmentHandler.GetAttachmentUsage).Methods("GET")
 
 	// Category routes
 	r.HandleFunc("/api/categories", categoryHandler.GetCategories).Methods("GET")
 	r.HandleFunc("/api/categories", categoryHandler.CreateCategory).Methods("POST")
+	r.HandleFunc("/api/categories/reorder", categoryHandler.ReorderCategories).Methods("PUT")
 	r.HandleFunc("/api/categories/{id}", categoryHandler.GetCategory).Methods("GET")
 	r.HandleFunc("/api/categories/{id}", categoryHandler.UpdateCategory).Methods("PUT")
 	r.HandleFunc("/api/categories/{id}", categoryHandler.DeleteCategory).Methods("DELETE")
+	r.HandleFunc("/api/categories/{id}/archive", categoryHandler.ArchiveCategory).Methods("POST")
+	r.HandleFunc("/api/categories/{id}/unarchive", categoryHandler.UnarchiveCategory).Methods("POST")
+	r.HandleFunc("/api/categories/{id}/merge", categoryHandler.MergeCategory).Methods("POST")
+	r.HandleFunc("/api/categories/{id}/stats", categoryHandler.GetCategoryStats).Methods("GET")
+
+	// Tag routes
+	r.HandleFunc("/api/tags", tagHandler.GetTags).Methods("GET")
+	r.HandleFunc("/api/tags/suggest", tagHandler.SuggestTags).Methods("GET")
+	r.HandleFunc("/api/tags/merge", tagHandler.MergeTags).Methods("POST")
+	r.HandleFunc("/api/tags/{id}", tagHandler.RenameTag).Methods("PUT")
+	r.HandleFunc("/api/tags/{id}", tagHandler.DeleteTag).Methods("DELETE")
+	r.HandleFunc("/api/tags/{id}/stats", tagHandler.GetTagStats).Methods("GET")
+
+	// Goal routes
+	r.HandleFunc("/api/goals", goalHandler.GetGoals).Methods("GET")
+	r.HandleFunc("/api/goals", goalHandler.CreateGoal).Methods("POST")
+	r.HandleFunc("/api/goals/progress", goalHandler.GetAllGoalProgress).Methods("GET")
+	r.HandleFunc("/api/goals/{id}", goalHandler.GetGoal).Methods("GET")
+	r.HandleFunc("/api/goals/{id}", goalHandler.UpdateGoal).Methods("PUT")
+	r.HandleFunc("/api/goals/{id}", goalHandler.DeleteGoal).Methods("DELETE")
+	r.HandleFunc("/api/goals/{id}/progress", goalHandler.GetGoalProgress).Methods("GET")
+
+	// Mood routes
+	r.HandleFunc("/api/moods", moodHandler.GetMoods).Methods("GET")
+	r.HandleFunc("/api/moods", moodHandler.CreateMood).Methods("POST")
+	r.HandleFunc("/api/moods/{id}", moodHandler.UpdateMood).Methods("PUT")
+	r.HandleFunc("/api/moods/{id}", moodHandler.DeleteMood).Methods("DELETE")
 
-	// User preference routes
+	// User routes
+	r.HandleFunc("/api/user", userHandler.DeleteAccount).Methods("DELETE")
 	r.HandleFunc("/api/user/preferences", userHandler.GetUserPreferences).Methods("GET")
 	r.HandleFunc("/api/user/preferences", userHandler.UpdateUserPreferences).Methods("PUT")
 	r.HandleFunc("/api/user/preferences/debug", userHandler.DebugUserPreferences).Methods("GET")
@@ -0,0 +1,15 @@
+-- Nested categories with a user-defined order among siblings
+ALTER TABLE `categories`
+  ADD COLUMN `parent_id` bigint unsigned DEFAULT NULL AFTER `user_id`,
+  ADD COLUMN `position` int NOT NULL DEFAULT 0 AFTER `color`,
+  ADD INDEX `idx_category_parent` (`user_id`, `parent_id`, `position`),
+  ADD CONSTRAINT `fk_categories_parent` FOREIGN KEY (`parent_id`) REFERENCES `categories` (`id`) ON DELETE SET NULL;
+
+-- Existing categories are all top-level; keep them in the alphabetical order
+-- they were listed in until now
+UPDATE `categories` c
+JOIN (
+  SELECT `id`, ROW_NUMBER() OVER (PARTITION BY `user_id` ORDER BY `name`, `id`) - 1 AS `position`
+  FROM `categories`
+) o ON o.`id` = c.`id`
+SET c.`position` = o.`position`;
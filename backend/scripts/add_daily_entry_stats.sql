@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS `daily_entry_stats` (
+  `user_id` bigint unsigned NOT NULL,
+  `entry_date` date NOT NULL,
+  `category_id` bigint unsigned NOT NULL DEFAULT 0,
+  `mood` varchar(100) NOT NULL DEFAULT '',
+  `entries` bigint NOT NULL DEFAULT 0,
+  `words` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`user_id`, `entry_date`, `category_id`, `mood`),
+  CONSTRAINT `fk_daily_entry_stats_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+-- Backfill from existing published entries
+DELETE FROM `daily_entry_stats`;
+
+INSERT INTO `daily_entry_stats` (`user_id`, `entry_date`, `category_id`, `mood`, `entries`, `words`)
+SELECT `user_id`, `entry_date`, COALESCE(`category_id`, 0), LEFT(COALESCE(`mood`, ''), 100), COUNT(*), COALESCE(SUM(`word_count`), 0)
+FROM `journal_entries`
+WHERE `is_draft` = FALSE AND `deleted_at` IS NULL
+GROUP BY `user_id`, `entry_date`, COALESCE(`category_id`, 0), LEFT(COALESCE(`mood`, ''), 100);
@@ -0,0 +1,18 @@
+-- Add the user-facing entry date to existing databases and backfill it from
+-- the creation timestamp. Backfilled entries are in UTC, so the date and time
+-- are read in UTC whatever the session's zone.
+SET time_zone = '+00:00';
+
+ALTER TABLE `journal_entries`
+  ADD COLUMN `entry_date` date DEFAULT NULL,
+  ADD COLUMN `entry_time` time DEFAULT NULL,
+  ADD COLUMN `entry_timezone` varchar(64) NOT NULL DEFAULT 'UTC';
+
+UPDATE `journal_entries`
+SET `entry_date` = DATE(`created_at`),
+    `entry_time` = TIME(`created_at`)
+WHERE `entry_date` IS NULL;
+
+ALTER TABLE `journal_entries`
+  MODIFY COLUMN `entry_date` date NOT NULL,
+  ADD INDEX `idx_entry_date` (`user_id`, `entry_date`);
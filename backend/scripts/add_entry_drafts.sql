@@ -0,0 +1,5 @@
+-- Draft entries and autosave. Existing entries are published.
+ALTER TABLE `journal_entries`
+  ADD COLUMN `is_draft` boolean NOT NULL DEFAULT FALSE AFTER `version`,
+  ADD COLUMN `autosaved_at` timestamp NULL DEFAULT NULL AFTER `is_draft`,
+  ADD INDEX `idx_entry_draft` (`user_id`, `is_draft`);
@@ -0,0 +1,13 @@
+-- Where each entry was written: optional coordinates in WGS 84 degrees, a
+-- place name and the accuracy of the coordinates in meters.
+ALTER TABLE `journal_entries`
+  ADD COLUMN `latitude` double DEFAULT NULL AFTER `entry_timezone`,
+  ADD COLUMN `longitude` double DEFAULT NULL AFTER `latitude`,
+  ADD COLUMN `place_name` varchar(255) NOT NULL DEFAULT '' AFTER `longitude`,
+  ADD COLUMN `location_accuracy` double DEFAULT NULL AFTER `place_name`,
+  ADD KEY `idx_entry_location` (`user_id`, `latitude`, `longitude`);
+
+-- Lets users keep the location of their entries from the people they share
+-- them with.
+ALTER TABLE `user_preferences`
+  ADD COLUMN `hide_location` tinyint(1) NOT NULL DEFAULT 0 AFTER `timezone`;
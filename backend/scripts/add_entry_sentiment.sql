@@ -0,0 +1,12 @@
+-- Estimated sentiment of each entry, -1 to 1, and when the entry's content
+-- was last analyzed. Existing entries have no analyzed_at, which marks them as
+-- pending: the server analyzes pending entries in the background on its next
+-- start.
+ALTER TABLE `journal_entries`
+  ADD COLUMN `sentiment` double DEFAULT NULL AFTER `mood_intensity`,
+  ADD COLUMN `analyzed_at` timestamp NULL DEFAULT NULL AFTER `word_count`,
+  ADD INDEX `idx_entry_analyzed` (`analyzed_at`);
+
+ALTER TABLE `daily_entry_stats`
+  ADD COLUMN `sentiment_sum` double NOT NULL DEFAULT 0,
+  ADD COLUMN `sentiment_entries` bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- Character, sentence and reading-time counts and readability of each entry,
+-- measured from its content with the Markdown stripped.
+ALTER TABLE `journal_entries`
+  ADD COLUMN `character_count` int unsigned NOT NULL DEFAULT 0 AFTER `word_count`,
+  ADD COLUMN `sentence_count` int unsigned NOT NULL DEFAULT 0 AFTER `character_count`,
+  ADD COLUMN `reading_seconds` int unsigned NOT NULL DEFAULT 0 AFTER `sentence_count`,
+  ADD COLUMN `readability` double DEFAULT NULL AFTER `reading_seconds`;
+
+-- Word counts now ignore Markdown, so every entry is re-analyzed. Clearing
+-- analyzed_at marks an entry as pending; the server analyzes pending entries
+-- in the background on its next start, moving the change in their words and
+-- sentiment into daily_entry_stats one entry at a time.
+UPDATE `journal_entries` SET `analyzed_at` = NULL;
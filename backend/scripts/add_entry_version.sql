@@ -0,0 +1,4 @@
+-- Version counter for optimistic concurrency control. Existing entries start
+-- at version 1, the same as new ones.
+ALTER TABLE `journal_entries`
+  ADD COLUMN `version` int unsigned NOT NULL DEFAULT 1 AFTER `word_count`;
@@ -0,0 +1,14 @@
+-- Add user roles and read-only entry sharing. Admins are promoted by hand:
+--   UPDATE `users` SET `role` = 'admin' WHERE `email` = '...';
+ALTER TABLE `users`
+  ADD COLUMN `role` varchar(20) NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS `entry_shares` (
+  `entry_id` bigint unsigned NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`entry_id`, `user_id`),
+  KEY `idx_entry_share_user` (`user_id`),
+  CONSTRAINT `fk_entry_shares_entry` FOREIGN KEY (`entry_id`) REFERENCES `journal_entries` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_entry_shares_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
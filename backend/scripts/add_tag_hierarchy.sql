@@ -0,0 +1,30 @@
+-- Nest hierarchical tags such as "project/alpha" under their parent path.
+-- Run after normalize_tags.sql.
+ALTER TABLE `tags`
+  ADD COLUMN `parent_id` bigint unsigned DEFAULT NULL AFTER `user_id`,
+  ADD INDEX `idx_tag_parent` (`parent_id`),
+  ADD CONSTRAINT `fk_tags_parent` FOREIGN KEY (`parent_id`) REFERENCES `tags` (`id`);
+
+-- Create the ancestors of existing hierarchical tags that are missing, so
+-- "a/b/c" gets "a/b" and "a"
+INSERT IGNORE INTO `tags` (`user_id`, `name`, `created_at`, `updated_at`)
+WITH RECURSIVE `ancestors` (`user_id`, `name`) AS (
+  SELECT `user_id`, LEFT(`name`, CHAR_LENGTH(`name`) - CHAR_LENGTH(SUBSTRING_INDEX(`name`, '/', -1)) - 1)
+  FROM `tags`
+  WHERE `name` LIKE '%/%'
+  UNION
+  SELECT `user_id`, LEFT(`name`, CHAR_LENGTH(`name`) - CHAR_LENGTH(SUBSTRING_INDEX(`name`, '/', -1)) - 1)
+  FROM `ancestors`
+  WHERE `name` LIKE '%/%'
+)
+SELECT `user_id`, `name`, NOW(), NOW()
+FROM `ancestors`
+WHERE `name` <> '';
+
+-- Link every hierarchical tag to its parent
+UPDATE `tags` `child`
+JOIN `tags` `parent`
+  ON `parent`.`user_id` = `child`.`user_id`
+  AND `parent`.`name` = LEFT(`child`.`name`, CHAR_LENGTH(`child`.`name`) - CHAR_LENGTH(SUBSTRING_INDEX(`child`.`name`, '/', -1)) - 1)
+SET `child`.`parent_id` = `parent`.`id`
+WHERE `child`.`name` LIKE '%/%';
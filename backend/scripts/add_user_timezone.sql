@@ -0,0 +1,4 @@
+-- Each user's IANA timezone, used for day boundaries and the date of new
+-- entries
+ALTER TABLE `user_preferences`
+  ADD COLUMN `timezone` varchar(64) DEFAULT 'UTC' AFTER `email_notifications`;
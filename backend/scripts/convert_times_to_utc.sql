@@ -0,0 +1,43 @@
+-- The API used to write times in the zone of the machine it ran on and now
+-- writes them in UTC. TIMESTAMP columns store instants and need no change,
+-- but DATETIME columns hold the clock time as written, so the ones in tables
+-- from before the switch are converted from that zone to UTC. Run this once,
+-- before add_entry_dates.sql.
+--
+-- @app_zone is the zone the API ran in. Change it when that is not the
+-- database server's own zone, e.g. to 'Europe/Berlin' (named zones need the
+-- time zone tables loaded) or '+02:00'.
+SET @app_zone = @@global.time_zone;
+
+DROP PROCEDURE IF EXISTS `convert_datetimes_to_utc`;
+
+DELIMITER //
+CREATE PROCEDURE `convert_datetimes_to_utc`(IN `target` varchar(64))
+BEGIN
+  IF CONVERT_TZ('2000-01-01 00:00:00', @app_zone, '+00:00') IS NULL THEN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Unknown time zone in @app_zone';
+  END IF;
+
+  SET @assignments = NULL;
+  SELECT GROUP_CONCAT(CONCAT('`', `COLUMN_NAME`, '` = CONVERT_TZ(`', `COLUMN_NAME`, '`, @app_zone, ''+00:00'')'))
+  INTO @assignments
+  FROM `information_schema`.`COLUMNS`
+  WHERE `TABLE_SCHEMA` = DATABASE() AND `TABLE_NAME` = `target` AND `DATA_TYPE` = 'datetime';
+
+  IF @assignments IS NOT NULL THEN
+    SET @convert = CONCAT('UPDATE `', `target`, '` SET ', @assignments);
+    PREPARE `stmt` FROM @convert;
+    EXECUTE `stmt`;
+    DEALLOCATE PREPARE `stmt`;
+  END IF;
+END //
+DELIMITER ;
+
+CALL `convert_datetimes_to_utc`('users');
+CALL `convert_datetimes_to_utc`('user_preferences');
+CALL `convert_datetimes_to_utc`('categories');
+CALL `convert_datetimes_to_utc`('tags');
+CALL `convert_datetimes_to_utc`('journal_entries');
+CALL `convert_datetimes_to_utc`('journal_entry_tags');
+
+DROP PROCEDURE `convert_datetimes_to_utc`;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS `attachments` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `entry_id` bigint unsigned NOT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `file_name` varchar(255) NOT NULL,
+  `content_type` varchar(100) NOT NULL,
+  `size` bigint NOT NULL,
+  `storage_key` varchar(255) NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_attachment_storage_key` (`storage_key`),
+  KEY `idx_attachment_entry` (`entry_id`),
+  KEY `idx_attachment_user` (`user_id`),
+  KEY `idx_attachments_deleted_at` (`deleted_at`),
+  CONSTRAINT `fk_attachments_entry` FOREIGN KEY (`entry_id`) REFERENCES `journal_entries` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_attachments_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+-- Pending shares with emails that have no account yet. They are turned into
+-- entry_shares when someone registers with the email.
+CREATE TABLE IF NOT EXISTS `entry_invites` (
+  `entry_id` bigint unsigned NOT NULL,
+  `email` varchar(255) NOT NULL,
+  `created_at` datetime(3) DEFAULT NULL,
+  PRIMARY KEY (`entry_id`, `email`),
+  KEY `idx_entry_invite_email` (`email`),
+  CONSTRAINT `fk_entry_invites_entry` FOREIGN KEY (`entry_id`) REFERENCES `journal_entries` (`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS `goals` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `metric` varchar(20) NOT NULL,
+  `period` varchar(20) NOT NULL,
+  `target` int unsigned NOT NULL,
+  `weekdays` varchar(27) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_goal_user` (`user_id`),
+  KEY `idx_goals_deleted_at` (`deleted_at`),
+  CONSTRAINT `fk_goals_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
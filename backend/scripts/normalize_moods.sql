@@ -0,0 +1,62 @@
+-- Per-user mood vocabulary and an optional 1-10 mood intensity on entries
+CREATE TABLE IF NOT EXISTS `moods` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) DEFAULT NULL,
+  `updated_at` datetime(3) DEFAULT NULL,
+  `deleted_at` datetime(3) DEFAULT NULL,
+  `user_id` bigint unsigned NOT NULL,
+  `name` varchar(50) NOT NULL,
+  `emoji` varchar(16) DEFAULT NULL,
+  `color` varchar(7) NOT NULL,
+  `valence` int NOT NULL DEFAULT 0,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_mood_user_name` (`user_id`, `name`),
+  KEY `idx_moods_deleted_at` (`deleted_at`),
+  CONSTRAINT `fk_moods_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+ALTER TABLE `journal_entries`
+  ADD COLUMN `mood_intensity` tinyint unsigned DEFAULT NULL AFTER `mood`;
+
+-- Trim moods so "happy " and "happy" are the same mood
+UPDATE `journal_entries` SET `mood` = TRIM(`mood`) WHERE `mood` <> TRIM(`mood`);
+
+-- Give every user the default moods
+INSERT IGNORE INTO `moods` (`created_at`, `updated_at`, `user_id`, `name`, `emoji`, `color`, `valence`)
+SELECT NOW(3), NOW(3), u.`id`, d.`name`, d.`emoji`, d.`color`, d.`valence`
+FROM `users` u
+CROSS JOIN (
+  SELECT 'Happy' AS `name`, '😊' AS `emoji`, '#FFD700' AS `color`, 2 AS `valence`
+  UNION ALL SELECT 'Sad', '😢', '#4169E1', -2
+  UNION ALL SELECT 'Angry', '😠', '#DC143C', -2
+  UNION ALL SELECT 'Excited', '🤩', '#FF8C00', 2
+  UNION ALL SELECT 'Peaceful', '😌', '#3CB371', 1
+  UNION ALL SELECT 'Neutral', '😐', '#A9A9A9', 0
+  UNION ALL SELECT 'Anxious', '😟', '#9370DB', -1
+  UNION ALL SELECT 'Grateful', '🙏', '#FF69B4', 2
+  UNION ALL SELECT 'Frustrated', '😤', '#CD5C5C', -1
+  UNION ALL SELECT 'Hopeful', '🌱', '#00CED1', 1
+) d;
+
+-- Keep any other mood already in use, with a neutral valence. Spellings that
+-- only differ by case become one mood.
+INSERT IGNORE INTO `moods` (`created_at`, `updated_at`, `user_id`, `name`, `color`, `valence`)
+SELECT NOW(3), NOW(3), `user_id`, MIN(`mood`), '#A9A9A9', 0
+FROM `journal_entries`
+WHERE `mood` <> ''
+GROUP BY `user_id`, LOWER(`mood`);
+
+-- Spell every entry's mood the way the vocabulary does
+UPDATE `journal_entries` je
+JOIN `moods` m ON m.`user_id` = je.`user_id` AND LOWER(m.`name`) = LOWER(je.`mood`)
+SET je.`mood` = m.`name`
+WHERE je.`mood` <> m.`name`;
+
+-- Recount the daily stats under the normalized moods
+DELETE FROM `daily_entry_stats`;
+
+INSERT INTO `daily_entry_stats` (`user_id`, `entry_date`, `category_id`, `mood`, `entries`, `words`)
+SELECT `user_id`, `entry_date`, COALESCE(`category_id`, 0), LEFT(COALESCE(`mood`, ''), 100), COUNT(*), COALESCE(SUM(`word_count`), 0)
+FROM `journal_entries`
+WHERE `is_draft` = FALSE AND `deleted_at` IS NULL
+GROUP BY `user_id`, `entry_date`, COALESCE(`category_id`, 0), LEFT(COALESCE(`mood`, ''), 100);
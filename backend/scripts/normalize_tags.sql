@@ -0,0 +1,28 @@
+-- Normalize existing tag names (trimmed, lower-case) and fold tags that only
+-- differed by case or surrounding whitespace into the oldest one
+CREATE TEMPORARY TABLE `tag_keepers` AS
+SELECT `user_id`, LOWER(TRIM(`name`)) AS `norm`, MIN(`id`) AS `id`
+FROM `tags`
+GROUP BY `user_id`, LOWER(TRIM(`name`));
+
+-- Point entries at the surviving tag
+INSERT IGNORE INTO `journal_entry_tags` (`entry_id`, `tag_id`)
+SELECT jet.`entry_id`, k.`id`
+FROM `journal_entry_tags` jet
+JOIN `tags` t ON t.`id` = jet.`tag_id`
+JOIN `tag_keepers` k ON k.`user_id` = t.`user_id` AND k.`norm` = LOWER(TRIM(t.`name`))
+WHERE t.`id` <> k.`id`;
+
+-- Drop links to and rows of the duplicates
+DELETE jet FROM `journal_entry_tags` jet
+JOIN `tags` t ON t.`id` = jet.`tag_id`
+JOIN `tag_keepers` k ON k.`user_id` = t.`user_id` AND k.`norm` = LOWER(TRIM(t.`name`))
+WHERE t.`id` <> k.`id`;
+
+DELETE t FROM `tags` t
+JOIN `tag_keepers` k ON k.`user_id` = t.`user_id` AND k.`norm` = LOWER(TRIM(t.`name`))
+WHERE t.`id` <> k.`id`;
+
+UPDATE `tags` SET `name` = LOWER(TRIM(`name`));
+
+DROP TEMPORARY TABLE `tag_keepers`;
@@ -0,0 +1,15 @@
+-- Make category names unique per user. Existing duplicates (ignoring case)
+-- keep the oldest name; later ones get their id appended so nothing is lost.
+UPDATE `categories` c
+JOIN (
+  SELECT `user_id`, LOWER(`name`) AS `norm`, MIN(`id`) AS `keep_id`
+  FROM `categories`
+  GROUP BY `user_id`, LOWER(`name`)
+  HAVING COUNT(*) > 1
+) d ON d.`user_id` = c.`user_id` AND d.`norm` = LOWER(c.`name`)
+SET c.`name` = CONCAT(c.`name`, ' (', c.`id`, ')')
+WHERE c.`id` <> d.`keep_id`;
+
+ALTER TABLE `categories`
+  ADD COLUMN `archived_at` datetime(3) DEFAULT NULL,
+  ADD UNIQUE KEY `idx_category_user_name` (`user_id`, `name`);
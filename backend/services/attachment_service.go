@@ -0,0 +1,346 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"journal/models"
+	"journal/pkg/blobstore"
+	"journal/policy"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxAttachmentSize is the largest file that can be attached to an entry
+	MaxAttachmentSize = 10 << 20
+	// attachmentQuota is how many bytes of attachments each user may store
+	attachmentQuota = 200 << 20
+	// sniffLength is how much of a file http.DetectContentType looks at
+	sniffLength = 512
+)
+
+// allowedAttachmentTypes are the content types, as sniffed from the file
+// itself, that may be attached. Whatever type the client claims is ignored.
+var allowedAttachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"application/ogg": true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+var (
+	ErrEmptyAttachment           = errors.New("attachment is empty")
+	ErrAttachmentTooLarge        = errors.New("attachment is too large")
+	ErrAttachmentQuotaExceeded   = errors.New("attachment quota exceeded")
+	ErrUnsupportedAttachmentType = errors.New("unsupported attachment type")
+)
+
+type AttachmentService struct {
+	db    *gorm.DB
+	blobs blobstore.BlobStore
+}
+
+func NewAttachmentService(db *gorm.DB, blobs blobstore.BlobStore) *AttachmentService {
+	return &AttachmentService{db: db, blobs: blobs}
+}
+
+// UploadAttachment stores a file of the given size and attaches it to an
+// entry. The file counts against the entry owner's quota.
+func (s *AttachmentService) UploadAttachment(entryID uint, actor policy.Actor, fileName string, content io.Reader, size int64) (*models.AttachmentDTO, error) {
+	var entry models.JournalEntry
+	if err := loadEntry(s.db, actor, policy.CanWrite, entryID, &entry); err != nil {
+		return nil, err
+	}
+
+	if err := checkAttachmentSize(size); err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	contentType, err := sniffAttachment(head[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the quota before uploading so a full account fails fast; it is
+	// checked again under a lock before the attachment is recorded
+	used, err := attachmentBytes(s.db, entry.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuota(used, size); err != nil {
+		return nil, err
+	}
+
+	key, err := newStorageKey(entry.UserID)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if err := s.blobs.Put(ctx, key, io.MultiReader(bytes.NewReader(head[:n]), content), size, contentType); err != nil {
+		return nil, err
+	}
+
+	attachment := models.Attachment{
+		EntryID:     entry.ID,
+		UserID:      entry.UserID,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		Size:        size,
+		StorageKey:  key,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the owner serializes uploads so concurrent ones cannot
+		// overrun the quota together
+		var owner models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			First(&owner, entry.UserID).Error; err != nil {
+			return err
+		}
+
+		used, err := attachmentBytes(tx, entry.UserID)
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(used, size); err != nil {
+			return err
+		}
+		return tx.Create(&attachment).Error
+	})
+	if err != nil {
+		deleteBlobs(s.blobs, []string{key})
+		return nil, err
+	}
+
+	return convertAttachmentToDTO(&attachment), nil
+}
+
+// ListAttachments lists the files attached to an entry, oldest first
+func (s *AttachmentService) ListAttachments(entryID uint, actor policy.Actor) ([]models.AttachmentDTO, error) {
+	var entry models.JournalEntry
+	if err := loadEntry(s.db, actor, policy.CanRead, entryID, &entry); err != nil {
+		return nil, err
+	}
+
+	var attachments []models.Attachment
+	if err := s.db.Where("entry_id = ?", entry.ID).
+		Order("created_at, id").
+		Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+
+	dtos := make([]models.AttachmentDTO, 0, len(attachments))
+	for i := range attachments {
+		dtos = append(dtos, *convertAttachmentToDTO(&attachments[i]))
+	}
+	return dtos, nil
+}
+
+// OpenAttachment returns an attachment and its content, which the caller
+// must close. Anyone who can read the entry can download its attachments.
+func (s *AttachmentService) OpenAttachment(entryID, attachmentID uint, actor policy.Actor) (*models.AttachmentDTO, io.ReadCloser, error) {
+	attachment, err := s.loadAttachment(entryID, attachmentID, actor, policy.CanRead)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := s.blobs.Get(context.Background(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, nil, fmt.Errorf("attachment %d has no stored file: %w", attachment.ID, err)
+		}
+		return nil, nil, err
+	}
+	return convertAttachmentToDTO(attachment), content, nil
+}
+
+// DeleteAttachment removes an attachment and its file
+func (s *AttachmentService) DeleteAttachment(entryID, attachmentID uint, actor policy.Actor) error {
+	attachment, err := s.loadAttachment(entryID, attachmentID, actor, policy.CanWrite)
+	if err != nil {
+		return err
+	}
+
+	keys, err := removeAttachmentRows(s.db, "id = ?", attachment.ID)
+	if err != nil {
+		return err
+	}
+	deleteBlobs(s.blobs, keys)
+	return nil
+}
+
+// GetAttachmentUsage reports how much of their quota a user has used
+func (s *AttachmentService) GetAttachmentUsage(userID uint) (*models.AttachmentUsageDTO, error) {
+	usage := models.AttachmentUsageDTO{Quota: attachmentQuota}
+	if err := s.db.Model(&models.Attachment{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0) AS used, COUNT(*) AS attachments").
+		Scan(&usage).Error; err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// loadAttachment loads an attachment of an entry the actor may use. An
+// attachment of a different entry is reported as not found.
+func (s *AttachmentService) loadAttachment(entryID, attachmentID uint, actor policy.Actor, check policy.Check) (*models.Attachment, error) {
+	var entry models.JournalEntry
+	if err := loadEntry(s.db, actor, check, entryID, &entry); err != nil {
+		return nil, err
+	}
+
+	var attachment models.Attachment
+	if err := s.db.Where("entry_id = ?", entry.ID).First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, policy.NotFound("attachment", attachmentID)
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// attachmentBytes adds up the size of a user's attachments
+func attachmentBytes(db *gorm.DB, userID uint) (int64, error) {
+	var used int64
+	err := db.Model(&models.Attachment{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used).Error
+	return used, err
+}
+
+// removeAttachmentRows deletes the attachments matching the condition for
+// good and returns their storage keys. The files themselves are left for the
+// caller to delete once the surrounding transaction has committed, so a
+// rollback never leaves rows pointing at missing files.
+func removeAttachmentRows(tx *gorm.DB, query string, args ...interface{}) ([]string, error) {
+	var keys []string
+	if err := tx.Model(&models.Attachment{}).
+		Where(query, args...).
+		Pluck("storage_key", &keys).Error; err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Unscoped().
+		Where("storage_key IN ?", keys).
+		Delete(&models.Attachment{}).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// deleteBlobs removes stored files. Failures only leave unreferenced files
+// behind, so they are logged rather than returned.
+func deleteBlobs(blobs blobstore.BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete attachment file %s: %v", key, err)
+		}
+	}
+}
+
+// newStorageKey picks an unguessable key for a new file of a user
+// checkAttachmentSize rejects empty files and files over MaxAttachmentSize
+func checkAttachmentSize(size int64) error {
+	if size <= 0 {
+		return ErrEmptyAttachment
+	}
+	if size > MaxAttachmentSize {
+		return ErrAttachmentTooLarge
+	}
+	return nil
+}
+
+// sniffAttachment works out the content type from the start of a file and
+// rejects types that are not allowed
+func sniffAttachment(head []byte) (string, error) {
+	if len(head) == 0 {
+		return "", ErrEmptyAttachment
+	}
+	contentType := http.DetectContentType(head)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !allowedAttachmentTypes[mediaType] {
+		return "", ErrUnsupportedAttachmentType
+	}
+	return contentType, nil
+}
+
+// checkQuota rejects a file of the given size when a user who already
+// stores used bytes has no room left for it
+func checkQuota(used, size int64) error {
+	if used+size > attachmentQuota {
+		return ErrAttachmentQuotaExceeded
+	}
+	return nil
+}
+
+func newStorageKey(userID uint) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("users/%d/%s", userID, hex.EncodeToString(random)), nil
+}
+
+// cleanFileName keeps the base name of an uploaded file without control
+// characters, shortened to fit the column
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+
+	for len(name) > 255 {
+		_, width := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-width]
+	}
+	return name
+}
+
+func convertAttachmentToDTO(attachment *models.Attachment) *models.AttachmentDTO {
+	return &models.AttachmentDTO{
+		ID:          attachment.ID,
+		EntryID:     attachment.EntryID,
+		FileName:    attachment.FileName,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		URL:         fmt.Sprintf("/api/entries/%d/attachments/%d", attachment.EntryID, attachment.ID),
+		CreatedAt:   attachment.CreatedAt,
+	}
+}
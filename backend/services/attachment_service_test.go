@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSniffAttachment(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+		err  error
+	}{
+		{name: "png", head: "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", want: "image/png"},
+		{name: "jpeg", head: "\xff\xd8\xff\xe0\x00\x10JFIF", want: "image/jpeg"},
+		{name: "pdf", head: "%PDF-1.7\n", want: "application/pdf"},
+		{name: "plain text", head: "Dear diary, today was long.", want: "text/plain; charset=utf-8"},
+		{name: "html", head: "<html><script>alert(1)</script>", err: ErrUnsupportedAttachmentType},
+		{name: "svg", head: `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"/>`, err: ErrUnsupportedAttachmentType},
+		{name: "executable", head: "MZ\x90\x00\x03\x00\x00\x00", err: ErrUnsupportedAttachmentType},
+		{name: "zip", head: "PK\x03\x04\x14\x00", err: ErrUnsupportedAttachmentType},
+		{name: "empty", head: "", err: ErrEmptyAttachment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sniffAttachment([]byte(tt.head))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("sniffAttachment(%q) error = %v, want %v", tt.head, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("sniffAttachment(%q) = %q, want %q", tt.head, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAttachmentSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want error
+	}{
+		{-1, ErrEmptyAttachment},
+		{0, ErrEmptyAttachment},
+		{1, nil},
+		{MaxAttachmentSize, nil},
+		{MaxAttachmentSize + 1, ErrAttachmentTooLarge},
+	}
+
+	for _, tt := range tests {
+		if err := checkAttachmentSize(tt.size); !errors.Is(err, tt.want) {
+			t.Errorf("checkAttachmentSize(%d) = %v, want %v", tt.size, err, tt.want)
+		}
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	tests := []struct {
+		name string
+		used int64
+		size int64
+		want error
+	}{
+		{name: "nothing stored", used: 0, size: MaxAttachmentSize, want: nil},
+		{name: "fills the quota exactly", used: attachmentQuota - 100, size: 100, want: nil},
+		{name: "one byte over", used: attachmentQuota - 100, size: 101, want: ErrAttachmentQuotaExceeded},
+		{name: "already full", used: attachmentQuota, size: 1, want: ErrAttachmentQuotaExceeded},
+		{name: "already over", used: attachmentQuota + 1, size: 1, want: ErrAttachmentQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkQuota(tt.used, tt.size); !errors.Is(err, tt.want) {
+				t.Errorf("checkQuota(%d, %d) = %v, want %v", tt.used, tt.size, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanFileName(t *testing.T) {
+	long := strings.Repeat("a", 254) + "é"
+
+	tests := []struct {
+		name     string
+		fileName string
+		want     string
+	}{
+		{name: "plain", fileName: "photo.jpg", want: "photo.jpg"},
+		{name: "unix path", fileName: "/home/me/photo.jpg", want: "photo.jpg"},
+		{name: "windows path", fileName: `C:\Users\me\photo.jpg`, want: "photo.jpg"},
+		{name: "traversal", fileName: "../../etc/passwd", want: "passwd"},
+		{name: "control characters", fileName: "pho\x00to\r\n.jpg", want: "photo.jpg"},
+		{name: "surrounding spaces", fileName: "  notes.txt  ", want: "notes.txt"},
+		{name: "empty", fileName: "", want: "attachment"},
+		{name: "only a slash", fileName: "/", want: "attachment"},
+		{name: "only a dot", fileName: ".", want: "attachment"},
+		{name: "only control characters", fileName: "\x01\x02", want: "attachment"},
+		{name: "too long", fileName: strings.Repeat("x", 300), want: strings.Repeat("x", 255)},
+		{name: "too long in a multi-byte rune", fileName: long, want: strings.Repeat("a", 254)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanFileName(tt.fileName); got != tt.want {
+				t.Errorf("cleanFileName(%q) = %q, want %q", tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
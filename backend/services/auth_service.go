@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"journal/models"
+	"journal/policy"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -21,8 +22,9 @@ func NewAuthService(userService *UserService) *AuthService {
 }
 
 type Claims struct {
-	UserID uint   `json:"userId"`
-	Email  string `json:"email"`
+	UserID uint        `json:"userId"`
+	Email  string      `json:"email"`
+	Role   policy.Role `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -30,6 +32,7 @@ func (s *AuthService) GenerateToken(user *models.User) (string, error) {
 	claims := Claims{
 		UserID: user.ID,
 		Email:  user.Email,
+		Role:   policy.Role(user.Role),
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"journal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidYear is returned for calendar years outside a sensible range
+var ErrInvalidYear = errors.New("invalid year")
+
+// GetEntryCalendar returns entry and word counts for every day of year, for
+// drawing a heatmap, along with the user's writing streaks. A zero year means
+// the current year in the user's timezone.
+func (s *JournalService) GetEntryCalendar(userID uint, year int) (*models.CalendarDTO, error) {
+	today := calendarDate(time.Now().In(userLocation(s.db, userID)))
+	if year == 0 {
+		year = today.Year()
+	}
+	if year < 1900 || year > 9999 {
+		return nil, ErrInvalidYear
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+	var rows []struct {
+		EntryDate time.Time
+		Entries   int64
+		Words     int64
+	}
+	if err := s.db.Model(&models.DailyEntryStats{}).
+		Where("user_id = ? AND entry_date BETWEEN ? AND ?", userID, start, end).
+		Select("entry_date, SUM(entries) as entries, SUM(words) as words").
+		Group("entry_date").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	calendar := &models.CalendarDTO{Year: year}
+
+	days := make([]models.CalendarDayDTO, 0, 366)
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		days = append(days, models.CalendarDayDTO{Date: day.Format("2006-01-02")})
+	}
+	for _, row := range rows {
+		i := int(calendarDate(row.EntryDate).Sub(start).Hours() / 24)
+		if i < 0 || i >= len(days) {
+			continue
+		}
+		days[i].Entries = row.Entries
+		days[i].Words = row.Words
+		calendar.TotalEntries += row.Entries
+		calendar.ActiveDays++
+	}
+	calendar.Days = days
+
+	dates, err := activeDates(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	calendar.CurrentStreak, calendar.LongestStreak = entryStreaks(dates, today)
+
+	return calendar, nil
+}
+
+// publishedEntryDates returns the distinct days of userID's published
+// entries matching scopes, in order. Unfiltered callers should use the
+// cheaper activeDates.
+func publishedEntryDates(db *gorm.DB, userID uint, scopes ...func(*gorm.DB) *gorm.DB) ([]time.Time, error) {
+	var dates []time.Time
+	if err := db.Model(&models.JournalEntry{}).
+		Scopes(publishedOnly).
+		Scopes(scopes...).
+		Where("journal_entries.user_id = ?", userID).
+		Distinct("journal_entries.entry_date").
+		Order("journal_entries.entry_date").
+		Pluck("journal_entries.entry_date", &dates).Error; err != nil {
+		return nil, err
+	}
+	return dates, nil
+}
+
+// entryStreaks counts runs of consecutive days among dates, which must be
+// sorted. Entry dates are already days in the writer's timezone, and today is
+// the current day in the user's timezone. The current streak stays alive
+// until a whole day passes without an entry, so it still counts on a day the
+// user has not written yet.
+func entryStreaks(dates []time.Time, today time.Time) (current, longest int) {
+	run := 0
+	var previous time.Time
+	for _, date := range dates {
+		date = calendarDate(date)
+		if run > 0 && date.Equal(previous.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		previous = date
+	}
+
+	// Entries dated in the future neither extend nor break the current streak
+	end := len(dates)
+	for end > 0 && calendarDate(dates[end-1]).After(today) {
+		end--
+	}
+	dates = dates[:end]
+	if len(dates) == 0 {
+		return 0, longest
+	}
+
+	last := calendarDate(dates[len(dates)-1])
+	if last.Before(today.AddDate(0, 0, -1)) {
+		return 0, longest
+	}
+	current = 1
+	for i := len(dates) - 2; i >= 0; i-- {
+		date := calendarDate(dates[i])
+		if !date.Equal(last.AddDate(0, 0, -1)) {
+			break
+		}
+		current++
+		last = date
+	}
+
+	return current, longest
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"journal/models"
+)
+
+func TestEntryStreaks(t *testing.T) {
+	tests := []struct {
+		name        string
+		dates       []string
+		today       string
+		wantCurrent int
+		wantLongest int
+	}{
+		{name: "no entries", today: "2024-05-15"},
+		{name: "only today", dates: []string{"2024-05-15"}, today: "2024-05-15", wantCurrent: 1, wantLongest: 1},
+		{
+			name:        "streak ending today",
+			dates:       []string{"2024-05-13", "2024-05-14", "2024-05-15"},
+			today:       "2024-05-15",
+			wantCurrent: 3,
+			wantLongest: 3,
+		},
+		{
+			name:        "streak ending yesterday is still current",
+			dates:       []string{"2024-05-13", "2024-05-14"},
+			today:       "2024-05-15",
+			wantCurrent: 2,
+			wantLongest: 2,
+		},
+		{
+			name:        "a whole day without entries ends the streak",
+			dates:       []string{"2024-05-12", "2024-05-13"},
+			today:       "2024-05-15",
+			wantCurrent: 0,
+			wantLongest: 2,
+		},
+		{
+			name:        "longest streak in the past",
+			dates:       []string{"2024-04-01", "2024-04-02", "2024-04-03", "2024-04-04", "2024-05-14", "2024-05-15"},
+			today:       "2024-05-15",
+			wantCurrent: 2,
+			wantLongest: 4,
+		},
+		{
+			name:        "gap inside the current run",
+			dates:       []string{"2024-05-11", "2024-05-12", "2024-05-14", "2024-05-15"},
+			today:       "2024-05-15",
+			wantCurrent: 2,
+			wantLongest: 2,
+		},
+		{
+			name:        "across a month and year boundary",
+			dates:       []string{"2023-12-30", "2023-12-31", "2024-01-01"},
+			today:       "2024-01-02",
+			wantCurrent: 3,
+			wantLongest: 3,
+		},
+		{
+			name:        "across a leap day",
+			dates:       []string{"2024-02-28", "2024-02-29", "2024-03-01"},
+			today:       "2024-03-01",
+			wantCurrent: 3,
+			wantLongest: 3,
+		},
+		{
+			name:        "future entries neither extend nor break the current streak",
+			dates:       []string{"2024-05-14", "2024-05-15", "2024-05-16", "2024-05-20"},
+			today:       "2024-05-15",
+			wantCurrent: 2,
+			wantLongest: 3,
+		},
+		{
+			name:        "only future entries",
+			dates:       []string{"2024-06-01"},
+			today:       "2024-05-15",
+			wantCurrent: 0,
+			wantLongest: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dates []time.Time
+			for _, date := range tt.dates {
+				dates = append(dates, day(t, date))
+			}
+
+			current, longest := entryStreaks(dates, day(t, tt.today))
+			if current != tt.wantCurrent || longest != tt.wantLongest {
+				t.Errorf("entryStreaks() = %d, %d, want %d, %d", current, longest, tt.wantCurrent, tt.wantLongest)
+			}
+		})
+	}
+}
+
+func TestEntryStreaksIgnoreClock(t *testing.T) {
+	// Dates read back from the database may carry a zone; only the day counts
+	zone := time.FixedZone("UTC+9", 9*60*60)
+	dates := []time.Time{
+		time.Date(2024, 5, 14, 0, 0, 0, 0, zone),
+		time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC),
+	}
+	if current, longest := entryStreaks(dates, time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)); current != 2 || longest != 2 {
+		t.Errorf("entryStreaks() = %d, %d, want 2, 2", current, longest)
+	}
+}
+
+func TestApplyEntryDate(t *testing.T) {
+	instant := func(value string) time.Time {
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+
+	tests := []struct {
+		name     string
+		existing string
+		input    EntryDateInput
+		fallback string
+		now      string
+		wantDate string
+		wantTime string
+		wantZone string
+		wantErr  error
+	}{
+		{
+			name:     "now in the entry's zone",
+			input:    EntryDateInput{Timezone: "Asia/Tokyo"},
+			now:      "2024-05-15T22:30:00Z",
+			wantDate: "2024-05-16", wantTime: "07:30:00", wantZone: "Asia/Tokyo",
+		},
+		{
+			name:     "now behind UTC",
+			input:    EntryDateInput{Timezone: "America/New_York"},
+			now:      "2024-01-01T03:00:00Z",
+			wantDate: "2023-12-31", wantTime: "22:00:00", wantZone: "America/New_York",
+		},
+		{
+			name:     "fallback zone",
+			fallback: "Pacific/Kiritimati",
+			now:      "2024-12-31T10:00:00Z",
+			wantDate: "2025-01-01", wantTime: "00:00:00", wantZone: "Pacific/Kiritimati",
+		},
+		{
+			name:     "default zone",
+			now:      "2024-05-15T22:30:00Z",
+			wantDate: "2024-05-15", wantTime: "22:30:00", wantZone: "UTC",
+		},
+		{
+			name:     "last minute before clocks go forward",
+			input:    EntryDateInput{Timezone: "America/Los_Angeles"},
+			now:      "2024-03-10T09:59:00Z",
+			wantDate: "2024-03-10", wantTime: "01:59:00", wantZone: "America/Los_Angeles",
+		},
+		{
+			name:     "first minute after clocks go forward",
+			input:    EntryDateInput{Timezone: "America/Los_Angeles"},
+			now:      "2024-03-10T10:00:00Z",
+			wantDate: "2024-03-10", wantTime: "03:00:00", wantZone: "America/Los_Angeles",
+		},
+		{
+			name:     "first pass through the repeated hour",
+			input:    EntryDateInput{Timezone: "Europe/London"},
+			now:      "2024-10-27T00:30:00Z",
+			wantDate: "2024-10-27", wantTime: "01:30:00", wantZone: "Europe/London",
+		},
+		{
+			name:     "second pass through the repeated hour",
+			input:    EntryDateInput{Timezone: "Europe/London"},
+			now:      "2024-10-27T01:30:00Z",
+			wantDate: "2024-10-27", wantTime: "01:30:00", wantZone: "Europe/London",
+		},
+		{
+			name:     "explicit wall clock is kept in a skipped hour",
+			input:    EntryDateInput{Date: "2024-03-10", Time: "02:30", Timezone: "America/New_York"},
+			now:      "2024-06-01T12:00:00Z",
+			wantDate: "2024-03-10", wantTime: "02:30:00", wantZone: "America/New_York",
+		},
+		{
+			name:     "explicit date without time",
+			input:    EntryDateInput{Date: "2024-02-29", Timezone: "Australia/Sydney"},
+			now:      "2024-06-01T12:00:00Z",
+			wantDate: "2024-02-29", wantZone: "Australia/Sydney",
+		},
+		{
+			name:     "existing date is kept",
+			existing: "2024-01-02",
+			input:    EntryDateInput{Timezone: "Asia/Tokyo"},
+			now:      "2024-06-01T12:00:00Z",
+			wantDate: "2024-01-02", wantZone: "Asia/Tokyo",
+		},
+		{
+			name:    "unknown zone",
+			input:   EntryDateInput{Timezone: "Mars/Olympus_Mons"},
+			now:     "2024-06-01T12:00:00Z",
+			wantErr: ErrInvalidEntryDate,
+		},
+		{
+			name:    "zone outside the database",
+			input:   EntryDateInput{Timezone: "../../etc/passwd"},
+			now:     "2024-06-01T12:00:00Z",
+			wantErr: ErrInvalidEntryDate,
+		},
+		{
+			name:     "unknown fallback zone",
+			fallback: "Nowhere/Special",
+			now:      "2024-06-01T12:00:00Z",
+			wantErr:  ErrInvalidEntryDate,
+		},
+		{
+			name:    "invalid date",
+			input:   EntryDateInput{Date: "2024-02-30", Timezone: "UTC"},
+			now:     "2024-06-01T12:00:00Z",
+			wantErr: ErrInvalidEntryDate,
+		},
+		{
+			name:    "invalid time",
+			input:   EntryDateInput{Date: "2024-02-01", Time: "24:00", Timezone: "UTC"},
+			now:     "2024-06-01T12:00:00Z",
+			wantErr: ErrInvalidEntryDate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entry models.JournalEntry
+			if tt.existing != "" {
+				entry.EntryDate = day(t, tt.existing)
+			}
+			err := applyEntryDate(&entry, tt.input, tt.fallback, instant(tt.now))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyEntryDate(%+v) error = %v, want %v", tt.input, err, tt.wantErr)
+			}
+			if err != nil {
+				if entry.EntryTimezone != "" || !entry.EntryDate.IsZero() {
+					t.Errorf("applyEntryDate(%+v) changed the entry to %s %q after failing", tt.input, entry.EntryDate, entry.EntryTimezone)
+				}
+				return
+			}
+
+			gotTime := ""
+			if entry.EntryTime != nil {
+				gotTime = *entry.EntryTime
+			}
+			gotDate := entry.EntryDate.Format("2006-01-02")
+			if gotDate != tt.wantDate || gotTime != tt.wantTime || entry.EntryTimezone != tt.wantZone {
+				t.Errorf("applyEntryDate(%+v) = %s %q %s, want %s %q %s",
+					tt.input, gotDate, gotTime, entry.EntryTimezone, tt.wantDate, tt.wantTime, tt.wantZone)
+			}
+			if entry.EntryDate.Location() != time.UTC || entry.EntryDate.Hour() != 0 {
+				t.Errorf("applyEntryDate(%+v) date = %v, want midnight UTC", tt.input, entry.EntryDate)
+			}
+		})
+	}
+}
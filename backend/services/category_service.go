@@ -3,137 +3,588 @@ package services
 import (
 	"errors"
 	"journal/models"
+	"journal/policy"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrParentCategoryNotFound = errors.New("parent category not found")
+	ErrCategoryCycle          = errors.New("category cannot be nested under itself")
+	ErrInvalidCategoryOrder   = errors.New("invalid category order")
+	ErrCategoryNameTaken      = errors.New("category name already in use")
+	ErrInvalidCategoryColor   = errors.New("invalid category color")
+	ErrInvalidCategoryName    = errors.New("invalid category name")
+	ErrCategoryArchived       = errors.New("category is archived")
+)
+
+const (
+	// defaultCategoryColor is used for categories created without a color
+	defaultCategoryColor = "#000000"
+	// mysqlDuplicateEntry is MySQL's error number for a unique key violation
+	mysqlDuplicateEntry = 1062
+)
+
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// namedColors maps the CSS color names accepted for categories to the hex
+// value that is stored
+var namedColors = map[string]string{
+	"black":   "#000000",
+	"silver":  "#C0C0C0",
+	"gray":    "#808080",
+	"grey":    "#808080",
+	"white":   "#FFFFFF",
+	"maroon":  "#800000",
+	"red":     "#FF0000",
+	"purple":  "#800080",
+	"fuchsia": "#FF00FF",
+	"magenta": "#FF00FF",
+	"green":   "#008000",
+	"lime":    "#00FF00",
+	"olive":   "#808000",
+	"yellow":  "#FFFF00",
+	"navy":    "#000080",
+	"blue":    "#0000FF",
+	"teal":    "#008080",
+	"aqua":    "#00FFFF",
+	"cyan":    "#00FFFF",
+	"orange":  "#FFA500",
+	"pink":    "#FFC0CB",
+	"brown":   "#A52A2A",
+	"gold":    "#FFD700",
+	"indigo":  "#4B0082",
+	"violet":  "#EE82EE",
+	"coral":   "#FF7F50",
+	"salmon":  "#FA8072",
+	"tomato":  "#FF6347",
+	"crimson": "#DC143C",
+	"khaki":   "#F0E68C",
+	"orchid":  "#DA70D6",
+	"plum":    "#DDA0DD",
+	"tan":     "#D2B48C",
+}
+
 type CategoryService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	stats *StatsCache
 }
 
-func NewCategoryService(db *gorm.DB) *CategoryService {
+func NewCategoryService(db *gorm.DB, stats *StatsCache) *CategoryService {
 	return &CategoryService{
-		db: db,
+		db:    db,
+		stats: stats,
 	}
 }
 
-// GetCategories retrieves all categories for a specific user
-func (s *CategoryService) GetCategories(userID uint) ([]models.CategoryDTO, error) {
+// GetCategories retrieves the categories for a specific user, in display
+// order. Archived categories are left out unless includeArchived is set.
+func (s *CategoryService) GetCategories(userID uint, includeArchived bool) ([]models.CategoryDTO, error) {
 	var categories []models.Category
-	if err := s.db.Where("user_id = ?", userID).Find(&categories).Error; err != nil {
+	query := s.db.Where("user_id = ?", userID)
+	if !includeArchived {
+		query = query.Where("archived_at IS NULL")
+	}
+	if err := query.Order("position, name").Find(&categories).Error; err != nil {
 		return nil, err
 	}
 
 	// Map to DTOs
 	var categoryDTOs []models.CategoryDTO
 	for _, category := range categories {
-		categoryDTOs = append(categoryDTOs, models.CategoryDTO{
-			ID:    category.ID,
-			Name:  category.Name,
-			Color: category.Color,
-		})
+		categoryDTOs = append(categoryDTOs, toCategoryDTO(&category))
 	}
 
 	return categoryDTOs, nil
 }
 
-// GetCategory retrieves a specific category by ID for a user
-func (s *CategoryService) GetCategory(categoryID, userID uint) (*models.CategoryDTO, error) {
+// GetCategory retrieves a specific category by ID
+func (s *CategoryService) GetCategory(categoryID uint, actor policy.Actor) (*models.CategoryDTO, error) {
 	var category models.Category
-	if err := s.db.Where("id = ? AND user_id = ?", categoryID, userID).First(&category).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("category not found")
+	if err := loadAuthorized(s.db, actor, policy.CanRead, &category, categoryID); err != nil {
+		return nil, err
+	}
+
+	dto := toCategoryDTO(&category)
+	return &dto, nil
+}
+
+// GetCategoryStats summarizes the published entries in a category, and in its
+// subcategories when includeSubcategories is set
+func (s *CategoryService) GetCategoryStats(categoryID uint, actor policy.Actor, includeSubcategories bool) (*models.CategoryStatsDTO, error) {
+	var category models.Category
+	if err := loadAuthorized(s.db, actor, policy.CanRead, &category, categoryID); err != nil {
+		return nil, err
+	}
+
+	categoryIDs := []uint{category.ID}
+	if includeSubcategories {
+		var err error
+		if categoryIDs, err = categorySubtreeIDs(s.db, category.UserID, category.ID); err != nil {
+			return nil, err
 		}
+	}
+
+	stats, err := sliceStats(s.db, category.UserID, inCategories(categoryIDs))
+	if err != nil {
 		return nil, err
 	}
 
-	return &models.CategoryDTO{
-		ID:    category.ID,
-		Name:  category.Name,
-		Color: category.Color,
+	return &models.CategoryStatsDTO{
+		Category:              toCategoryDTO(&category),
+		IncludesSubcategories: includeSubcategories,
+		Stats:                 *stats,
 	}, nil
 }
 
-// CreateCategory creates a new category for a user
+// CreateCategory creates a new category for a user, placed after its siblings
 func (s *CategoryService) CreateCategory(userID uint, categoryDTO models.CategoryDTO) (*models.CategoryDTO, error) {
+	name, err := s.checkName(s.db, userID, 0, categoryDTO.Name)
+	if err != nil {
+		return nil, err
+	}
+	categoryDTO.Name = name
+
+	color, err := normalizeCategoryColor(categoryDTO.Color)
+	if err != nil {
+		return nil, err
+	}
+	categoryDTO.Color = color
+
+	if err := s.checkParent(s.db, userID, 0, categoryDTO.ParentID); err != nil {
+		return nil, err
+	}
+
+	position, err := s.nextPosition(s.db, userID, categoryDTO.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create the category model from DTO
 	category := models.Category{
-		UserID: userID,
-		Name:   categoryDTO.Name,
-		Color:  categoryDTO.Color,
+		UserID:   userID,
+		ParentID: categoryDTO.ParentID,
+		Name:     categoryDTO.Name,
+		Color:    categoryDTO.Color,
+		Position: position,
 	}
 
 	// Save to database
 	if err := s.db.Create(&category).Error; err != nil {
-		return nil, err
+		return nil, nameTaken(err)
 	}
+	s.stats.Invalidate(userID)
 
 	// Return the created category as DTO
-	return &models.CategoryDTO{
-		ID:    category.ID,
-		Name:  category.Name,
-		Color: category.Color,
-	}, nil
+	dto := toCategoryDTO(&category)
+	return &dto, nil
 }
 
-// UpdateCategory updates an existing category
-func (s *CategoryService) UpdateCategory(categoryID, userID uint, categoryDTO models.CategoryDTO) (*models.CategoryDTO, error) {
-	// Find the category first to ensure it exists and belongs to the user
+// UpdateCategory updates an existing category, including moving it under a
+// different parent
+func (s *CategoryService) UpdateCategory(categoryID uint, actor policy.Actor, categoryDTO models.CategoryDTO) (*models.CategoryDTO, error) {
+	// Find the category first to ensure it exists and the actor may change it
 	var category models.Category
-	if err := s.db.Where("id = ? AND user_id = ?", categoryID, userID).First(&category).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("category not found")
-		}
+	if err := loadAuthorized(s.db, actor, policy.CanWrite, &category, categoryID); err != nil {
+		return nil, err
+	}
+	userID := category.UserID
+
+	name, err := s.checkName(s.db, userID, category.ID, categoryDTO.Name)
+	if err != nil {
+		return nil, err
+	}
+	categoryDTO.Name = name
+
+	// Keep the current color when none is given
+	if categoryDTO.Color == "" {
+		categoryDTO.Color = category.Color
+	}
+	color, err := normalizeCategoryColor(categoryDTO.Color)
+	if err != nil {
 		return nil, err
 	}
+	categoryDTO.Color = color
+
+	if err := s.checkParent(s.db, userID, category.ID, categoryDTO.ParentID); err != nil {
+		return nil, err
+	}
+
+	// Moving to a different parent puts the category at the end of its new siblings
+	if !sameParent(category.ParentID, categoryDTO.ParentID) {
+		position, err := s.nextPosition(s.db, userID, categoryDTO.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		category.Position = position
+	}
 
 	// Update the category fields
 	category.Name = categoryDTO.Name
 	category.Color = categoryDTO.Color
+	category.ParentID = categoryDTO.ParentID
 
 	// Save changes
 	if err := s.db.Save(&category).Error; err != nil {
-		return nil, err
+		return nil, nameTaken(err)
 	}
+	s.stats.Invalidate(userID)
 
 	// Return the updated category as DTO
-	return &models.CategoryDTO{
-		ID:    category.ID,
-		Name:  category.Name,
-		Color: category.Color,
-	}, nil
+	dto := toCategoryDTO(&category)
+	return &dto, nil
 }
 
-// DeleteCategory deletes a category and updates related entries
-func (s *CategoryService) DeleteCategory(categoryID, userID uint) error {
+// ReorderCategories sets the order of the children of parentID (top-level
+// categories when nil). orderedIDs must list exactly those children.
+func (s *CategoryService) ReorderCategories(userID uint, parentID *uint, orderedIDs []uint) ([]models.CategoryDTO, error) {
+	if err := requireOwnedCategory(s.db, userID, parentID); err != nil {
+		if policy.IsNotFound(err) {
+			return nil, ErrParentCategoryNotFound
+		}
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var siblings []uint
+		query := tx.Model(&models.Category{}).Where("user_id = ?", userID)
+		if parentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *parentID)
+		}
+		if err := query.Pluck("id", &siblings).Error; err != nil {
+			return err
+		}
+
+		if len(siblings) != len(orderedIDs) {
+			return ErrInvalidCategoryOrder
+		}
+		expected := make(map[uint]bool, len(siblings))
+		for _, id := range siblings {
+			expected[id] = true
+		}
+		for _, id := range orderedIDs {
+			if !expected[id] {
+				return ErrInvalidCategoryOrder
+			}
+			delete(expected, id)
+		}
+
+		for position, id := range orderedIDs {
+			if err := tx.Model(&models.Category{}).
+				Where("id = ? AND user_id = ?", id, userID).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCategories(userID, true)
+}
+
+// SetCategoryArchived archives or restores a category. Archived categories
+// keep their entries but are hidden from category pickers.
+func (s *CategoryService) SetCategoryArchived(categoryID uint, actor policy.Actor, archived bool) (*models.CategoryDTO, error) {
+	var category models.Category
+	if err := loadAuthorized(s.db, actor, policy.CanWrite, &category, categoryID); err != nil {
+		return nil, err
+	}
+
+	if archived && category.ArchivedAt == nil {
+		now := time.Now()
+		category.ArchivedAt = &now
+	} else if !archived {
+		category.ArchivedAt = nil
+	}
+
+	if err := s.db.Model(&category).Update("archived_at", category.ArchivedAt).Error; err != nil {
+		return nil, err
+	}
+
+	dto := toCategoryDTO(&category)
+	return &dto, nil
+}
+
+// MergeCategory moves every entry and subcategory of sourceID into targetID
+// and deletes the source, all in one transaction
+func (s *CategoryService) MergeCategory(sourceID, targetID uint, actor policy.Actor) (*models.CategoryDTO, error) {
+	if sourceID == targetID {
+		return nil, ErrCategoryCycle
+	}
+
+	var target models.Category
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var source models.Category
+		if err := loadAuthorized(tx, actor, policy.CanWrite, &source, sourceID); err != nil {
+			return err
+		}
+		userID := source.UserID
+
+		// The target must belong to the same user as the source
+		if err := requireOwned(tx, userID, "category", targetID); err != nil {
+			return err
+		}
+		if err := tx.First(&target, targetID).Error; err != nil {
+			return err
+		}
+
+		// The source's subcategories become the target's, which cannot work
+		// if the target is one of them
+		descendants, err := categorySubtreeIDs(tx, userID, source.ID)
+		if err != nil {
+			return err
+		}
+		for _, id := range descendants {
+			if id == target.ID {
+				return ErrCategoryCycle
+			}
+		}
+
+		if err := moveCategoryEntries(tx, userID, source.ID, &target.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Category{}).
+			Where("user_id = ? AND parent_id = ?", userID, source.ID).
+			Update("parent_id", target.ID).Error; err != nil {
+			return err
+		}
+
+		// Hard delete so the name can be reused under the per-user unique index
+		if err := tx.Unscoped().Delete(&source).Error; err != nil {
+			return err
+		}
+
+		return rebuildDailyStats(tx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.stats.Invalidate(target.UserID)
+
+	dto := toCategoryDTO(&target)
+	return &dto, nil
+}
+
+// moveCategoryEntries moves every entry of one category to another, or out of
+// any category when to is nil. Their versions are bumped like any other edit,
+// so clients holding an older copy get a conflict instead of overwriting the
+// move.
+func moveCategoryEntries(tx *gorm.DB, userID, from uint, to *uint) error {
+	return tx.Model(&models.JournalEntry{}).
+		Where("user_id = ? AND category_id = ?", userID, from).
+		Updates(map[string]interface{}{"category_id": to, "version": gorm.Expr("version + 1")}).Error
+}
+
+// DeleteCategory deletes a category and updates related entries. Its
+// subcategories move up to the deleted category's parent.
+func (s *CategoryService) DeleteCategory(categoryID uint, actor policy.Actor) error {
 	// Begin a transaction
 	tx := s.db.Begin()
 	if tx.Error != nil {
 		return tx.Error
 	}
 
-	// Verify the category exists and belongs to the user
+	// Verify the category exists and the actor may delete it
 	var category models.Category
-	if err := tx.Where("id = ? AND user_id = ?", categoryID, userID).First(&category).Error; err != nil {
+	if err := loadAuthorized(tx, actor, policy.CanWrite, &category, categoryID); err != nil {
 		tx.Rollback()
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("category not found")
-		}
 		return err
 	}
 
 	// Set categoryId to NULL for all entries that use this category
-	if err := tx.Model(&models.JournalEntry{}).Where("category_id = ?", categoryID).Update("category_id", nil).Error; err != nil {
+	if err := moveCategoryEntries(tx, category.UserID, category.ID, nil); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	// Delete the category
-	if err := tx.Delete(&category).Error; err != nil {
+	// Re-parent subcategories
+	if err := tx.Model(&models.Category{}).Where("parent_id = ?", categoryID).Update("parent_id", category.ParentID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete the category; hard delete so the name can be reused
+	if err := tx.Unscoped().Delete(&category).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Its entries are now uncategorized in the daily stats too
+	if err := rebuildDailyStats(tx, category.UserID); err != nil {
 		tx.Rollback()
 		return err
 	}
 
 	// Commit the transaction
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	s.stats.Invalidate(category.UserID)
+	return nil
+}
+
+// checkName trims name and makes sure no other category of the user has it,
+// ignoring case. Deleted categories keep their names in idx_category_user_name,
+// so they are checked too.
+func (s *CategoryService) checkName(db *gorm.DB, userID, categoryID uint, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrInvalidCategoryName
+	}
+
+	var count int64
+	if err := db.Unscoped().Model(&models.Category{}).
+		Where("user_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", userID, name, categoryID).
+		Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "", ErrCategoryNameTaken
+	}
+	return name, nil
+}
+
+// nameTaken maps a violation of idx_category_user_name, which a concurrent
+// request can cause after checkName passed, to ErrCategoryNameTaken
+func nameTaken(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrCategoryNameTaken
+	}
+	return err
+}
+
+// normalizeCategoryColor accepts #RGB, #RRGGBB or a known color name and
+// returns it as upper-case #RRGGBB. No color at all is black.
+func normalizeCategoryColor(color string) (string, error) {
+	color = strings.TrimSpace(color)
+	if color == "" {
+		return defaultCategoryColor, nil
+	}
+	if hex, ok := namedColors[strings.ToLower(color)]; ok {
+		return hex, nil
+	}
+	if !hexColorPattern.MatchString(color) {
+		return "", ErrInvalidCategoryColor
+	}
+	if len(color) == 4 {
+		color = string([]byte{'#', color[1], color[1], color[2], color[2], color[3], color[3]})
+	}
+	return strings.ToUpper(color), nil
+}
+
+// checkParent verifies parentID belongs to the user and that making it the
+// parent of categoryID (0 for a new category) would not create a cycle
+func (s *CategoryService) checkParent(db *gorm.DB, userID, categoryID uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+
+	var parents []struct {
+		ID       uint
+		ParentID *uint
+	}
+	if err := db.Model(&models.Category{}).
+		Where("user_id = ?", userID).
+		Select("id, parent_id").
+		Scan(&parents).Error; err != nil {
+		return err
+	}
+
+	parentOf := make(map[uint]*uint, len(parents))
+	for _, p := range parents {
+		parentOf[p.ID] = p.ParentID
+	}
+
+	if _, ok := parentOf[*parentID]; !ok {
+		return ErrParentCategoryNotFound
+	}
+
+	// Walk up from the new parent; reaching the category itself means a cycle
+	for current, steps := parentID, 0; current != nil && steps <= len(parentOf); steps++ {
+		if *current == categoryID {
+			return ErrCategoryCycle
+		}
+		current = parentOf[*current]
+	}
+
+	return nil
+}
+
+// nextPosition returns the position after the last sibling under parentID
+func (s *CategoryService) nextPosition(db *gorm.DB, userID uint, parentID *uint) (int, error) {
+	query := db.Model(&models.Category{}).Where("user_id = ?", userID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var position int
+	if err := query.Select("COALESCE(MAX(position) + 1, 0)").Scan(&position).Error; err != nil {
+		return 0, err
+	}
+	return position, nil
+}
+
+// categorySubtreeIDs returns categoryID together with the IDs of all its
+// descendant categories
+func categorySubtreeIDs(db *gorm.DB, userID, categoryID uint) ([]uint, error) {
+	var categories []struct {
+		ID       uint
+		ParentID *uint
+	}
+	if err := db.Model(&models.Category{}).
+		Where("user_id = ?", userID).
+		Select("id, parent_id").
+		Scan(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]uint)
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+		}
+	}
+
+	ids := []uint{categoryID}
+	seen := map[uint]bool{categoryID: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func toCategoryDTO(category *models.Category) models.CategoryDTO {
+	return models.CategoryDTO{
+		ID:       category.ID,
+		ParentID: category.ParentID,
+		Name:     category.Name,
+		Color:    category.Color,
+		Position: category.Position,
+		Archived: category.ArchivedAt != nil,
+	}
 }
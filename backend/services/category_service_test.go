@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestNormalizeCategoryColor(t *testing.T) {
+	tests := []struct {
+		color   string
+		want    string
+		wantErr bool
+	}{
+		{color: "", want: "#000000"},
+		{color: "   ", want: "#000000"},
+		{color: "#abc", want: "#AABBCC"},
+		{color: "#4285f4", want: "#4285F4"},
+		{color: " #4285F4 ", want: "#4285F4"},
+		{color: "Teal", want: namedColors["teal"]},
+		{color: "red", want: "#FF0000"},
+		{color: "4285F4", wantErr: true},
+		{color: "#12345", wantErr: true},
+		{color: "#GGGGGG", wantErr: true},
+		{color: "rebeccapurple1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeCategoryColor(tt.color)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidCategoryColor) {
+				t.Errorf("normalizeCategoryColor(%q) = %q, %v, want ErrInvalidCategoryColor", tt.color, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeCategoryColor(%q) = %q, %v, want %q", tt.color, got, err, tt.want)
+		}
+	}
+}
+
+func TestNameTaken(t *testing.T) {
+	duplicate := &mysql.MySQLError{Number: mysqlDuplicateEntry, Message: "Duplicate entry '1-Work' for key 'idx_category_user_name'"}
+	other := &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "duplicate entry", err: duplicate, want: ErrCategoryNameTaken},
+		{name: "wrapped duplicate entry", err: fmt.Errorf("insert: %w", duplicate), want: ErrCategoryNameTaken},
+		{name: "other MySQL error", err: other, want: other},
+		{name: "other error", err: errRecordTest, want: errRecordTest},
+	}
+
+	for _, tt := range tests {
+		if got := nameTaken(tt.err); !errors.Is(got, tt.want) {
+			t.Errorf("%s: nameTaken() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+var errRecordTest = errors.New("connection reset")
+
+func TestMoveCategoryEntriesBumpsVersion(t *testing.T) {
+	target := uint(5)
+
+	tests := []struct {
+		name      string
+		to        *uint
+		fragments []string
+	}{
+		{name: "merge", to: &target, fragments: []string{"`category_id`=5", "`version`=version + 1", "WHERE (user_id = 3 AND category_id = 4)"}},
+		{name: "delete", to: nil, fragments: []string{"`category_id`=NULL", "`version`=version + 1", "WHERE (user_id = 3 AND category_id = 4)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			if err := moveCategoryEntries(db, 3, 4, tt.to); err != nil {
+				t.Fatal(err)
+			}
+
+			assertStatements(t, recorder.statements, []string{"UPDATE `journal_entries` SET"})
+			for _, fragment := range tt.fragments {
+				if !strings.Contains(recorder.statements[0], fragment) {
+					t.Errorf("update = %q, want it to contain %q", recorder.statements[0], fragment)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"journal/models"
+	"journal/pkg/sentiment"
+	"journal/pkg/textanalysis"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// analysisBatchSize is how many pending entries AnalyzePendingEntries loads at a time
+const analysisBatchSize = 200
+
+// analyzeContent sets everything derived from an entry's content: its word,
+// character and sentence counts, reading time, readability and sentiment, and
+// when they were derived
+func analyzeContent(entry *models.JournalEntry) {
+	text := textanalysis.PlainText(entry.Content)
+	stats := textanalysis.AnalyzePlainText(text)
+	score := sentiment.Analyze(text).Score
+
+	entry.WordCount = uint(stats.Words)
+	entry.CharacterCount = uint(stats.Characters)
+	entry.SentenceCount = uint(stats.Sentences)
+	entry.ReadingSeconds = uint(stats.ReadingSeconds)
+	entry.Readability = stats.Readability
+	entry.Sentiment = &score
+	now := time.Now()
+	entry.AnalyzedAt = &now
+}
+
+// contentAnalysisColumns returns the columns analyzeContent sets, for updates
+// that write only some of an entry's fields
+func contentAnalysisColumns(entry *models.JournalEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"word_count":      entry.WordCount,
+		"character_count": entry.CharacterCount,
+		"sentence_count":  entry.SentenceCount,
+		"reading_seconds": entry.ReadingSeconds,
+		"readability":     entry.Readability,
+		"sentiment":       entry.Sentiment,
+		"analyzed_at":     entry.AnalyzedAt,
+	}
+}
+
+// AnalyzePendingEntries analyzes entries written before their current
+// analysis existed, which have a NULL analyzed_at. Each entry is analyzed in its
+// own transaction together with its daily stats, so it is safe to run while
+// the server is handling requests.
+func (s *JournalService) AnalyzePendingEntries() error {
+	users := make(map[uint]bool)
+	var lastID uint
+	for {
+		var ids []uint
+		if err := s.db.Model(&models.JournalEntry{}).
+			Where("analyzed_at IS NULL AND id > ?", lastID).
+			Order("id").
+			Limit(analysisBatchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		lastID = ids[len(ids)-1]
+
+		for _, id := range ids {
+			err := s.db.Transaction(func(tx *gorm.DB) error {
+				// Skip entries analyzed by an edit since the batch was listed
+				var before models.JournalEntry
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("analyzed_at IS NULL").
+					First(&before, id).Error; err != nil {
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return nil
+					}
+					return err
+				}
+
+				after := before
+				analyzeContent(&after)
+				if err := tx.Model(&before).UpdateColumns(contentAnalysisColumns(&after)).Error; err != nil {
+					return err
+				}
+				users[before.UserID] = true
+				return moveDailyStats(tx, &before, &after)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for userID := range users {
+		s.stats.Invalidate(userID)
+	}
+	if len(users) > 0 {
+		log.Printf("Analyzed existing entries for %d users", len(users))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"time"
+
+	"journal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dailyStatsMoodLength is the size of daily_entry_stats.mood; longer moods
+// are counted under their truncated form
+const dailyStatsMoodLength = 100
+
+// addDailyStats adds (sign 1) or removes (sign -1) a published entry's
+// contribution to the daily aggregates. Drafts do not count.
+func addDailyStats(tx *gorm.DB, entry *models.JournalEntry, sign int64) error {
+	if entry.IsDraft {
+		return nil
+	}
+
+	row := models.DailyEntryStats{
+		UserID:    entry.UserID,
+		EntryDate: calendarDate(entry.EntryDate),
+		Mood:      truncateRunes(entry.Mood, dailyStatsMoodLength),
+		Entries:   sign,
+		Words:     sign * int64(entry.WordCount),
+	}
+	if entry.CategoryID != nil {
+		row.CategoryID = *entry.CategoryID
+	}
+	if entry.Sentiment != nil {
+		row.SentimentSum = float64(sign) * *entry.Sentiment
+		row.SentimentEntries = sign
+	}
+
+	if err := tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"entries":           gorm.Expr("entries + ?", row.Entries),
+			"words":             gorm.Expr("words + ?", row.Words),
+			"sentiment_sum":     gorm.Expr("sentiment_sum + ?", row.SentimentSum),
+			"sentiment_entries": gorm.Expr("sentiment_entries + ?", row.SentimentEntries),
+		}),
+	}).Create(&row).Error; err != nil {
+		return err
+	}
+
+	if sign < 0 {
+		// Drop rows that no longer count anything
+		return tx.Where("user_id = ? AND entry_date = ? AND category_id = ? AND mood = ? AND entries <= 0",
+			row.UserID, row.EntryDate, row.CategoryID, row.Mood).
+			Delete(&models.DailyEntryStats{}).Error
+	}
+	return nil
+}
+
+// moveDailyStats replaces before's contribution to the aggregates with after's
+func moveDailyStats(tx *gorm.DB, before, after *models.JournalEntry) error {
+	if err := addDailyStats(tx, before, -1); err != nil {
+		return err
+	}
+	return addDailyStats(tx, after, 1)
+}
+
+// rebuildDailyStats recomputes all of a user's aggregates from their entries,
+// for changes that touch many entries at once such as merging categories
+func rebuildDailyStats(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.DailyEntryStats{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(
+		"INSERT INTO daily_entry_stats (user_id, entry_date, category_id, mood, entries, words, sentiment_sum, sentiment_entries) "+
+			"SELECT user_id, entry_date, COALESCE(category_id, 0), LEFT(COALESCE(mood, ''), ?), COUNT(*), COALESCE(SUM(word_count), 0), "+
+			"COALESCE(SUM(sentiment), 0), COUNT(sentiment) "+
+			"FROM journal_entries WHERE user_id = ? AND is_draft = ? AND deleted_at IS NULL "+
+			"GROUP BY user_id, entry_date, COALESCE(category_id, 0), LEFT(COALESCE(mood, ''), ?)",
+		dailyStatsMoodLength, userID, false, dailyStatsMoodLength,
+	).Error
+}
+
+// activeDates returns the distinct days on which userID published entries, in order
+func activeDates(db *gorm.DB, userID uint) ([]time.Time, error) {
+	var dates []time.Time
+	if err := db.Model(&models.DailyEntryStats{}).
+		Where("user_id = ?", userID).
+		Distinct("entry_date").
+		Order("entry_date").
+		Pluck("entry_date", &dates).Error; err != nil {
+		return nil, err
+	}
+	return dates, nil
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"journal/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// statementRecorder is a GORM logger that keeps the SQL of every statement,
+// with its arguments inlined
+type statementRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *statementRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// dryRunDB returns a MySQL session that builds statements without sending
+// them anywhere, and the recorder they are logged to
+func dryRunDB(t *testing.T) (*gorm.DB, *statementRecorder) {
+	t.Helper()
+	recorder := &statementRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "journal:secret@tcp(127.0.0.1:3306)/journal_db?parseTime=True&loc=UTC",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, SkipDefaultTransaction: true, DisableAutomaticPing: true, Logger: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, recorder
+}
+
+func TestAddDailyStats(t *testing.T) {
+	categoryID := uint(7)
+	sentiment := 0.5
+	published := models.JournalEntry{
+		UserID:     3,
+		CategoryID: &categoryID,
+		Mood:       "Happy",
+		WordCount:  120,
+		Sentiment:  &sentiment,
+		EntryDate:  time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name  string
+		entry models.JournalEntry
+		sign  int64
+		want  []string // fragments of each statement, in order
+	}{
+		{
+			name:  "adding a published entry",
+			entry: published,
+			sign:  1,
+			want: []string{
+				"INSERT INTO `daily_entry_stats` (`user_id`,`entry_date`,`category_id`,`mood`,`entries`,`words`,`sentiment_sum`,`sentiment_entries`) " +
+					"VALUES (3,'2024-05-15 00:00:00',7,'Happy',1,120,0.5,1) ON DUPLICATE KEY UPDATE",
+			},
+		},
+		{
+			name:  "removing a published entry drops emptied rows",
+			entry: published,
+			sign:  -1,
+			want: []string{
+				"VALUES (3,'2024-05-15 00:00:00',7,'Happy',-1,-120,-0.5,-1)",
+				"DELETE FROM `daily_entry_stats` WHERE user_id = 3 AND entry_date = '2024-05-15 00:00:00' AND category_id = 7 AND mood = 'Happy' AND entries <= 0",
+			},
+		},
+		{
+			name:  "uncategorized entry without sentiment",
+			entry: models.JournalEntry{UserID: 3, WordCount: 5, EntryDate: published.EntryDate},
+			sign:  1,
+			want:  []string{"VALUES (3,'2024-05-15 00:00:00',0,'',1,5,0,0)"},
+		},
+		{
+			name:  "long moods are truncated",
+			entry: models.JournalEntry{UserID: 3, Mood: strings.Repeat("é", 120), EntryDate: published.EntryDate},
+			sign:  1,
+			want:  []string{"'" + strings.Repeat("é", dailyStatsMoodLength) + "'"},
+		},
+		{
+			name:  "drafts do not count",
+			entry: models.JournalEntry{UserID: 3, IsDraft: true, WordCount: 50, EntryDate: published.EntryDate},
+			sign:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			if err := addDailyStats(db, &tt.entry, tt.sign); err != nil {
+				t.Fatal(err)
+			}
+			assertStatements(t, recorder.statements, tt.want)
+		})
+	}
+}
+
+func TestMoveDailyStats(t *testing.T) {
+	before := models.JournalEntry{UserID: 3, Mood: "Sad", WordCount: 10, EntryDate: time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)}
+	after := models.JournalEntry{UserID: 3, Mood: "Happy", WordCount: 25, EntryDate: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)}
+	draft := after
+	draft.IsDraft = true
+
+	tests := []struct {
+		name          string
+		before, after models.JournalEntry
+		want          []string
+	}{
+		{
+			name:   "edited entry",
+			before: before,
+			after:  after,
+			want: []string{
+				"VALUES (3,'2024-05-14 00:00:00',0,'Sad',-1,-10,0,0)",
+				"DELETE FROM `daily_entry_stats` WHERE user_id = 3 AND entry_date = '2024-05-14 00:00:00'",
+				"VALUES (3,'2024-05-15 00:00:00',0,'Happy',1,25,0,0)",
+			},
+		},
+		{
+			name:   "published draft",
+			before: draft,
+			after:  after,
+			want:   []string{"VALUES (3,'2024-05-15 00:00:00',0,'Happy',1,25,0,0)"},
+		},
+		{
+			name:   "unpublished entry",
+			before: after,
+			after:  draft,
+			want: []string{
+				"VALUES (3,'2024-05-15 00:00:00',0,'Happy',-1,-25,0,0)",
+				"DELETE FROM `daily_entry_stats`",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, recorder := dryRunDB(t)
+			if err := moveDailyStats(db, &tt.before, &tt.after); err != nil {
+				t.Fatal(err)
+			}
+			assertStatements(t, recorder.statements, tt.want)
+		})
+	}
+}
+
+func TestRebuildDailyStats(t *testing.T) {
+	db, recorder := dryRunDB(t)
+	if err := rebuildDailyStats(db, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatements(t, recorder.statements, []string{
+		"DELETE FROM `daily_entry_stats` WHERE user_id = 3",
+		"INSERT INTO daily_entry_stats (user_id, entry_date, category_id, mood, entries, words, sentiment_sum, sentiment_entries) " +
+			"SELECT user_id, entry_date, COALESCE(category_id, 0), LEFT(COALESCE(mood, ''), 100),",
+	})
+	if len(recorder.statements) == 2 {
+		rebuild := recorder.statements[1]
+		for _, filter := range []string{"WHERE user_id = 3", "is_draft = false", "deleted_at IS NULL"} {
+			if !strings.Contains(rebuild, filter) {
+				t.Errorf("rebuild %q does not contain %q", rebuild, filter)
+			}
+		}
+	}
+}
+
+// assertStatements checks that each recorded statement contains the
+// corresponding fragment
+func assertStatements(t *testing.T, statements, fragments []string) {
+	t.Helper()
+	if len(statements) != len(fragments) {
+		t.Fatalf("ran %d statements, want %d:\n%s", len(statements), len(fragments), strings.Join(statements, "\n"))
+	}
+	for i, fragment := range fragments {
+		if !strings.Contains(statements[i], fragment) {
+			t.Errorf("statement %d = %q, want it to contain %q", i, statements[i], fragment)
+		}
+	}
+}
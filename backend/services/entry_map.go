@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"journal/models"
+)
+
+const (
+	// MaxMapZoom is the deepest zoom level maps are drawn at
+	MaxMapZoom = 22
+	// maxClusterZoom is the last zoom level at which nearby entries are
+	// clustered; beyond it every entry is shown on its own
+	maxClusterZoom = 16
+	// clusterCellSize is the width, in pixels of 256-pixel map tiles, of the
+	// grid cells entries are clustered in
+	clusterCellSize = 60
+	// maxMercatorLatitude is where the Web Mercator projection stops
+	maxMercatorLatitude = 85.05112878
+)
+
+// ErrInvalidZoom is returned for a map zoom level outside 0 to MaxMapZoom
+var ErrInvalidZoom = errors.New("invalid zoom level")
+
+// mapEntry is the part of an entry shown on the map
+type mapEntry struct {
+	ID        uint
+	Title     string
+	EntryDate time.Time
+	PlaceName string
+	Mood      string
+	Latitude  float64
+	Longitude float64
+}
+
+// mapCluster collects the entries that fall into one grid cell
+type mapCluster struct {
+	entries                  []mapEntry
+	latSum, lonSum           float64
+	west, south, east, north float64
+}
+
+// GetEntryMap returns the user's located, published entries as GeoJSON,
+// optionally limited to bounds. Entries close together at the given zoom
+// level are merged into clusters placed at their centroid.
+func (s *JournalService) GetEntryMap(userID uint, zoom int, bounds *BoundingBox) (*models.GeoJSONFeatureCollectionDTO, error) {
+	if zoom < 0 || zoom > MaxMapZoom {
+		return nil, ErrInvalidZoom
+	}
+
+	query := s.db.Model(&models.JournalEntry{}).
+		Scopes(publishedOnly).
+		Where("journal_entries.user_id = ? AND journal_entries.latitude IS NOT NULL", userID)
+	if bounds != nil {
+		if err := bounds.validate(); err != nil {
+			return nil, err
+		}
+		query = query.Scopes(withinBounds(*bounds))
+	}
+
+	var entries []mapEntry
+	if err := query.
+		Select("journal_entries.id, journal_entries.title, journal_entries.entry_date, journal_entries.place_name, journal_entries.mood, journal_entries.latitude, journal_entries.longitude").
+		Order("journal_entries.entry_date DESC, journal_entries.id DESC").
+		Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	collection := &models.GeoJSONFeatureCollectionDTO{
+		Type:     "FeatureCollection",
+		Features: make([]models.GeoJSONFeatureDTO, 0),
+	}
+	for _, cluster := range clusterEntries(entries, zoom) {
+		collection.Features = append(collection.Features, cluster.feature())
+	}
+	return collection, nil
+}
+
+// clusterEntries groups entries by the grid cell they fall into when the map
+// is drawn at zoom, keeping the order in which cells are first seen. Above
+// maxClusterZoom every entry gets a cluster of its own.
+func clusterEntries(entries []mapEntry, zoom int) []*mapCluster {
+	type cell struct{ x, y int64 }
+	worldSize := 256 * math.Exp2(float64(zoom))
+
+	var clusters []*mapCluster
+	byCell := make(map[cell]*mapCluster)
+	for _, entry := range entries {
+		var cluster *mapCluster
+		if zoom <= maxClusterZoom {
+			x, y := mercatorPixel(entry.Latitude, entry.Longitude, worldSize)
+			key := cell{int64(x / clusterCellSize), int64(y / clusterCellSize)}
+			cluster = byCell[key]
+			if cluster == nil {
+				cluster = &mapCluster{}
+				byCell[key] = cluster
+			}
+		} else {
+			cluster = &mapCluster{}
+		}
+		if len(cluster.entries) == 0 {
+			clusters = append(clusters, cluster)
+		}
+		cluster.add(entry)
+	}
+	return clusters
+}
+
+// mercatorPixel projects a point to pixel coordinates on a Web Mercator
+// world map worldSize pixels wide
+func mercatorPixel(lat, lon, worldSize float64) (float64, float64) {
+	lat = math.Max(-maxMercatorLatitude, math.Min(maxMercatorLatitude, lat))
+	sin := math.Sin(lat * math.Pi / 180)
+
+	x := (lon + 180) / 360 * worldSize
+	y := (0.5 - math.Log((1+sin)/(1-sin))/(4*math.Pi)) * worldSize
+	// The east edge belongs to the last column, not a column past the map
+	return math.Min(x, worldSize-1), math.Max(0, math.Min(y, worldSize-1))
+}
+
+func (c *mapCluster) add(entry mapEntry) {
+	if len(c.entries) == 0 {
+		c.west, c.east = entry.Longitude, entry.Longitude
+		c.south, c.north = entry.Latitude, entry.Latitude
+	}
+	c.entries = append(c.entries, entry)
+	c.latSum += entry.Latitude
+	c.lonSum += entry.Longitude
+	c.west = math.Min(c.west, entry.Longitude)
+	c.east = math.Max(c.east, entry.Longitude)
+	c.south = math.Min(c.south, entry.Latitude)
+	c.north = math.Max(c.north, entry.Latitude)
+}
+
+func (c *mapCluster) feature() models.GeoJSONFeatureDTO {
+	count := float64(len(c.entries))
+	feature := models.GeoJSONFeatureDTO{
+		Type: "Feature",
+		Geometry: models.GeoJSONPointDTO{
+			Type:        "Point",
+			Coordinates: [2]float64{c.lonSum / count, c.latSum / count},
+		},
+		Properties: models.MapFeaturePropertiesDTO{PointCount: len(c.entries)},
+	}
+
+	if len(c.entries) == 1 {
+		entry := c.entries[0]
+		feature.Properties.EntryID = entry.ID
+		feature.Properties.Title = entry.Title
+		feature.Properties.EntryDate = entry.EntryDate.Format("2006-01-02")
+		feature.Properties.PlaceName = entry.PlaceName
+		feature.Properties.Mood = entry.Mood
+		return feature
+	}
+
+	feature.Properties.Cluster = true
+	feature.BBox = []float64{c.west, c.south, c.east, c.north}
+	return feature
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"journal/models"
+	"journal/policy"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidGoalMetric   = errors.New("invalid goal metric")
+	ErrInvalidGoalPeriod   = errors.New("invalid goal period")
+	ErrInvalidGoalTarget   = errors.New("invalid goal target")
+	ErrInvalidGoalWeekdays = errors.New("invalid goal weekdays")
+)
+
+// goalMetrics describes what each metric counts, for default goal names
+var goalMetrics = map[string]string{
+	"words":   "words",
+	"entries": "entries",
+	"days":    "days journaled",
+}
+
+// goalPeriods maps each period to the phrase used in default goal names
+var goalPeriods = map[string]string{
+	"day":   "a day",
+	"week":  "a week",
+	"month": "a month",
+}
+
+// maxGoalDays is the most days any period of each length can have
+var maxGoalDays = map[string]uint{
+	"day":   1,
+	"week":  7,
+	"month": 31,
+}
+
+// weekdayNames are the accepted weekday abbreviations, indexed by time.Weekday
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+const (
+	defaultGoalHistory = 8
+	maxGoalHistory     = 90
+)
+
+type GoalService struct {
+	db *gorm.DB
+}
+
+func NewGoalService(db *gorm.DB) *GoalService {
+	return &GoalService{db: db}
+}
+
+// GetGoals retrieves all goals for a user, oldest first
+func (s *GoalService) GetGoals(userID uint) ([]models.GoalDTO, error) {
+	var goals []models.Goal
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&goals).Error; err != nil {
+		return nil, err
+	}
+
+	dtos := make([]models.GoalDTO, 0, len(goals))
+	for _, goal := range goals {
+		dtos = append(dtos, toGoalDTO(&goal))
+	}
+	return dtos, nil
+}
+
+// GetGoal retrieves a specific goal by ID
+func (s *GoalService) GetGoal(goalID uint, actor policy.Actor) (*models.GoalDTO, error) {
+	var goal models.Goal
+	if err := loadAuthorized(s.db, actor, policy.CanRead, &goal, goalID); err != nil {
+		return nil, err
+	}
+
+	dto := toGoalDTO(&goal)
+	return &dto, nil
+}
+
+// CreateGoal validates and stores a new goal for a user
+func (s *GoalService) CreateGoal(userID uint, goalDTO models.GoalDTO) (*models.GoalDTO, error) {
+	goal := models.Goal{UserID: userID}
+	if err := applyGoal(&goal, goalDTO); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&goal).Error; err != nil {
+		return nil, err
+	}
+
+	dto := toGoalDTO(&goal)
+	return &dto, nil
+}
+
+// UpdateGoal replaces the settings of an existing goal
+func (s *GoalService) UpdateGoal(goalID uint, actor policy.Actor, goalDTO models.GoalDTO) (*models.GoalDTO, error) {
+	var goal models.Goal
+	if err := loadAuthorized(s.db, actor, policy.CanWrite, &goal, goalID); err != nil {
+		return nil, err
+	}
+
+	if err := applyGoal(&goal, goalDTO); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&goal).Error; err != nil {
+		return nil, err
+	}
+
+	dto := toGoalDTO(&goal)
+	return &dto, nil
+}
+
+// DeleteGoal removes a goal
+func (s *GoalService) DeleteGoal(goalID uint, actor policy.Actor) error {
+	var goal models.Goal
+	if err := loadAuthorized(s.db, actor, policy.CanWrite, &goal, goalID); err != nil {
+		return err
+	}
+
+	return s.db.Delete(&goal).Error
+}
+
+// GetGoalProgress reports how far along a goal is in the current period and
+// how it went in up to history previous periods (a default number when
+// negative)
+func (s *GoalService) GetGoalProgress(goalID uint, actor policy.Actor, history int) (*models.GoalProgressDTO, error) {
+	var goal models.Goal
+	if err := loadAuthorized(s.db, actor, policy.CanRead, &goal, goalID); err != nil {
+		return nil, err
+	}
+
+	today := calendarDate(time.Now().In(userLocation(s.db, goal.UserID)))
+	return s.goalProgress(&goal, today, history)
+}
+
+// GetAllGoalProgress reports progress for every goal of a user
+func (s *GoalService) GetAllGoalProgress(userID uint, history int) ([]models.GoalProgressDTO, error) {
+	var goals []models.Goal
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&goals).Error; err != nil {
+		return nil, err
+	}
+
+	today := calendarDate(time.Now().In(userLocation(s.db, userID)))
+	progress := make([]models.GoalProgressDTO, 0, len(goals))
+	for _, goal := range goals {
+		p, err := s.goalProgress(&goal, today, history)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, *p)
+	}
+	return progress, nil
+}
+
+// goalDay holds the published entries and words of one day
+type goalDay struct {
+	EntryDate time.Time
+	Entries   int64
+	Words     int64
+}
+
+// goalProgress computes the current and past periods of a goal from the
+// daily aggregates of published entries
+func (s *GoalService) goalProgress(goal *models.Goal, today time.Time, history int) (*models.GoalProgressDTO, error) {
+	starts := goalPeriodStarts(goal, today, history)
+	oldest := starts[len(starts)-1]
+	end := nextBucket(starts[0], goal.Period).AddDate(0, 0, -1)
+
+	var days []goalDay
+	if err := s.db.Model(&models.DailyEntryStats{}).
+		Where("user_id = ? AND entry_date BETWEEN ? AND ?", goal.UserID, oldest, end).
+		Select("entry_date, SUM(entries) as entries, SUM(words) as words").
+		Group("entry_date").
+		Scan(&days).Error; err != nil {
+		return nil, err
+	}
+
+	return summarizeGoal(goal, today, starts, days), nil
+}
+
+// goalPeriodStarts returns the first day of the latest period of a goal up to
+// today and of up to history (a default number when negative) periods before
+// it, newest first. Days a weekday-limited goal does not apply to are
+// skipped, today included, so on such a day the latest period is the last one
+// that applied.
+func goalPeriodStarts(goal *models.Goal, today time.Time, history int) []time.Time {
+	if history < 0 {
+		history = defaultGoalHistory
+	}
+	if history > maxGoalHistory {
+		history = maxGoalHistory
+	}
+
+	days := weekdaySet(goal.Weekdays)
+	var starts []time.Time
+	start := bucketStart(today, goal.Period)
+	for tries := 0; len(starts) <= history && tries < 7*(history+1); tries++ {
+		if days == nil || days[start.Weekday()] {
+			starts = append(starts, start)
+		}
+		start = previousBucket(start, goal.Period)
+	}
+	return starts
+}
+
+// summarizeGoal adds up the days falling into each period that starts at one
+// of starts, newest first, and works out completion and the streak
+func summarizeGoal(goal *models.Goal, today time.Time, starts []time.Time, days []goalDay) *models.GoalProgressDTO {
+	periods := make([]models.GoalPeriodDTO, len(starts))
+	for i, start := range starts {
+		periods[i] = models.GoalPeriodDTO{
+			Start:  start.Format("2006-01-02"),
+			End:    nextBucket(start, goal.Period).AddDate(0, 0, -1).Format("2006-01-02"),
+			Target: goal.Target,
+		}
+	}
+	for _, day := range days {
+		date := calendarDate(day.EntryDate)
+		for i, start := range starts {
+			if date.Before(start) || !date.Before(nextBucket(start, goal.Period)) {
+				continue
+			}
+			switch goal.Metric {
+			case "words":
+				periods[i].Value += day.Words
+			case "entries":
+				periods[i].Value += day.Entries
+			case "days":
+				periods[i].Value++
+			}
+		}
+	}
+	for i := range periods {
+		periods[i].Completion = float64(periods[i].Value) / float64(goal.Target)
+		if periods[i].Completion > 1 {
+			periods[i].Completion = 1
+		}
+		periods[i].Achieved = periods[i].Value >= int64(goal.Target)
+	}
+
+	progress := &models.GoalProgressDTO{
+		Goal:    toGoalDTO(goal),
+		Current: periods[0],
+		History: []models.GoalPeriodDTO{},
+	}
+
+	// History is reported oldest first, ready for charting
+	for i := len(periods) - 1; i >= 1; i-- {
+		progress.History = append(progress.History, periods[i])
+	}
+
+	// A period still in progress only adds to the streak once achieved, and
+	// does not break it before then
+	first := 0
+	if starts[0].Equal(bucketStart(today, goal.Period)) && !periods[0].Achieved {
+		first = 1
+	}
+	for i := first; i < len(periods) && periods[i].Achieved; i++ {
+		progress.Streak++
+	}
+
+	return progress
+}
+
+// applyGoal validates goalDTO and copies it onto goal
+func applyGoal(goal *models.Goal, goalDTO models.GoalDTO) error {
+	metric := strings.ToLower(strings.TrimSpace(goalDTO.Metric))
+	if _, ok := goalMetrics[metric]; !ok {
+		return ErrInvalidGoalMetric
+	}
+
+	period := strings.ToLower(strings.TrimSpace(goalDTO.Period))
+	if _, ok := goalPeriods[period]; !ok {
+		return ErrInvalidGoalPeriod
+	}
+
+	if goalDTO.Target == 0 {
+		return ErrInvalidGoalTarget
+	}
+	// A period has only so many days to journal on
+	if metric == "days" && goalDTO.Target > maxGoalDays[period] {
+		return ErrInvalidGoalTarget
+	}
+
+	weekdays, err := normalizeWeekdays(goalDTO.Weekdays)
+	if err != nil {
+		return err
+	}
+	if weekdays != "" && period != "day" {
+		return ErrInvalidGoalWeekdays
+	}
+
+	name := strings.TrimSpace(goalDTO.Name)
+	if name == "" {
+		name = fmt.Sprintf("%d %s %s", goalDTO.Target, goalMetrics[metric], goalPeriods[period])
+	}
+
+	goal.Name = name
+	goal.Metric = metric
+	goal.Period = period
+	goal.Target = goalDTO.Target
+	goal.Weekdays = weekdays
+	return nil
+}
+
+// normalizeWeekdays lower-cases and dedupes weekday abbreviations and returns
+// them comma-separated in calendar order, Monday first. Listing all seven days
+// is the same as listing none.
+func normalizeWeekdays(days []string) (string, error) {
+	selected := make(map[string]bool, len(days))
+	for _, day := range days {
+		day = strings.ToLower(strings.TrimSpace(day))
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		valid := false
+		for _, name := range weekdayNames {
+			if day == name {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", ErrInvalidGoalWeekdays
+		}
+		selected[day] = true
+	}
+
+	if len(selected) == len(weekdayNames) {
+		return "", nil
+	}
+
+	var ordered []string
+	for i := 1; i <= len(weekdayNames); i++ {
+		name := weekdayNames[i%len(weekdayNames)]
+		if selected[name] {
+			ordered = append(ordered, name)
+		}
+	}
+	return strings.Join(ordered, ","), nil
+}
+
+// weekdaySet parses a stored weekday list; nil means every day
+func weekdaySet(weekdays string) map[time.Weekday]bool {
+	if weekdays == "" {
+		return nil
+	}
+
+	set := make(map[time.Weekday]bool)
+	for _, day := range strings.Split(weekdays, ",") {
+		for i, name := range weekdayNames {
+			if day == name {
+				set[time.Weekday(i)] = true
+			}
+		}
+	}
+	return set
+}
+
+// previousBucket returns the first day of the bucket before the one starting at start
+func previousBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, -7)
+	case "month":
+		return start.AddDate(0, -1, 0)
+	default:
+		return start.AddDate(0, 0, -1)
+	}
+}
+
+func toGoalDTO(goal *models.Goal) models.GoalDTO {
+	weekdays := []string{}
+	if goal.Weekdays != "" {
+		weekdays = strings.Split(goal.Weekdays, ",")
+	}
+
+	return models.GoalDTO{
+		ID:        goal.ID,
+		Name:      goal.Name,
+		Metric:    goal.Metric,
+		Period:    goal.Period,
+		Target:    goal.Target,
+		Weekdays:  weekdays,
+		CreatedAt: goal.CreatedAt,
+	}
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"journal/models"
+)
+
+// day parses a YYYY-MM-DD date the way entry dates are stored
+func day(t *testing.T, value string) time.Time {
+	t.Helper()
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return date
+}
+
+func formatDays(dates []time.Time) []string {
+	formatted := make([]string, len(dates))
+	for i, date := range dates {
+		formatted[i] = date.Format("2006-01-02")
+	}
+	return formatted
+}
+
+func TestBucketStart(t *testing.T) {
+	tests := []struct {
+		date     string
+		interval string
+		want     string
+	}{
+		{"2024-05-15", "day", "2024-05-15"},
+		{"2024-05-13", "week", "2024-05-13"}, // Monday
+		{"2024-05-15", "week", "2024-05-13"},
+		{"2024-05-19", "week", "2024-05-13"}, // Sunday ends the week
+		{"2024-01-03", "week", "2024-01-01"},
+		{"2023-01-01", "week", "2022-12-26"}, // across a year boundary
+		{"2024-05-01", "month", "2024-05-01"},
+		{"2024-05-31", "month", "2024-05-01"},
+		{"2024-02-29", "month", "2024-02-01"},
+	}
+
+	for _, tt := range tests {
+		got := bucketStart(day(t, tt.date), tt.interval)
+		if got.Format("2006-01-02") != tt.want {
+			t.Errorf("bucketStart(%s, %s) = %s, want %s", tt.date, tt.interval, got.Format("2006-01-02"), tt.want)
+		}
+	}
+}
+
+func TestBucketArithmetic(t *testing.T) {
+	tests := []struct {
+		start    string
+		interval string
+		next     string
+		previous string
+	}{
+		{"2024-02-29", "day", "2024-03-01", "2024-02-28"},
+		{"2024-12-30", "week", "2025-01-06", "2024-12-23"},
+		{"2024-01-01", "month", "2024-02-01", "2023-12-01"},
+		{"2024-03-01", "month", "2024-04-01", "2024-02-01"},
+	}
+
+	for _, tt := range tests {
+		start := day(t, tt.start)
+		if got := nextBucket(start, tt.interval).Format("2006-01-02"); got != tt.next {
+			t.Errorf("nextBucket(%s, %s) = %s, want %s", tt.start, tt.interval, got, tt.next)
+		}
+		if got := previousBucket(start, tt.interval).Format("2006-01-02"); got != tt.previous {
+			t.Errorf("previousBucket(%s, %s) = %s, want %s", tt.start, tt.interval, got, tt.previous)
+		}
+	}
+}
+
+func TestGoalPeriodStarts(t *testing.T) {
+	tests := []struct {
+		name    string
+		goal    models.Goal
+		today   string
+		history int
+		want    []string
+	}{
+		{
+			name:    "daily",
+			goal:    models.Goal{Period: "day"},
+			today:   "2024-05-15",
+			history: 2,
+			want:    []string{"2024-05-15", "2024-05-14", "2024-05-13"},
+		},
+		{
+			name:    "weekdays on a weekday",
+			goal:    models.Goal{Period: "day", Weekdays: "mon,tue,wed,thu,fri"},
+			today:   "2024-05-20", // Monday
+			history: 2,
+			want:    []string{"2024-05-20", "2024-05-17", "2024-05-16"},
+		},
+		{
+			name:    "weekdays on a weekend skips today",
+			goal:    models.Goal{Period: "day", Weekdays: "mon,tue,wed,thu,fri"},
+			today:   "2024-05-19", // Sunday
+			history: 1,
+			want:    []string{"2024-05-17", "2024-05-16"},
+		},
+		{
+			name:    "single weekday",
+			goal:    models.Goal{Period: "day", Weekdays: "sat"},
+			today:   "2024-05-15",
+			history: 2,
+			want:    []string{"2024-05-11", "2024-05-04", "2024-04-27"},
+		},
+		{
+			name:    "weekly",
+			goal:    models.Goal{Period: "week"},
+			today:   "2024-05-15",
+			history: 1,
+			want:    []string{"2024-05-13", "2024-05-06"},
+		},
+		{
+			name:    "monthly across a year",
+			goal:    models.Goal{Period: "month"},
+			today:   "2024-02-29",
+			history: 2,
+			want:    []string{"2024-02-01", "2024-01-01", "2023-12-01"},
+		},
+		{
+			name:    "no history",
+			goal:    models.Goal{Period: "day"},
+			today:   "2024-05-15",
+			history: 0,
+			want:    []string{"2024-05-15"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatDays(goalPeriodStarts(&tt.goal, day(t, tt.today), tt.history))
+			if len(got) != len(tt.want) {
+				t.Fatalf("goalPeriodStarts() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("goalPeriodStarts() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGoalPeriodStartsHistoryBounds(t *testing.T) {
+	goal := &models.Goal{Period: "day"}
+	today := day(t, "2024-05-15")
+
+	if got := len(goalPeriodStarts(goal, today, -1)); got != defaultGoalHistory+1 {
+		t.Errorf("default history gave %d periods, want %d", got, defaultGoalHistory+1)
+	}
+	if got := len(goalPeriodStarts(goal, today, 1000)); got != maxGoalHistory+1 {
+		t.Errorf("capped history gave %d periods, want %d", got, maxGoalHistory+1)
+	}
+}
+
+func TestSummarizeGoal(t *testing.T) {
+	tests := []struct {
+		name           string
+		goal           models.Goal
+		today          string
+		starts         []string
+		days           []goalDay
+		wantValues     []int64 // newest first
+		wantCompletion float64 // of the latest period
+		wantStreak     int
+	}{
+		{
+			name:   "words per week",
+			goal:   models.Goal{Metric: "words", Period: "week", Target: 500},
+			today:  "2024-05-15",
+			starts: []string{"2024-05-13", "2024-05-06"},
+			days: []goalDay{
+				{EntryDate: day(t, "2024-05-06"), Words: 300},
+				{EntryDate: day(t, "2024-05-12"), Words: 250},
+				{EntryDate: day(t, "2024-05-14"), Words: 100},
+			},
+			wantValues:     []int64{100, 550},
+			wantCompletion: 0.2,
+			wantStreak:     1,
+		},
+		{
+			name:   "completion is capped",
+			goal:   models.Goal{Metric: "entries", Period: "day", Target: 1},
+			today:  "2024-05-15",
+			starts: []string{"2024-05-15"},
+			days:   []goalDay{{EntryDate: day(t, "2024-05-15"), Entries: 3}},
+
+			wantValues:     []int64{3},
+			wantCompletion: 1,
+			wantStreak:     1,
+		},
+		{
+			name:   "days count once each",
+			goal:   models.Goal{Metric: "days", Period: "week", Target: 3},
+			today:  "2024-05-15",
+			starts: []string{"2024-05-13"},
+			days: []goalDay{
+				{EntryDate: day(t, "2024-05-13"), Entries: 2},
+				{EntryDate: day(t, "2024-05-15"), Entries: 1},
+			},
+			wantValues:     []int64{2},
+			wantCompletion: 2.0 / 3,
+			wantStreak:     0,
+		},
+		{
+			name:   "period in progress does not break the streak",
+			goal:   models.Goal{Metric: "entries", Period: "day", Target: 1},
+			today:  "2024-05-15",
+			starts: []string{"2024-05-15", "2024-05-14", "2024-05-13", "2024-05-12"},
+			days: []goalDay{
+				{EntryDate: day(t, "2024-05-13"), Entries: 1},
+				{EntryDate: day(t, "2024-05-14"), Entries: 1},
+			},
+			wantValues: []int64{0, 1, 1, 0},
+			wantStreak: 2,
+		},
+		{
+			name:   "achieved period in progress extends the streak",
+			goal:   models.Goal{Metric: "entries", Period: "day", Target: 1},
+			today:  "2024-05-15",
+			starts: []string{"2024-05-15", "2024-05-14", "2024-05-13"},
+			days: []goalDay{
+				{EntryDate: day(t, "2024-05-14"), Entries: 1},
+				{EntryDate: day(t, "2024-05-15"), Entries: 1},
+			},
+			wantValues:     []int64{1, 1, 0},
+			wantCompletion: 1,
+			wantStreak:     2,
+		},
+		{
+			name:   "missed latest period on a skipped day breaks the streak",
+			goal:   models.Goal{Metric: "entries", Period: "day", Target: 1, Weekdays: "mon,tue,wed,thu,fri"},
+			today:  "2024-05-19", // Sunday
+			starts: []string{"2024-05-17", "2024-05-16"},
+			days:   []goalDay{{EntryDate: day(t, "2024-05-16"), Entries: 1}},
+
+			wantValues: []int64{0, 1},
+			wantStreak: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var starts []time.Time
+			for _, start := range tt.starts {
+				starts = append(starts, day(t, start))
+			}
+
+			progress := summarizeGoal(&tt.goal, day(t, tt.today), starts, tt.days)
+
+			values := []int64{progress.Current.Value}
+			for i := len(progress.History) - 1; i >= 0; i-- {
+				values = append(values, progress.History[i].Value)
+			}
+			if len(values) != len(tt.wantValues) {
+				t.Fatalf("values = %v, want %v", values, tt.wantValues)
+			}
+			for i := range values {
+				if values[i] != tt.wantValues[i] {
+					t.Fatalf("values = %v, want %v", values, tt.wantValues)
+				}
+			}
+			if diff := progress.Current.Completion - tt.wantCompletion; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Completion = %v, want %v", progress.Current.Completion, tt.wantCompletion)
+			}
+			if progress.Streak != tt.wantStreak {
+				t.Errorf("Streak = %d, want %d", progress.Streak, tt.wantStreak)
+			}
+			if progress.Current.Start != tt.starts[0] {
+				t.Errorf("Current.Start = %s, want %s", progress.Current.Start, tt.starts[0])
+			}
+		})
+	}
+}
+
+func TestApplyGoal(t *testing.T) {
+	tests := []struct {
+		name    string
+		dto     models.GoalDTO
+		wantErr error
+		want    models.Goal
+	}{
+		{
+			name: "default name",
+			dto:  models.GoalDTO{Metric: " Words ", Period: "DAY", Target: 500},
+			want: models.Goal{Name: "500 words a day", Metric: "words", Period: "day", Target: 500},
+		},
+		{
+			name: "weekdays are normalized",
+			dto:  models.GoalDTO{Name: "Weekday pages", Metric: "entries", Period: "day", Target: 1, Weekdays: []string{"Friday", "mon", "MON"}},
+			want: models.Goal{Name: "Weekday pages", Metric: "entries", Period: "day", Target: 1, Weekdays: "mon,fri"},
+		},
+		{
+			name: "every weekday is no limit",
+			dto:  models.GoalDTO{Metric: "entries", Period: "day", Target: 1, Weekdays: weekdayNames},
+			want: models.Goal{Name: "1 entries a day", Metric: "entries", Period: "day", Target: 1},
+		},
+		{name: "unknown metric", dto: models.GoalDTO{Metric: "pages", Period: "day", Target: 1}, wantErr: ErrInvalidGoalMetric},
+		{name: "unknown period", dto: models.GoalDTO{Metric: "words", Period: "year", Target: 1}, wantErr: ErrInvalidGoalPeriod},
+		{name: "zero target", dto: models.GoalDTO{Metric: "words", Period: "day"}, wantErr: ErrInvalidGoalTarget},
+		{name: "one day a day", dto: models.GoalDTO{Metric: "days", Period: "day", Target: 1}, want: models.Goal{Name: "1 days journaled a day", Metric: "days", Period: "day", Target: 1}},
+		{name: "two days a day", dto: models.GoalDTO{Metric: "days", Period: "day", Target: 2}, wantErr: ErrInvalidGoalTarget},
+		{name: "seven days a week", dto: models.GoalDTO{Metric: "days", Period: "week", Target: 7}, want: models.Goal{Name: "7 days journaled a week", Metric: "days", Period: "week", Target: 7}},
+		{name: "eight days a week", dto: models.GoalDTO{Metric: "days", Period: "week", Target: 8}, wantErr: ErrInvalidGoalTarget},
+		{name: "31 days a month", dto: models.GoalDTO{Metric: "days", Period: "month", Target: 31}, want: models.Goal{Name: "31 days journaled a month", Metric: "days", Period: "month", Target: 31}},
+		{name: "32 days a month", dto: models.GoalDTO{Metric: "days", Period: "month", Target: 32}, wantErr: ErrInvalidGoalTarget},
+		{name: "weekdays on a weekly goal", dto: models.GoalDTO{Metric: "words", Period: "week", Target: 1, Weekdays: []string{"mon"}}, wantErr: ErrInvalidGoalWeekdays},
+		{name: "unknown weekday", dto: models.GoalDTO{Metric: "words", Period: "day", Target: 1, Weekdays: []string{"someday"}}, wantErr: ErrInvalidGoalWeekdays},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var goal models.Goal
+			err := applyGoal(&goal, tt.dto)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("applyGoal() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyGoal() error = %v", err)
+			}
+			if goal.Name != tt.want.Name || goal.Metric != tt.want.Metric || goal.Period != tt.want.Period ||
+				goal.Target != tt.want.Target || goal.Weekdays != tt.want.Weekdays {
+				t.Errorf("applyGoal() = %+v, want %+v", goal, tt.want)
+			}
+		})
+	}
+}
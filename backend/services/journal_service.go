@@ -2,151 +2,809 @@ package services
 
 import (
 	"errors"
+	"net/mail"
+	"sort"
 	"strings"
+	"time"
 
 	"journal/models"
+	"journal/pkg/blobstore"
+	"journal/pkg/markdown"
+	"journal/policy"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// VersionConflictError is returned when an entry is updated against a version
+// that is no longer the one stored on the server.
+type VersionConflictError struct {
+	Current *models.JournalEntryDTO
+}
+
+func (e *VersionConflictError) Error() string {
+	return "entry version conflict"
+}
+
+var errVersionChanged = errors.New("entry version changed")
+
+// savedEntryColumns are the columns saveEntry writes: the editable fields,
+// everything analyzeContent derives from the content, and the version
+var savedEntryColumns = []string{
+	"title", "content", "category_id", "mood", "mood_intensity", "is_draft",
+	"entry_date", "entry_time", "entry_timezone", "latitude", "longitude", "place_name", "location_accuracy",
+	"sentiment", "word_count", "character_count", "sentence_count", "reading_seconds", "readability", "analyzed_at",
+	"version",
+}
+
+// ErrEntryNotDraft is returned when a draft-only operation targets a published entry
+var ErrEntryNotDraft = errors.New("entry is not a draft")
+
+// ErrInvalidEntryDate is returned when an entry date, time or timezone cannot be parsed
+var ErrInvalidEntryDate = errors.New("invalid entry date")
+
+var (
+	ErrInvalidShareEmail = errors.New("invalid email to share with")
+	ErrShareWithOwner    = errors.New("entry cannot be shared with its owner")
+)
+
+// EntryInput holds the user-editable fields of an entry. Tag names are
+// normalized before use; on update a nil Tags leaves the current tags alone.
+type EntryInput struct {
+	Title      string
+	Content    string
+	CategoryID *uint
+	// Mood must be one of the user's moods, unless CreateMood adds it to
+	// them; MoodIntensity rates it from 1 to 10
+	Mood          string
+	CreateMood    bool
+	MoodIntensity *uint8
+	Tags          []string
+	IsDraft       bool
+	Date          EntryDateInput
+	// Location is where the entry was written. On update it is only
+	// changed when SetLocation is true, and a nil Location then clears it.
+	SetLocation bool
+	Location    *LocationInput
+}
+
+// EntryDateInput is the day an entry is about, which may differ from when it
+// was written. Time is optional; Timezone is an IANA zone name.
+type EntryDateInput struct {
+	Date     string // YYYY-MM-DD
+	Time     string // HH:MM or HH:MM:SS
+	Timezone string
+}
+
+// EntryFilter narrows the entries returned by ListEntries
+type EntryFilter struct {
+	CategoryID *uint
+	// IncludeSubcategories also matches entries in descendants of CategoryID
+	IncludeSubcategories bool
+	TagID                *uint
+	// IncludeSubtags also matches entries tagged with descendants of TagID
+	IncludeSubtags bool
+	// Drafts is "exclude" (default), "include" or "only"
+	Drafts string
+	// From and To bound the entry date, inclusive
+	From *time.Time
+	To   *time.Time
+	// Bounds and Near limit the results to entries located in an area
+	Bounds *BoundingBox
+	Near   *Radius
+}
+
+// publishedOnly restricts a journal_entries query to non-draft entries
+func publishedOnly(db *gorm.DB) *gorm.DB {
+	return db.Where("journal_entries.is_draft = ?", false)
+}
+
+// taggedWith restricts a journal_entries query to entries carrying any of tagIDs
+func taggedWith(tagIDs []uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("journal_entries.id IN (?)",
+			db.Session(&gorm.Session{NewDB: true}).
+				Table("journal_entry_tags").
+				Select("entry_id").
+				Where("tag_id IN ?", tagIDs))
+	}
+}
+
 type JournalService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	stats    *StatsCache
+	rendered *RenderCache
+	blobs    blobstore.BlobStore
 }
 
-func NewJournalService(db *gorm.DB) *JournalService {
-	return &JournalService{db: db}
+func NewJournalService(db *gorm.DB, stats *StatsCache, rendered *RenderCache, blobs blobstore.BlobStore) *JournalService {
+	return &JournalService{db: db, stats: stats, rendered: rendered, blobs: blobs}
 }
 
-func (s *JournalService) CreateEntry(userID uint, title, content string, categoryID *uint, mood string, tagNames []string) (*models.JournalEntryDTO, error) {
-	// Calculate word count
-	wordCount := uint(len(strings.Fields(content)))
+func (s *JournalService) CreateEntry(userID uint, input EntryInput) (*models.JournalEntryDTO, error) {
+	if err := requireAssignableCategory(s.db, userID, input.CategoryID, nil); err != nil {
+		return nil, err
+	}
+
+	choice := moodChoice{name: input.Mood, create: input.CreateMood}
+	mood, err := choice.trimmed()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMoodIntensity(mood, input.MoodIntensity); err != nil {
+		return nil, err
+	}
 
 	// Create entry
 	entry := models.JournalEntry{
-		UserID:     userID,
-		CategoryID: categoryID,
-		Title:      title,
-		Content:    content,
-		Mood:       mood,
-		WordCount:  wordCount,
-	}
-
-	if err := s.db.Create(&entry).Error; err != nil {
-		return nil, err
-	}
-
-	// Handle tags
-	if len(tagNames) > 0 {
-		var tags []models.Tag
-		for _, tagName := range tagNames {
-			var tag models.Tag
-			// Try to find existing tag
-			err := s.db.Where("user_id = ? AND name = ?", userID, tagName).First(&tag).Error
-			if err == nil {
-				tags = append(tags, tag)
-			} else {
-				// Create new tag
-				tag = models.Tag{
-					UserID: userID,
-					Name:   tagName,
-				}
-				if err := s.db.Create(&tag).Error; err != nil {
-					return nil, err
-				}
-				tags = append(tags, tag)
-			}
+		UserID:        userID,
+		CategoryID:    input.CategoryID,
+		Title:         input.Title,
+		Content:       input.Content,
+		MoodIntensity: input.MoodIntensity,
+		Version:       1,
+		IsDraft:       input.IsDraft,
+	}
+	analyzeContent(&entry)
+
+	if err := applyLocation(&entry, input.Location); err != nil {
+		return nil, err
+	}
+
+	// New entries default to "now" in the user's own timezone
+	if err := applyEntryDate(&entry, input.Date, userLocation(s.db, userID).String(), time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Create the entry with its tags and any new mood together so a failure
+	// leaves none of them behind
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		mood, err := resolveMood(tx, userID, choice)
+		if err != nil {
+			return err
+		}
+		entry.Mood = mood
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := addDailyStats(tx, &entry, 1); err != nil {
+			return err
+		}
+
+		tags, err := resolveTags(tx, userID, input.Tags)
+		if err != nil {
+			return err
+		}
+		if err := setEntryTags(tx, entry.ID, tags); err != nil {
+			return err
 		}
 		entry.Tags = tags
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	s.stats.Invalidate(userID)
 
-	return s.convertToDTO(&entry), nil
+	return s.withSuggestedMood(s.convertToDTO(&entry), userID), nil
 }
 
-func (s *JournalService) GetEntry(id uint, userID uint) (*models.JournalEntryDTO, error) {
+// GetEntry returns an entry the actor owns or that has been shared with them
+func (s *JournalService) GetEntry(id uint, actor policy.Actor) (*models.JournalEntryDTO, error) {
 	var entry models.JournalEntry
-	if err := s.db.Preload("Tags").First(&entry, id).Error; err != nil {
+	if err := loadEntry(s.db.Preload("Tags"), actor, policy.CanRead, id, &entry); err != nil {
+		return nil, err
+	}
+
+	// Readers of a shared entry cannot set its mood, so only owners get a suggestion
+	dto := s.convertToDTO(&entry)
+	if actor.UserID == entry.UserID {
+		s.withSuggestedMood(dto, entry.UserID)
+		return dto, nil
+	}
+
+	hidden, err := locationHiddenBy(s.db, []uint{entry.UserID})
+	if err != nil {
+		return nil, err
+	}
+	if hidden[entry.UserID] {
+		dto.Location = nil
+	}
+	return dto, nil
+}
+
+// GetRenderedEntry is GetEntry with the content also rendered to sanitized HTML
+func (s *JournalService) GetRenderedEntry(id uint, actor policy.Actor) (*models.JournalEntryDTO, error) {
+	dto, err := s.GetEntry(id, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	html, ok := s.rendered.get(dto.ID, dto.Content)
+	if !ok {
+		html = markdown.Render(dto.Content)
+		s.rendered.set(dto.ID, dto.Content, html)
+	}
+	dto.ContentHTML = html
+	return dto, nil
+}
+
+// PreviewContent renders Markdown exactly as GetRenderedEntry would, without
+// saving or caching anything
+func (s *JournalService) PreviewContent(content string) string {
+	return markdown.Render(content)
+}
+
+// UpdateEntry replaces the editable fields of an entry. IsDraft is ignored;
+// drafts are turned into entries with PublishEntry.
+func (s *JournalService) UpdateEntry(id uint, actor policy.Actor, expectedVersion *uint, input EntryInput) (*models.JournalEntryDTO, error) {
+	entry, err := s.loadEntryForUpdate(id, actor, expectedVersion)
+	if err != nil {
 		return nil, err
 	}
 
-	if entry.UserID != userID {
-		return nil, errors.New("unauthorized")
+	if err := requireAssignableCategory(s.db, entry.UserID, input.CategoryID, entry.CategoryID); err != nil {
+		return nil, err
+	}
+
+	choice := moodChoice{name: input.Mood, create: input.CreateMood}
+	mood, err := choice.trimmed()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMoodIntensity(mood, input.MoodIntensity); err != nil {
+		return nil, err
+	}
+
+	// Update fields
+	entry.Title = input.Title
+	entry.Content = input.Content
+	entry.CategoryID = input.CategoryID
+	entry.MoodIntensity = input.MoodIntensity
+	analyzeContent(entry)
+
+	if err := applyEntryDate(entry, input.Date, entry.EntryTimezone, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if input.SetLocation {
+		if err := applyLocation(entry, input.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	// A nil tag list leaves the existing tags untouched; an empty one clears them
+	var tags *[]string
+	if input.Tags != nil {
+		tags = &input.Tags
+	}
+
+	return s.saveEntry(entry, &choice, tags)
+}
+
+// EntryPatch describes a partial update to an entry. Nil fields are left as
+// they are; SetCategory distinguishes "clear the category" from "unchanged".
+type EntryPatch struct {
+	Title       *string
+	Content     *string
+	SetCategory bool
+	CategoryID  *uint
+	Mood        *string
+	// CreateMood adds Mood to the user's moods when it is not one of them
+	CreateMood bool
+	Tags       *[]string
+	// SetMoodIntensity distinguishes clearing the intensity from leaving it
+	SetMoodIntensity bool
+	MoodIntensity    *uint8
+
+	EntryDate     *string
+	SetEntryTime  bool
+	EntryTime     *string
+	EntryTimezone *string
+
+	// SetLocation changes the location by merging Location into it, clearing
+	// it when nil
+	SetLocation bool
+	Location    *LocationPatch
+}
+
+// PatchEntry applies only the fields present in patch. A non-nil Tags replaces
+// the entry's tag set exactly, so an empty slice removes all tags.
+func (s *JournalService) PatchEntry(id uint, actor policy.Actor, expectedVersion *uint, patch EntryPatch) (*models.JournalEntryDTO, error) {
+	entry, err := s.loadEntryForUpdate(id, actor, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Title != nil {
+		entry.Title = *patch.Title
+	}
+	if patch.Content != nil {
+		entry.Content = *patch.Content
+	}
+	// Entries not analyzed yet are analyzed on their first edit
+	if patch.Content != nil || entry.AnalyzedAt == nil {
+		analyzeContent(entry)
+	}
+	if patch.SetCategory {
+		if err := requireAssignableCategory(s.db, entry.UserID, patch.CategoryID, entry.CategoryID); err != nil {
+			return nil, err
+		}
+		entry.CategoryID = patch.CategoryID
+	}
+	var choice *moodChoice
+	if patch.Mood != nil {
+		choice = &moodChoice{name: *patch.Mood, create: patch.CreateMood}
+		mood, err := choice.trimmed()
+		if err != nil {
+			return nil, err
+		}
+		entry.Mood = mood
+		// Clearing the mood clears what rated it
+		if mood == "" {
+			entry.MoodIntensity = nil
+		}
+	}
+	if patch.SetMoodIntensity {
+		entry.MoodIntensity = patch.MoodIntensity
+	}
+	if err := checkMoodIntensity(entry.Mood, entry.MoodIntensity); err != nil {
+		return nil, err
+	}
+
+	if patch.EntryDate != nil || patch.SetEntryTime || patch.EntryTimezone != nil {
+		// Start from the stored values so unpatched parts are kept
+		dto := s.convertToDTO(entry)
+		date := EntryDateInput{Date: dto.EntryDate, Timezone: dto.EntryTimezone}
+		if dto.EntryTime != nil {
+			date.Time = *dto.EntryTime
+		}
+		if patch.EntryDate != nil {
+			date.Date = *patch.EntryDate
+		}
+		if patch.SetEntryTime {
+			date.Time = ""
+			if patch.EntryTime != nil {
+				date.Time = *patch.EntryTime
+			}
+		}
+		if patch.EntryTimezone != nil {
+			date.Timezone = *patch.EntryTimezone
+		}
+		if err := applyEntryDate(entry, date, entry.EntryTimezone, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if patch.SetLocation {
+		var location *LocationInput
+		if patch.Location != nil {
+			location = patch.Location.mergeInto(entry)
+		}
+		if err := applyLocation(entry, location); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.saveEntry(entry, choice, patch.Tags)
+}
+
+// AutosaveDraft stores an in-progress title and/or content for a draft. It is
+// meant to be called frequently, so it skips versioning and leaves tags alone.
+func (s *JournalService) AutosaveDraft(id uint, actor policy.Actor, title, content *string) (*models.JournalEntryDTO, error) {
+	var entry models.JournalEntry
+	if err := loadEntry(s.db, actor, policy.CanWrite, id, &entry); err != nil {
+		return nil, err
+	}
+
+	if !entry.IsDraft {
+		return nil, ErrEntryNotDraft
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"autosaved_at": now}
+	if title != nil {
+		entry.Title = *title
+		updates["title"] = entry.Title
+	}
+	if content != nil {
+		entry.Content = *content
+		analyzeContent(&entry)
+		updates["content"] = entry.Content
+		for column, value := range contentAnalysisColumns(&entry) {
+			updates[column] = value
+		}
+	}
+	entry.AutosavedAt = &now
+
+	if err := s.db.Model(&entry).UpdateColumns(updates).Error; err != nil {
+		return nil, err
+	}
+	if content != nil {
+		s.rendered.Invalidate(entry.ID)
 	}
 
 	return s.convertToDTO(&entry), nil
 }
 
-func (s *JournalService) UpdateEntry(id uint, userID uint, title, content string, categoryID *uint, mood string, tagNames []string) (*models.JournalEntryDTO, error) {
+// PublishEntry turns a draft into a regular entry so it shows up in listings
+// and stats. Publishing an already published entry is a no-op.
+func (s *JournalService) PublishEntry(id uint, actor policy.Actor, expectedVersion *uint) (*models.JournalEntryDTO, error) {
+	entry, err := s.loadEntryForUpdate(id, actor, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.IsDraft {
+		return s.convertToDTO(entry), nil
+	}
+
+	entry.IsDraft = false
+	return s.saveEntry(entry, nil, nil)
+}
+
+// loadEntryForUpdate fetches an entry the actor may change and, when the
+// caller supplied one, checks it is still at the expected version
+func (s *JournalService) loadEntryForUpdate(id uint, actor policy.Actor, expectedVersion *uint) (*models.JournalEntry, error) {
 	var entry models.JournalEntry
-	if err := s.db.First(&entry, id).Error; err != nil {
+	if err := loadEntry(s.db.Preload("Tags"), actor, policy.CanWrite, id, &entry); err != nil {
 		return nil, err
 	}
 
-	if entry.UserID != userID {
-		return nil, errors.New("unauthorized")
+	// Reject edits made against an outdated copy of the entry
+	if expectedVersion != nil && *expectedVersion != entry.Version {
+		return nil, &VersionConflictError{Current: s.convertToDTO(&entry)}
 	}
 
-	// Update fields
-	entry.Title = title
-	entry.Content = content
-	entry.CategoryID = categoryID
-	entry.Mood = mood
-	entry.WordCount = uint(len(strings.Fields(content)))
-
-	// Handle tags
-	if len(tagNames) > 0 {
-		var tags []models.Tag
-		for _, tagName := range tagNames {
-			var tag models.Tag
-			err := s.db.Where("user_id = ? AND name = ?", userID, tagName).First(&tag).Error
-			if err == nil {
-				tags = append(tags, tag)
-			} else {
-				tag = models.Tag{
-					UserID: userID,
-					Name:   tagName,
-				}
-				if err := s.db.Create(&tag).Error; err != nil {
-					return nil, err
-				}
-				tags = append(tags, tag)
+	return &entry, nil
+}
+
+// saveEntry writes the entry's editable columns and bumps its version. A
+// non-nil mood is resolved against the user's moods first. When tagNames is
+// nil the tags are not touched; otherwise they replace the current set
+// exactly, in the same transaction.
+func (s *JournalService) saveEntry(entry *models.JournalEntry, mood *moodChoice, tagNames *[]string) (*models.JournalEntryDTO, error) {
+	currentVersion := entry.Version
+	entry.Version = currentVersion + 1
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the stored copy so its contribution to the daily stats can be
+		// swapped for the new one
+		var before models.JournalEntry
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("version = ?", currentVersion).
+			First(&before, entry.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errVersionChanged
+			}
+			return err
+		}
+
+		if mood != nil {
+			name, err := resolveMood(tx, entry.UserID, *mood)
+			if err != nil {
+				return err
 			}
+			entry.Mood = name
+		}
+
+		result := updateEntry(tx, entry, currentVersion)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errVersionChanged
+		}
+		if err := moveDailyStats(tx, &before, entry); err != nil {
+			return err
+		}
+
+		if tagNames == nil {
+			return nil
+		}
+
+		tags, err := resolveTags(tx, entry.UserID, *tagNames)
+		if err != nil {
+			return err
+		}
+		if err := setEntryTags(tx, entry.ID, tags); err != nil {
+			return err
 		}
 		entry.Tags = tags
+		return nil
+	})
+	if errors.Is(err, errVersionChanged) {
+		// Lost the race to a concurrent writer; report what is stored now
+		var current models.JournalEntry
+		if err := s.db.Preload("Tags").First(&current, entry.ID).Error; err != nil {
+			return nil, err
+		}
+		return nil, &VersionConflictError{Current: s.convertToDTO(&current)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.stats.Invalidate(entry.UserID)
+	s.rendered.Invalidate(entry.ID)
+
+	return s.withSuggestedMood(s.convertToDTO(entry), entry.UserID), nil
+}
+
+// updateEntry writes the saved columns of entry, only if nobody else has
+// bumped the version since it was read at currentVersion
+func updateEntry(tx *gorm.DB, entry *models.JournalEntry, currentVersion uint) *gorm.DB {
+	return tx.Model(entry).
+		Where("version = ?", currentVersion).
+		Select(savedEntryColumns).
+		Updates(entry)
+}
+
+func (s *JournalService) DeleteEntry(id uint, actor policy.Actor) error {
+	var entry models.JournalEntry
+	if err := loadEntry(s.db, actor, policy.CanWrite, id, &entry); err != nil {
+		return err
+	}
+
+	// Attachments go for good with the entry; their files are deleted once
+	// the rows are
+	var attachmentKeys []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		keys, err := removeAttachmentRows(tx, "entry_id = ?", entry.ID)
+		if err != nil {
+			return err
+		}
+		attachmentKeys = keys
+
+		if err := tx.Delete(&entry).Error; err != nil {
+			return err
+		}
+		return addDailyStats(tx, &entry, -1)
+	})
+	if err != nil {
+		return err
 	}
+	deleteBlobs(s.blobs, attachmentKeys)
+	s.stats.Invalidate(entry.UserID)
+	s.rendered.Invalidate(entry.ID)
+	return nil
+}
 
-	if err := s.db.Save(&entry).Error; err != nil {
+// GetEntryShares lists the emails an entry has been shared with. Invites to
+// emails without an account are listed the same way as shares with users, so
+// the list does not tell the owner which emails are registered.
+func (s *JournalService) GetEntryShares(id uint, actor policy.Actor) ([]models.EntryShareDTO, error) {
+	var entry models.JournalEntry
+	if err := loadEntry(s.db, actor, policy.CanWrite, id, &entry); err != nil {
 		return nil, err
 	}
 
-	return s.convertToDTO(&entry), nil
+	var shares []models.EntryShareDTO
+	if err := s.db.Model(&models.EntryShare{}).
+		Joins("JOIN users ON users.id = entry_shares.user_id").
+		Where("entry_shares.entry_id = ?", entry.ID).
+		Select("users.email, entry_shares.created_at as shared_at").
+		Scan(&shares).Error; err != nil {
+		return nil, err
+	}
+
+	var invites []models.EntryShareDTO
+	if err := s.db.Model(&models.EntryInvite{}).
+		Where("entry_id = ?", entry.ID).
+		Select("email, created_at as shared_at").
+		Scan(&invites).Error; err != nil {
+		return nil, err
+	}
+
+	dtos := append(make([]models.EntryShareDTO, 0, len(shares)+len(invites)), shares...)
+	dtos = append(dtos, invites...)
+	for i := range dtos {
+		dtos[i].Email = strings.ToLower(dtos[i].Email)
+	}
+	sort.Slice(dtos, func(a, b int) bool {
+		if !dtos[a].SharedAt.Equal(dtos[b].SharedAt) {
+			return dtos[a].SharedAt.Before(dtos[b].SharedAt)
+		}
+		return dtos[a].Email < dtos[b].Email
+	})
+	return dtos, nil
+}
+
+// ShareEntry gives whoever has the given email read-only access to an entry.
+// An email without an account gets an invite that becomes a share when
+// someone registers with it; either way the result is the same, so sharing
+// cannot be used to find out whether an email is registered. Sharing twice
+// with the same email is a no-op.
+func (s *JournalService) ShareEntry(id uint, actor policy.Actor, email string) ([]models.EntryShareDTO, error) {
+	email, err := normalizeShareEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry models.JournalEntry
+	if err := loadEntry(s.db, actor, policy.CanWrite, id, &entry); err != nil {
+		return nil, err
+	}
+
+	var reader models.User
+	err = s.db.Where("email = ?", email).First(&reader).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		invite := models.EntryInvite{EntryID: entry.ID, Email: email}
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&invite).Error; err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case reader.ID == entry.UserID:
+		return nil, ErrShareWithOwner
+	default:
+		share := models.EntryShare{EntryID: entry.ID, UserID: reader.ID}
+		if err := s.db.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&share).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetEntryShares(id, actor)
 }
 
-func (s *JournalService) DeleteEntry(id uint, userID uint) error {
+// UnshareEntry stops sharing an entry with an email, whether it belongs to a
+// reader or is still an invite
+func (s *JournalService) UnshareEntry(id uint, actor policy.Actor, email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+
 	var entry models.JournalEntry
-	if err := s.db.First(&entry, id).Error; err != nil {
+	if err := loadEntry(s.db, actor, policy.CanWrite, id, &entry); err != nil {
 		return err
 	}
 
-	if entry.UserID != userID {
-		return errors.New("unauthorized")
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		readers := tx.Model(&models.User{}).Select("id").Where("email = ?", email)
+		if err := tx.Where("entry_id = ? AND user_id IN (?)", entry.ID, readers).
+			Delete(&models.EntryShare{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("entry_id = ? AND email = ?", entry.ID, email).
+			Delete(&models.EntryInvite{}).Error
+	})
+}
+
+// normalizeShareEmail trims and lower-cases an email to share with, and
+// rejects anything that is not a bare address
+func normalizeShareEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) > 255 {
+		return "", ErrInvalidShareEmail
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", ErrInvalidShareEmail
+	}
+	return email, nil
+}
+
+// acceptEntryInvites turns the invites to email into shares with userID,
+// keeping when each entry was shared
+func acceptEntryInvites(tx *gorm.DB, userID uint, email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := tx.Exec(
+		"INSERT IGNORE INTO entry_shares (entry_id, user_id, created_at) SELECT entry_id, ?, created_at FROM entry_invites WHERE email = ?",
+		userID, email,
+	).Error; err != nil {
+		return err
+	}
+	return tx.Where("email = ?", email).Delete(&models.EntryInvite{}).Error
+}
+
+// ListSharedEntries returns published entries other users have shared with userID
+func (s *JournalService) ListSharedEntries(userID uint, page, pageSize int) ([]models.JournalEntryDTO, int64, error) {
+	var entries []models.JournalEntry
+	var total int64
+
+	query := s.db.Model(&models.JournalEntry{}).
+		Scopes(publishedOnly).
+		Joins("JOIN entry_shares ON entry_shares.entry_id = journal_entries.id").
+		Where("entry_shares.user_id = ?", userID)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Preload("Tags").
+		Order("journal_entries.entry_date DESC, journal_entries.entry_time DESC, journal_entries.created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&entries).Error; err != nil {
+		return nil, 0, err
 	}
 
-	return s.db.Delete(&entry).Error
+	// Owners can keep the location of their entries to themselves
+	ownerIDs := make([]uint, 0, len(entries))
+	for _, entry := range entries {
+		ownerIDs = append(ownerIDs, entry.UserID)
+	}
+	hidden, err := locationHiddenBy(s.db, ownerIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var dtos []models.JournalEntryDTO
+	for _, entry := range entries {
+		dto := s.convertToDTO(&entry)
+		if hidden[entry.UserID] {
+			dto.Location = nil
+		}
+		dtos = append(dtos, *dto)
+	}
+
+	return dtos, total, nil
 }
 
-func (s *JournalService) ListEntries(userID uint, categoryID *uint, tagID *uint, page, pageSize int) ([]models.JournalEntryDTO, int64, error) {
+func (s *JournalService) ListEntries(userID uint, filter EntryFilter, page, pageSize int) ([]models.JournalEntryDTO, int64, error) {
 	var entries []models.JournalEntry
 	var total int64
 
 	query := s.db.Model(&models.JournalEntry{}).Where("user_id = ?", userID)
 
-	if categoryID != nil {
-		query = query.Where("category_id = ?", *categoryID)
+	switch filter.Drafts {
+	case "include":
+	case "only":
+		query = query.Where("journal_entries.is_draft = ?", true)
+	default:
+		query = query.Scopes(publishedOnly)
 	}
 
-	if tagID != nil {
-		query = query.Joins("JOIN journal_entry_tags ON journal_entries.id = journal_entry_tags.entry_id").
-			Where("journal_entry_tags.tag_id = ?", *tagID)
+	if err := requireOwnedCategory(s.db, userID, filter.CategoryID); err != nil {
+		return nil, 0, err
+	}
+	if filter.TagID != nil {
+		if err := requireOwned(s.db, userID, "tag", *filter.TagID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if filter.CategoryID != nil {
+		if filter.IncludeSubcategories {
+			categoryIDs, err := categorySubtreeIDs(s.db, userID, *filter.CategoryID)
+			if err != nil {
+				return nil, 0, err
+			}
+			query = query.Where("category_id IN ?", categoryIDs)
+		} else {
+			query = query.Where("category_id = ?", *filter.CategoryID)
+		}
+	}
+
+	if filter.TagID != nil {
+		tagIDs := []uint{*filter.TagID}
+		if filter.IncludeSubtags {
+			var err error
+			if tagIDs, err = tagSubtreeIDs(s.db, userID, *filter.TagID); err != nil {
+				return nil, 0, err
+			}
+		}
+		query = query.Scopes(taggedWith(tagIDs))
+	}
+
+	if filter.From != nil {
+		query = query.Where("journal_entries.entry_date >= ?", calendarDate(*filter.From))
+	}
+
+	if filter.To != nil {
+		query = query.Where("journal_entries.entry_date <= ?", calendarDate(*filter.To))
+	}
+
+	if filter.Bounds != nil {
+		if err := filter.Bounds.validate(); err != nil {
+			return nil, 0, err
+		}
+		query = query.Scopes(withinBounds(*filter.Bounds))
+	}
+
+	if filter.Near != nil {
+		if err := filter.Near.validate(); err != nil {
+			return nil, 0, err
+		}
+		query = query.Scopes(withinRadius(*filter.Near))
 	}
 
 	// Get total count
@@ -156,7 +814,7 @@ func (s *JournalService) ListEntries(userID uint, categoryID *uint, tagID *uint,
 
 	// Get paginated results
 	if err := query.Preload("Tags").
-		Order("created_at DESC").
+		Order("entry_date DESC, entry_time DESC, created_at DESC").
 		Offset((page - 1) * pageSize).
 		Limit(pageSize).
 		Find(&entries).Error; err != nil {
@@ -172,82 +830,146 @@ func (s *JournalService) ListEntries(userID uint, categoryID *uint, tagID *uint,
 	return dtos, total, nil
 }
 
-func (s *JournalService) GetEntryStats(userID uint) (map[string]interface{}, error) {
-	var stats struct {
-		TotalEntries     int64
-		TotalWords       int64
-		AvgWordsPerEntry float64
-		CategoryCount    int64
-		TagCount         int64
-		MoodDistribution []struct {
-			Mood  string
-			Count int64
-		}
-		CategoryDistribution []struct {
-			Category string
-			Count    int64
-		}
+// GetEntryStats summarizes the user's published entries. When tagID is set
+// only entries carrying that tag or one of its descendants are counted.
+// Overall stats are read from the daily aggregates and cached per user.
+func (s *JournalService) GetEntryStats(userID uint, tagID *uint) (*models.EntryStatsDTO, error) {
+	if tagID != nil {
+		return s.taggedEntryStats(userID, *tagID)
 	}
 
-	// Get total entries and words
-	if err := s.db.Model(&models.JournalEntry{}).
+	stats := &models.EntryStatsDTO{}
+	if s.stats.get(userID, stats) {
+		return stats, nil
+	}
+
+	// Get total entries, words and average sentiment
+	if err := s.db.Model(&models.DailyEntryStats{}).
 		Where("user_id = ?", userID).
-		Count(&stats.TotalEntries).Error; err != nil {
+		Select("COALESCE(SUM(entries), 0) as total_entries, COALESCE(SUM(words), 0) as total_words, " +
+			"SUM(sentiment_sum) / NULLIF(SUM(sentiment_entries), 0) as average_sentiment").
+		Scan(stats).Error; err != nil {
 		return nil, err
 	}
 
-	if err := s.db.Model(&models.JournalEntry{}).
+	// Get mood distribution
+	if err := s.db.Model(&models.DailyEntryStats{}).
 		Where("user_id = ?", userID).
-		Select("COALESCE(SUM(word_count), 0)").
-		Scan(&stats.TotalWords).Error; err != nil {
+		Select("mood, SUM(entries) as count").
+		Group("mood").
+		Scan(&stats.MoodDistribution).Error; err != nil {
 		return nil, err
 	}
 
-	if stats.TotalEntries > 0 {
-		stats.AvgWordsPerEntry = float64(stats.TotalWords) / float64(stats.TotalEntries)
+	// Get category distribution; category 0 and categories since deleted
+	// count as uncategorized
+	if err := s.db.Model(&models.DailyEntryStats{}).
+		Where("daily_entry_stats.user_id = ?", userID).
+		Joins("LEFT JOIN categories ON daily_entry_stats.category_id = categories.id AND categories.user_id = daily_entry_stats.user_id").
+		Select("COALESCE(categories.name, 'Uncategorized') as category, SUM(daily_entry_stats.entries) as count").
+		Group("categories.name").
+		Scan(&stats.CategoryDistribution).Error; err != nil {
+		return nil, err
 	}
 
-	// Get category and tag counts
-	if err := s.db.Model(&models.Category{}).
-		Where("user_id = ?", userID).
-		Count(&stats.CategoryCount).Error; err != nil {
+	dates, err := activeDates(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.completeEntryStats(stats, userID, dates); err != nil {
 		return nil, err
 	}
 
-	if err := s.db.Model(&models.Tag{}).
-		Where("user_id = ?", userID).
-		Count(&stats.TagCount).Error; err != nil {
+	s.stats.set(userID, stats)
+	return stats, nil
+}
+
+// taggedEntryStats computes the stats of entries under a tag from the entries
+// themselves, since the daily aggregates are not split by tag
+func (s *JournalService) taggedEntryStats(userID, tagID uint) (*models.EntryStatsDTO, error) {
+	if err := requireOwned(s.db, userID, "tag", tagID); err != nil {
+		return nil, err
+	}
+	tagIDs, err := tagSubtreeIDs(s.db, userID, tagID)
+	if err != nil {
+		return nil, err
+	}
+	entryScopes := []func(*gorm.DB) *gorm.DB{publishedOnly, taggedWith(tagIDs)}
+
+	stats := &models.EntryStatsDTO{}
+
+	// Get total entries, words and average sentiment
+	if err := s.db.Model(&models.JournalEntry{}).
+		Scopes(entryScopes...).
+		Where("journal_entries.user_id = ?", userID).
+		Select("COUNT(*) as total_entries, COALESCE(SUM(journal_entries.word_count), 0) as total_words, " +
+			"AVG(journal_entries.sentiment) as average_sentiment").
+		Scan(stats).Error; err != nil {
 		return nil, err
 	}
 
 	// Get mood distribution
 	if err := s.db.Model(&models.JournalEntry{}).
-		Where("user_id = ?", userID).
-		Select("mood, COUNT(*) as count").
-		Group("mood").
+		Scopes(entryScopes...).
+		Where("journal_entries.user_id = ?", userID).
+		Select("journal_entries.mood, COUNT(*) as count").
+		Group("journal_entries.mood").
 		Scan(&stats.MoodDistribution).Error; err != nil {
 		return nil, err
 	}
 
 	// Get category distribution with LEFT JOIN to include entries without categories
 	if err := s.db.Model(&models.JournalEntry{}).
+		Scopes(entryScopes...).
 		Where("journal_entries.user_id = ?", userID).
-		Joins("LEFT JOIN categories ON journal_entries.category_id = categories.id").
+		Joins("LEFT JOIN categories ON journal_entries.category_id = categories.id AND categories.user_id = journal_entries.user_id").
 		Select("COALESCE(categories.name, 'Uncategorized') as category, COUNT(*) as count").
 		Group("categories.name").
 		Scan(&stats.CategoryDistribution).Error; err != nil {
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"totalEntries":         stats.TotalEntries,
-		"totalWords":           stats.TotalWords,
-		"avgWordsPerEntry":     stats.AvgWordsPerEntry,
-		"categoryCount":        stats.CategoryCount,
-		"tagCount":             stats.TagCount,
-		"moodDistribution":     stats.MoodDistribution,
-		"categoryDistribution": stats.CategoryDistribution,
-	}, nil
+	dates, err := publishedEntryDates(s.db, userID, taggedWith(tagIDs))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.completeEntryStats(stats, userID, dates); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// completeEntryStats fills in the parts of stats shared by every filter: the
+// average, category and tag counts, and streaks over the active dates
+func (s *JournalService) completeEntryStats(stats *models.EntryStatsDTO, userID uint, dates []time.Time) error {
+	if stats.TotalEntries > 0 {
+		stats.AvgWordsPerEntry = float64(stats.TotalWords) / float64(stats.TotalEntries)
+	}
+	if stats.MoodDistribution == nil {
+		stats.MoodDistribution = []models.MoodDistributionDTO{}
+	}
+	if stats.CategoryDistribution == nil {
+		stats.CategoryDistribution = []models.CategoryDistributionDTO{}
+	}
+
+	// Get category and tag counts
+	if err := s.db.Model(&models.Category{}).
+		Where("user_id = ?", userID).
+		Count(&stats.CategoryCount).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Model(&models.Tag{}).
+		Where("user_id = ?", userID).
+		Count(&stats.TagCount).Error; err != nil {
+		return err
+	}
+
+	// Streaks are counted in days of the user's own timezone
+	today := calendarDate(time.Now().In(userLocation(s.db, userID)))
+	stats.CurrentStreak, stats.LongestStreak = entryStreaks(dates, today)
+	return nil
 }
 
 func (s *JournalService) convertToDTO(entry *models.JournalEntry) *models.JournalEntryDTO {
@@ -259,15 +981,96 @@ func (s *JournalService) convertToDTO(entry *models.JournalEntry) *models.Journa
 		})
 	}
 
+	var entryTime *string
+	if entry.EntryTime != nil {
+		// Stored as HH:MM:SS; clients only deal in minutes
+		t := *entry.EntryTime
+		if len(t) > 5 {
+			t = t[:5]
+		}
+		entryTime = &t
+	}
+
 	return &models.JournalEntryDTO{
-		ID:         entry.ID,
-		Title:      entry.Title,
-		Content:    entry.Content,
-		CategoryID: entry.CategoryID,
-		Mood:       entry.Mood,
-		WordCount:  entry.WordCount,
-		Tags:       tagDTOs,
-		CreatedAt:  entry.CreatedAt,
-		UpdatedAt:  entry.UpdatedAt,
+		ID:             entry.ID,
+		Title:          entry.Title,
+		Content:        entry.Content,
+		CategoryID:     entry.CategoryID,
+		Mood:           entry.Mood,
+		MoodIntensity:  entry.MoodIntensity,
+		Sentiment:      entry.Sentiment,
+		WordCount:      entry.WordCount,
+		CharacterCount: entry.CharacterCount,
+		SentenceCount:  entry.SentenceCount,
+		ReadingSeconds: entry.ReadingSeconds,
+		Readability:    entry.Readability,
+		Version:        entry.Version,
+		IsDraft:        entry.IsDraft,
+		AutosavedAt:    entry.AutosavedAt,
+		EntryDate:      entry.EntryDate.Format("2006-01-02"),
+		EntryTime:      entryTime,
+		EntryTimezone:  entry.EntryTimezone,
+		Location:       locationDTO(entry),
+		Tags:           tagDTOs,
+		CreatedAt:      entry.CreatedAt,
+		UpdatedAt:      entry.UpdatedAt,
+	}
+}
+
+// applyEntryDate validates and stores the entry's date, time and timezone. An
+// empty Date keeps the existing date (or uses the current moment in the
+// entry's timezone for new entries); an empty Timezone falls back to
+// fallbackZone. The entry is left as it was when any of them is invalid.
+func applyEntryDate(entry *models.JournalEntry, input EntryDateInput, fallbackZone string, now time.Time) error {
+	zone := input.Timezone
+	if zone == "" {
+		zone = fallbackZone
+	}
+	if zone == "" {
+		zone = defaultTimezone
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return ErrInvalidEntryDate
+	}
+
+	if input.Date == "" {
+		entry.EntryTimezone = zone
+		if entry.EntryDate.IsZero() {
+			local := now.In(loc)
+			entryTime := local.Format("15:04:05")
+			entry.EntryDate = calendarDate(local)
+			entry.EntryTime = &entryTime
+		}
+		return nil
+	}
+
+	date, err := time.Parse("2006-01-02", input.Date)
+	if err != nil {
+		return ErrInvalidEntryDate
+	}
+	var entryTime *string
+	if input.Time != "" {
+		t, err := time.Parse("15:04", input.Time)
+		if err != nil {
+			if t, err = time.Parse("15:04:05", input.Time); err != nil {
+				return ErrInvalidEntryDate
+			}
+		}
+		formatted := t.Format("15:04:05")
+		entryTime = &formatted
 	}
+
+	entry.EntryTimezone = zone
+	entry.EntryDate = calendarDate(date)
+	entry.EntryTime = entryTime
+	return nil
+}
+
+// calendarDate strips the clock from t, keeping its year, month and day. The
+// result is expressed in UTC, the database connection's location, so the DATE
+// column stores exactly that day.
+func calendarDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
 }
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"journal/models"
+)
+
+func TestSavedEntryColumnsCoverAnalysis(t *testing.T) {
+	for column := range contentAnalysisColumns(&models.JournalEntry{}) {
+		if !slices.Contains(savedEntryColumns, column) {
+			t.Errorf("saveEntry does not write %q, which analyzeContent sets", column)
+		}
+	}
+}
+
+func TestUpdateEntryWritesAnalysis(t *testing.T) {
+	db, recorder := dryRunDB(t)
+
+	entry := models.JournalEntry{UserID: 3, Title: "Walk", Content: "A long walk by the sea.", Version: 3, EntryDate: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)}
+	entry.ID = 9
+	analyzeContent(&entry)
+	if err := updateEntry(db, &entry, 2).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatements(t, recorder.statements, []string{"UPDATE `journal_entries` SET"})
+	for _, fragment := range []string{"`analyzed_at`='", "`word_count`=6", "`version`=3", "WHERE version = 2 AND", "`id` = 9"} {
+		if !strings.Contains(recorder.statements[0], fragment) {
+			t.Errorf("update = %q, want it to contain %q", recorder.statements[0], fragment)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"journal/models"
+
+	"gorm.io/gorm"
+)
+
+// earthRadius is the mean radius of the Earth in meters
+const earthRadius = 6371000
+
+var (
+	// ErrInvalidLocation is returned for coordinates out of range, a latitude
+	// without a longitude or the other way round, or an accuracy without
+	// coordinates
+	ErrInvalidLocation = errors.New("invalid location")
+	// ErrInvalidBounds is returned for a bounding box or radius search that
+	// does not describe an area on the globe
+	ErrInvalidBounds = errors.New("invalid bounding box or radius")
+)
+
+// LocationInput is where an entry was written. Coordinates are WGS 84
+// degrees and optional when a place name is given; Accuracy is in meters.
+type LocationInput struct {
+	Latitude  *float64
+	Longitude *float64
+	PlaceName string
+	Accuracy  *float64
+}
+
+// LocationPatch changes some fields of an entry's location and leaves the
+// rest. A Set flag without a value removes that field.
+type LocationPatch struct {
+	SetLatitude  bool
+	Latitude     *float64
+	SetLongitude bool
+	Longitude    *float64
+	PlaceName    *string
+	SetAccuracy  bool
+	Accuracy     *float64
+}
+
+// mergeInto returns the entry's current location with the patch applied
+func (p *LocationPatch) mergeInto(entry *models.JournalEntry) *LocationInput {
+	location := &LocationInput{
+		Latitude:  entry.Latitude,
+		Longitude: entry.Longitude,
+		PlaceName: entry.PlaceName,
+		Accuracy:  entry.LocationAccuracy,
+	}
+	if p.SetLatitude {
+		location.Latitude = p.Latitude
+	}
+	if p.SetLongitude {
+		location.Longitude = p.Longitude
+	}
+	if p.PlaceName != nil {
+		location.PlaceName = *p.PlaceName
+	}
+	if p.SetAccuracy {
+		location.Accuracy = p.Accuracy
+	}
+	return location
+}
+
+// BoundingBox is an area between two parallels and two meridians. When West
+// is greater than East the box crosses the antimeridian.
+type BoundingBox struct {
+	West, South, East, North float64
+}
+
+// Radius is the area within Meters of a point
+type Radius struct {
+	Latitude, Longitude, Meters float64
+}
+
+func (b BoundingBox) validate() error {
+	if !validLatitude(b.South) || !validLatitude(b.North) || b.South > b.North ||
+		!validLongitude(b.West) || !validLongitude(b.East) {
+		return ErrInvalidBounds
+	}
+	return nil
+}
+
+func (r Radius) validate() error {
+	// Half the circumference reaches every point on the globe
+	if !validLatitude(r.Latitude) || !validLongitude(r.Longitude) ||
+		!(r.Meters > 0 && r.Meters <= math.Pi*earthRadius) {
+		return ErrInvalidBounds
+	}
+	return nil
+}
+
+// bounds returns the smallest bounding box around the circle, so the index
+// on the coordinates can narrow a radius search before distances are worked
+// out
+func (r Radius) bounds() BoundingBox {
+	angle := r.Meters / earthRadius
+	latDelta := angle * 180 / math.Pi
+
+	box := BoundingBox{
+		West:  -180,
+		South: math.Max(-90, r.Latitude-latDelta),
+		East:  180,
+		North: math.Min(90, r.Latitude+latDelta),
+	}
+	// A circle around a pole covers every longitude
+	if box.South == -90 || box.North == 90 {
+		return box
+	}
+
+	ratio := math.Sin(angle) / math.Cos(r.Latitude*math.Pi/180)
+	if ratio >= 1 {
+		return box
+	}
+	lonDelta := math.Asin(ratio) * 180 / math.Pi
+	box.West = r.Longitude - lonDelta
+	box.East = r.Longitude + lonDelta
+	if box.West < -180 {
+		box.West += 360
+	}
+	if box.East > 180 {
+		box.East -= 360
+	}
+	return box
+}
+
+// withinBounds restricts a journal_entries query to entries located in box
+func withinBounds(box BoundingBox) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("journal_entries.latitude BETWEEN ? AND ?", box.South, box.North)
+		if box.West <= box.East {
+			return db.Where("journal_entries.longitude BETWEEN ? AND ?", box.West, box.East)
+		}
+		return db.Where("(journal_entries.longitude >= ? OR journal_entries.longitude <= ?)", box.West, box.East)
+	}
+}
+
+// withinRadius restricts a journal_entries query to entries located within
+// the radius, measured along the surface of the Earth
+func withinRadius(radius Radius) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(withinBounds(radius.bounds())).
+			Where("ST_Distance_Sphere(POINT(journal_entries.longitude, journal_entries.latitude), POINT(?, ?)) <= ?",
+				radius.Longitude, radius.Latitude, radius.Meters)
+	}
+}
+
+// applyLocation validates and stores the entry's location. A nil input, or
+// one without coordinates or a place name, clears it.
+func applyLocation(entry *models.JournalEntry, input *LocationInput) error {
+	entry.Latitude = nil
+	entry.Longitude = nil
+	entry.PlaceName = ""
+	entry.LocationAccuracy = nil
+	if input == nil {
+		return nil
+	}
+
+	if (input.Latitude == nil) != (input.Longitude == nil) {
+		return ErrInvalidLocation
+	}
+	if input.Latitude != nil && (!validLatitude(*input.Latitude) || !validLongitude(*input.Longitude)) {
+		return ErrInvalidLocation
+	}
+	if input.Accuracy != nil && (input.Latitude == nil || !(*input.Accuracy >= 0) || math.IsInf(*input.Accuracy, 1)) {
+		return ErrInvalidLocation
+	}
+
+	placeName := strings.TrimSpace(input.PlaceName)
+	if utf8.RuneCountInString(placeName) > 255 {
+		return ErrInvalidLocation
+	}
+
+	entry.Latitude = input.Latitude
+	entry.Longitude = input.Longitude
+	entry.PlaceName = placeName
+	entry.LocationAccuracy = input.Accuracy
+	return nil
+}
+
+// locationDTO returns the entry's location, or nil when it has none
+func locationDTO(entry *models.JournalEntry) *models.EntryLocationDTO {
+	if entry.Latitude == nil && entry.PlaceName == "" {
+		return nil
+	}
+	return &models.EntryLocationDTO{
+		Latitude:  entry.Latitude,
+		Longitude: entry.Longitude,
+		PlaceName: entry.PlaceName,
+		Accuracy:  entry.LocationAccuracy,
+	}
+}
+
+// locationHiddenBy returns which of the given users have chosen to keep the
+// location of their entries from everyone else
+func locationHiddenBy(db *gorm.DB, userIDs []uint) (map[uint]bool, error) {
+	hidden := make(map[uint]bool)
+	if len(userIDs) == 0 {
+		return hidden, nil
+	}
+
+	var ids []uint
+	if err := db.Model(&models.UserPreferences{}).
+		Where("user_id IN ? AND hide_location = ?", userIDs, true).
+		Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hidden[id] = true
+	}
+	return hidden, nil
+}
+
+func validLatitude(lat float64) bool {
+	return lat >= -90 && lat <= 90
+}
+
+func validLongitude(lon float64) bool {
+	return lon >= -180 && lon <= 180
+}
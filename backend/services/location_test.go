@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"journal/models"
+)
+
+func TestLocationPatchMergeInto(t *testing.T) {
+	lat, lon, accuracy := 52.37, 4.89, 15.0
+	newLat := -33.87
+	placeName := "Home"
+	removed := ""
+
+	located := models.JournalEntry{Latitude: &lat, Longitude: &lon, PlaceName: "Office", LocationAccuracy: &accuracy}
+
+	tests := []struct {
+		name  string
+		entry models.JournalEntry
+		patch LocationPatch
+		want  LocationInput
+	}{
+		{
+			name:  "empty patch keeps everything",
+			entry: located,
+			want:  LocationInput{Latitude: &lat, Longitude: &lon, PlaceName: "Office", Accuracy: &accuracy},
+		},
+		{
+			name:  "place name keeps coordinates",
+			entry: located,
+			patch: LocationPatch{PlaceName: &placeName},
+			want:  LocationInput{Latitude: &lat, Longitude: &lon, PlaceName: "Home", Accuracy: &accuracy},
+		},
+		{
+			name:  "removed members are cleared",
+			entry: located,
+			patch: LocationPatch{PlaceName: &removed, SetAccuracy: true},
+			want:  LocationInput{Latitude: &lat, Longitude: &lon},
+		},
+		{
+			name:  "latitude alone",
+			entry: located,
+			patch: LocationPatch{SetLatitude: true, Latitude: &newLat},
+			want:  LocationInput{Latitude: &newLat, Longitude: &lon, PlaceName: "Office", Accuracy: &accuracy},
+		},
+		{
+			name:  "entry without a location",
+			patch: LocationPatch{PlaceName: &placeName},
+			want:  LocationInput{PlaceName: "Home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := tt.entry
+			got := tt.patch.mergeInto(&entry)
+			if !sameFloat(got.Latitude, tt.want.Latitude) || !sameFloat(got.Longitude, tt.want.Longitude) ||
+				!sameFloat(got.Accuracy, tt.want.Accuracy) || got.PlaceName != tt.want.PlaceName {
+				t.Errorf("mergeInto() = %s, want %s", describeLocation(got), describeLocation(&tt.want))
+			}
+		})
+	}
+}
+
+func sameFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func describeLocation(l *LocationInput) string {
+	value := func(f *float64) string {
+		if f == nil {
+			return "nil"
+		}
+		return strconv.FormatFloat(*f, 'g', -1, 64)
+	}
+	return fmt.Sprintf("{%s %s %q %s}", value(l.Latitude), value(l.Longitude), l.PlaceName, value(l.Accuracy))
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"journal/models"
+	"journal/policy"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidMoodName      = errors.New("invalid mood name")
+	ErrMoodNameTaken        = errors.New("mood name already taken")
+	ErrInvalidMoodEmoji     = errors.New("invalid mood emoji")
+	ErrInvalidMoodColor     = errors.New("invalid mood color")
+	ErrInvalidMoodValence   = errors.New("invalid mood valence")
+	ErrMoodInUse            = errors.New("mood is used by entries")
+	ErrInvalidMoodIntensity = errors.New("invalid mood intensity")
+	ErrUnknownMood          = errors.New("unknown mood")
+)
+
+const (
+	maxMoodNameLength = 50
+	// maxMoodEmojiLength is in runes, enough for flags and skin tone sequences
+	maxMoodEmojiLength = 8
+	minMoodValence     = -2
+	maxMoodValence     = 2
+	maxMoodIntensity   = 10
+	defaultMoodColor   = "#A9A9A9"
+)
+
+// defaultMoods is the vocabulary every user starts with, matching the moods
+// the entry editor has always offered
+var defaultMoods = []models.Mood{
+	{Name: "Happy", Emoji: "😊", Color: "#FFD700", Valence: 2},
+	{Name: "Sad", Emoji: "😢", Color: "#4169E1", Valence: -2},
+	{Name: "Angry", Emoji: "😠", Color: "#DC143C", Valence: -2},
+	{Name: "Excited", Emoji: "🤩", Color: "#FF8C00", Valence: 2},
+	{Name: "Peaceful", Emoji: "😌", Color: "#3CB371", Valence: 1},
+	{Name: "Neutral", Emoji: "😐", Color: "#A9A9A9", Valence: 0},
+	{Name: "Anxious", Emoji: "😟", Color: "#9370DB", Valence: -1},
+	{Name: "Grateful", Emoji: "🙏", Color: "#FF69B4", Valence: 2},
+	{Name: "Frustrated", Emoji: "😤", Color: "#CD5C5C", Valence: -1},
+	{Name: "Hopeful", Emoji: "🌱", Color: "#00CED1", Valence: 1},
+}
+
+type MoodService struct {
+	db       *gorm.DB
+	stats    *StatsCache
+	rendered *RenderCache
+}
+
+func NewMoodService(db *gorm.DB, stats *StatsCache, rendered *RenderCache) *MoodService {
+	return &MoodService{db: db, stats: stats, rendered: rendered}
+}
+
+// GetMoods lists a user's moods by name, with how many entries use each
+func (s *MoodService) GetMoods(userID uint) ([]models.MoodDTO, error) {
+	var moods []models.Mood
+	if err := s.db.Where("user_id = ?", userID).Order("name").Find(&moods).Error; err != nil {
+		return nil, err
+	}
+
+	counts, err := moodUsage(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dtos := make([]models.MoodDTO, 0, len(moods))
+	for _, mood := range moods {
+		dto := toMoodDTO(&mood)
+		dto.Entries = counts[strings.ToLower(mood.Name)]
+		dtos = append(dtos, dto)
+	}
+	return dtos, nil
+}
+
+// CreateMood adds a mood to a user's vocabulary
+func (s *MoodService) CreateMood(userID uint, moodDTO models.MoodDTO) (*models.MoodDTO, error) {
+	mood := models.Mood{UserID: userID}
+	if err := s.applyMood(&mood, moodDTO); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&mood).Error; err != nil {
+		return nil, err
+	}
+
+	dto := toMoodDTO(&mood)
+	return &dto, nil
+}
+
+// UpdateMood changes a mood. Renaming it renames it on every entry that uses it.
+func (s *MoodService) UpdateMood(moodID uint, actor policy.Actor, moodDTO models.MoodDTO) (*models.MoodDTO, error) {
+	var mood models.Mood
+	if err := loadAuthorized(s.db, actor, policy.CanWrite, &mood, moodID); err != nil {
+		return nil, err
+	}
+	oldName := mood.Name
+
+	if err := s.applyMood(&mood, moodDTO); err != nil {
+		return nil, err
+	}
+
+	var changed []uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&mood).Error; err != nil {
+			return err
+		}
+		if mood.Name == oldName {
+			return nil
+		}
+
+		var err error
+		changed, err = changeEntryMoods(tx, mood.UserID, oldName, map[string]interface{}{"mood": mood.Name})
+		if err != nil {
+			return err
+		}
+		return rebuildDailyStats(tx, mood.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(mood.UserID, changed)
+
+	dto := toMoodDTO(&mood)
+	return &dto, nil
+}
+
+// DeleteMood removes a mood. A mood that is still on entries is only deleted
+// when detach is set, in which case those entries lose their mood.
+func (s *MoodService) DeleteMood(moodID uint, actor policy.Actor, detach bool) error {
+	var mood models.Mood
+	if err := loadAuthorized(s.db, actor, policy.CanWrite, &mood, moodID); err != nil {
+		return err
+	}
+
+	var changed []uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var usage int64
+		if err := tx.Model(&models.JournalEntry{}).
+			Where("user_id = ? AND mood = ?", mood.UserID, mood.Name).
+			Count(&usage).Error; err != nil {
+			return err
+		}
+		if usage > 0 {
+			if !detach {
+				return ErrMoodInUse
+			}
+			var err error
+			changed, err = changeEntryMoods(tx, mood.UserID, mood.Name, map[string]interface{}{"mood": "", "mood_intensity": nil})
+			if err != nil {
+				return err
+			}
+			if err := rebuildDailyStats(tx, mood.UserID); err != nil {
+				return err
+			}
+		}
+
+		// Hard delete so the name can be reused under idx_mood_user_name
+		return tx.Unscoped().Delete(&mood).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(mood.UserID, changed)
+	return nil
+}
+
+// invalidate drops the cached stats of a user and the cached renders of
+// entries whose mood changed
+func (s *MoodService) invalidate(userID uint, entryIDs []uint) {
+	s.stats.Invalidate(userID)
+	for _, id := range entryIDs {
+		s.rendered.Invalidate(id)
+	}
+}
+
+// changeEntryMoods applies columns to every entry of the user with the given
+// mood, including deleted ones, and returns their IDs. Each entry's version is
+// bumped so clients holding an older copy get a conflict instead of
+// overwriting the change.
+func changeEntryMoods(tx *gorm.DB, userID uint, mood string, columns map[string]interface{}) ([]uint, error) {
+	var ids []uint
+	if err := tx.Unscoped().Model(&models.JournalEntry{}).
+		Where("user_id = ? AND mood = ?", userID, mood).
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	columns["version"] = gorm.Expr("version + 1")
+	if err := tx.Unscoped().Model(&models.JournalEntry{}).
+		Where("id IN ?", ids).
+		UpdateColumns(columns).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// applyMood validates moodDTO and copies it onto mood. An empty color keeps
+// the current one, or the default for a new mood.
+func (s *MoodService) applyMood(mood *models.Mood, moodDTO models.MoodDTO) error {
+	name := strings.TrimSpace(moodDTO.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxMoodNameLength {
+		return ErrInvalidMoodName
+	}
+
+	var taken int64
+	if err := s.db.Model(&models.Mood{}).
+		Where("user_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", mood.UserID, name, mood.ID).
+		Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrMoodNameTaken
+	}
+
+	emoji := strings.TrimSpace(moodDTO.Emoji)
+	if utf8.RuneCountInString(emoji) > maxMoodEmojiLength {
+		return ErrInvalidMoodEmoji
+	}
+
+	color := moodDTO.Color
+	if strings.TrimSpace(color) == "" {
+		color = mood.Color
+	}
+	if color == "" {
+		color = defaultMoodColor
+	}
+	color, err := normalizeCategoryColor(color)
+	if err != nil {
+		return ErrInvalidMoodColor
+	}
+
+	if moodDTO.Valence < minMoodValence || moodDTO.Valence > maxMoodValence {
+		return ErrInvalidMoodValence
+	}
+
+	mood.Name = name
+	mood.Emoji = emoji
+	mood.Color = color
+	mood.Valence = moodDTO.Valence
+	return nil
+}
+
+// createDefaultMoods gives a new user the default mood vocabulary
+func createDefaultMoods(db *gorm.DB, userID uint) error {
+	moods := make([]models.Mood, len(defaultMoods))
+	for i, mood := range defaultMoods {
+		mood.UserID = userID
+		moods[i] = mood
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&moods).Error
+}
+
+// moodChoice is the mood picked for an entry. create adds a mood that is not
+// one of the user's moods yet, instead of rejecting it.
+type moodChoice struct {
+	name   string
+	create bool
+}
+
+// trimmed returns the mood name without surrounding spaces, checking its length
+func (c moodChoice) trimmed() (string, error) {
+	mood := strings.TrimSpace(c.name)
+	if utf8.RuneCountInString(mood) > maxMoodNameLength {
+		return "", ErrInvalidMoodName
+	}
+	return mood, nil
+}
+
+// resolveMood finds the chosen mood in the user's vocabulary, ignoring case
+// and surrounding spaces, and returns it as spelled there. A mood that is not
+// in the vocabulary is rejected with ErrUnknownMood, or added to it as a
+// neutral mood when the choice allows. An empty mood is allowed. Run it in the
+// transaction that writes the entry, so a failed write adds no mood.
+func resolveMood(tx *gorm.DB, userID uint, choice moodChoice) (string, error) {
+	mood, err := choice.trimmed()
+	if err != nil || mood == "" {
+		return "", err
+	}
+
+	var known models.Mood
+	err = tx.Where("user_id = ? AND LOWER(name) = LOWER(?)", userID, mood).First(&known).Error
+	if err == nil {
+		return known.Name, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if !choice.create {
+		return "", ErrUnknownMood
+	}
+
+	// Another request may add the same mood meanwhile; whichever spelling
+	// wins idx_mood_user_name is used
+	created := models.Mood{UserID: userID, Name: mood, Color: defaultMoodColor}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&created).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Where("user_id = ? AND LOWER(name) = LOWER(?)", userID, mood).First(&known).Error; err != nil {
+		return "", err
+	}
+	return known.Name, nil
+}
+
+// checkMoodIntensity validates an optional intensity, which needs a mood to rate
+func checkMoodIntensity(mood string, intensity *uint8) error {
+	if intensity == nil {
+		return nil
+	}
+	if mood == "" || *intensity < 1 || *intensity > maxMoodIntensity {
+		return ErrInvalidMoodIntensity
+	}
+	return nil
+}
+
+// moodUsage counts the user's entries per lower-cased mood name
+func moodUsage(db *gorm.DB, userID uint) (map[string]int64, error) {
+	var usage []struct {
+		Mood    string
+		Entries int64
+	}
+	if err := db.Model(&models.JournalEntry{}).
+		Where("user_id = ? AND mood <> ''", userID).
+		Select("mood, COUNT(*) as entries").
+		Group("mood").
+		Scan(&usage).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(usage))
+	for _, u := range usage {
+		counts[strings.ToLower(u.Mood)] += u.Entries
+	}
+	return counts, nil
+}
+
+// moodValences maps the lower-cased names of a user's moods to their valence
+func moodValences(db *gorm.DB, userID uint) (map[string]float64, error) {
+	var moods []models.Mood
+	if err := db.Where("user_id = ?", userID).Find(&moods).Error; err != nil {
+		return nil, err
+	}
+
+	valences := make(map[string]float64, len(moods))
+	for _, mood := range moods {
+		valences[strings.ToLower(mood.Name)] = float64(mood.Valence)
+	}
+	return valences, nil
+}
+
+func toMoodDTO(mood *models.Mood) models.MoodDTO {
+	return models.MoodDTO{
+		ID:      mood.ID,
+		Name:    mood.Name,
+		Emoji:   mood.Emoji,
+		Color:   mood.Color,
+		Valence: mood.Valence,
+	}
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"journal/models"
+)
+
+const (
+	// minCorrelationEntries is how many entries with a mood a tag or category
+	// needs before its correlations are reported
+	minCorrelationEntries = 5
+	// maxMoodCorrelations caps each correlation list, strongest first
+	maxMoodCorrelations = 20
+)
+
+// GetMoodStats reports how the user's moods change over time and by weekday,
+// and which tags and categories go with which moods. Averages use the
+// valences of the user's moods. The range and interval work as in
+// GetEntryTimeSeries. Entries without a mood are left out.
+func (s *JournalService) GetMoodStats(userID uint, interval string, from, to *time.Time) (*models.MoodStatsDTO, error) {
+	start, end, err := s.statsRange(userID, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var starts []time.Time
+	index := make(map[string]int)
+	for b := bucketStart(start, interval); !b.After(end); b = nextBucket(b, interval) {
+		if len(starts) == maxTimeSeriesBuckets {
+			return nil, ErrInvalidStatsRange
+		}
+		index[b.Format("2006-01-02")] = len(starts)
+		starts = append(starts, b)
+	}
+
+	var rows []struct {
+		EntryDate time.Time
+		Mood      string
+		Entries   int64
+	}
+	if err := s.db.Model(&models.DailyEntryStats{}).
+		Where("user_id = ? AND entry_date BETWEEN ? AND ? AND mood <> ''", userID, start, end).
+		Select("entry_date, mood, SUM(entries) as entries").
+		Group("entry_date, mood").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	valences, err := moodValences(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	overall := newMoodTally()
+	buckets := make([]*moodTally, len(starts))
+	for i := range buckets {
+		buckets[i] = newMoodTally()
+	}
+	weekdays := make([]*moodTally, len(weekdayNames))
+	for i := range weekdays {
+		weekdays[i] = newMoodTally()
+	}
+	for _, row := range rows {
+		date := calendarDate(row.EntryDate)
+		overall.add(row.Mood, row.Entries)
+		weekdays[date.Weekday()].add(row.Mood, row.Entries)
+		if i, ok := index[bucketStart(date, interval).Format("2006-01-02")]; ok {
+			buckets[i].add(row.Mood, row.Entries)
+		}
+	}
+
+	stats := &models.MoodStatsDTO{
+		Interval: interval,
+		From:     start.Format("2006-01-02"),
+		To:       end.Format("2006-01-02"),
+		Entries:  overall.total,
+	}
+	for i, b := range starts {
+		summary := buckets[i].summary(valences)
+		summary.Start = b.Format("2006-01-02")
+		stats.Trend = append(stats.Trend, summary)
+	}
+	// Weekdays are listed Monday first, like weeks
+	for i := 1; i <= len(weekdayNames); i++ {
+		day := time.Weekday(i % len(weekdayNames))
+		summary := weekdays[day].summary(valences)
+		summary.Weekday = weekdayNames[day]
+		stats.Weekdays = append(stats.Weekdays, summary)
+	}
+
+	var categoryRows []moodGroupRow
+	if err := s.db.Model(&models.DailyEntryStats{}).
+		Joins("JOIN categories ON daily_entry_stats.category_id = categories.id AND categories.user_id = daily_entry_stats.user_id").
+		Where("daily_entry_stats.user_id = ?", userID).
+		Where("daily_entry_stats.entry_date BETWEEN ? AND ? AND daily_entry_stats.mood <> ''", start, end).
+		Select("categories.id, categories.name, daily_entry_stats.mood, SUM(daily_entry_stats.entries) as entries").
+		Group("categories.id, categories.name, daily_entry_stats.mood").
+		Scan(&categoryRows).Error; err != nil {
+		return nil, err
+	}
+	stats.Categories = moodCorrelations(categoryRows, overall)
+
+	// The daily aggregates are not split by tag, so tags come from the entries
+	var tagRows []moodGroupRow
+	if err := s.db.Model(&models.JournalEntry{}).
+		Scopes(publishedOnly).
+		Joins("JOIN journal_entry_tags ON journal_entry_tags.entry_id = journal_entries.id").
+		Joins("JOIN tags ON tags.id = journal_entry_tags.tag_id").
+		Where("journal_entries.user_id = ?", userID).
+		Where("journal_entries.entry_date BETWEEN ? AND ? AND journal_entries.mood <> ''", start, end).
+		Select("tags.id, tags.name, journal_entries.mood, COUNT(*) as entries").
+		Group("tags.id, tags.name, journal_entries.mood").
+		Scan(&tagRows).Error; err != nil {
+		return nil, err
+	}
+	stats.Tags = moodCorrelations(tagRows, overall)
+
+	return stats, nil
+}
+
+// moodGroupRow is the number of entries with a mood in one tag or category
+type moodGroupRow struct {
+	ID      uint
+	Name    string
+	Mood    string
+	Entries int64
+}
+
+// moodCorrelations compares the mood shares within each group against the
+// baseline shares, strongest lift first. Pairs where the mood is both seen
+// and expected fewer than twice are too thin to mean anything and are skipped.
+func moodCorrelations(rows []moodGroupRow, baseline *moodTally) []models.MoodCorrelationDTO {
+	correlations := []models.MoodCorrelationDTO{}
+	if baseline.total == 0 {
+		return correlations
+	}
+
+	groups := make(map[uint]*moodTally)
+	names := make(map[uint]string)
+	var order []uint
+	for _, row := range rows {
+		group, ok := groups[row.ID]
+		if !ok {
+			group = newMoodTally()
+			groups[row.ID] = group
+			names[row.ID] = row.Name
+			order = append(order, row.ID)
+		}
+		group.add(row.Mood, row.Entries)
+	}
+
+	for _, id := range order {
+		group := groups[id]
+		if group.total < minCorrelationEntries {
+			continue
+		}
+		for key, baseCount := range baseline.counts {
+			moodEntries := group.counts[key]
+			baselineShare := float64(baseCount) / float64(baseline.total)
+			if moodEntries < 2 && float64(group.total)*baselineShare < 2 {
+				continue
+			}
+			share := float64(moodEntries) / float64(group.total)
+			correlations = append(correlations, models.MoodCorrelationDTO{
+				ID:            id,
+				Name:          names[id],
+				Mood:          baseline.names[key],
+				Entries:       group.total,
+				MoodEntries:   moodEntries,
+				Share:         share,
+				BaselineShare: baselineShare,
+				Lift:          share/baselineShare - 1,
+			})
+		}
+	}
+
+	sort.Slice(correlations, func(a, b int) bool {
+		ca, cb := correlations[a], correlations[b]
+		if la, lb := math.Abs(ca.Lift), math.Abs(cb.Lift); la != lb {
+			return la > lb
+		}
+		if ca.Name != cb.Name {
+			return ca.Name < cb.Name
+		}
+		return ca.Mood < cb.Mood
+	})
+	if len(correlations) > maxMoodCorrelations {
+		correlations = correlations[:maxMoodCorrelations]
+	}
+	return correlations
+}
+
+// moodTally counts entries per mood, ignoring case and surrounding spaces and
+// keeping the first spelling seen for display. Rows without entries are not
+// counted, so every mood in a tally has a share above zero.
+type moodTally struct {
+	counts map[string]int64
+	names  map[string]string
+	total  int64
+}
+
+func newMoodTally() *moodTally {
+	return &moodTally{
+		counts: make(map[string]int64),
+		names:  make(map[string]string),
+	}
+}
+
+func (t *moodTally) add(mood string, entries int64) {
+	key := strings.ToLower(strings.TrimSpace(mood))
+	if key == "" || entries <= 0 {
+		return
+	}
+	if _, ok := t.names[key]; !ok {
+		t.names[key] = strings.TrimSpace(mood)
+	}
+	t.counts[key] += entries
+	t.total += entries
+}
+
+// summary reports the counts, most common mood and average score of the
+// tally. Moods without a valence are counted but not averaged.
+func (t *moodTally) summary(valences map[string]float64) models.MoodSummaryDTO {
+	summary := models.MoodSummaryDTO{
+		Entries: t.total,
+		Moods:   []models.MoodCountDTO{},
+	}
+
+	var scored, sum float64
+	for key, count := range t.counts {
+		summary.Moods = append(summary.Moods, models.MoodCountDTO{Mood: t.names[key], Count: count})
+		if score, ok := valences[key]; ok {
+			scored += float64(count)
+			sum += score * float64(count)
+		}
+	}
+	sortMoodCounts(summary.Moods)
+
+	if len(summary.Moods) > 0 {
+		summary.TopMood = summary.Moods[0].Mood
+	}
+	if scored > 0 {
+		average := sum / scored
+		summary.AverageScore = &average
+	}
+	return summary
+}
+
+// sortMoodCounts orders moods by count, most common first, then by name
+func sortMoodCounts(moods []models.MoodCountDTO) {
+	sort.Slice(moods, func(a, b int) bool {
+		if moods[a].Count != moods[b].Count {
+			return moods[a].Count > moods[b].Count
+		}
+		return moods[a].Mood < moods[b].Mood
+	})
+}
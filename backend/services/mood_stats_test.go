@@ -0,0 +1,201 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"journal/models"
+)
+
+// tally builds a moodTally from mood, entries pairs
+func tally(pairs ...interface{}) *moodTally {
+	t := newMoodTally()
+	for i := 0; i < len(pairs); i += 2 {
+		t.add(pairs[i].(string), int64(pairs[i+1].(int)))
+	}
+	return t
+}
+
+func TestMoodTally(t *testing.T) {
+	half, quarter := 0.5, 0.25
+
+	tests := []struct {
+		name  string
+		tally *moodTally
+		total int64
+		moods []models.MoodCountDTO
+		top   string
+		score *float64
+	}{
+		{
+			name:  "empty",
+			tally: tally(),
+			moods: []models.MoodCountDTO{},
+		},
+		{
+			name:  "blank moods and empty rows are ignored",
+			tally: tally("", 3, "  ", 2, "happy", 0),
+			moods: []models.MoodCountDTO{},
+		},
+		{
+			name:  "case and spaces merge, first spelling kept",
+			tally: tally(" Happy ", 2, "HAPPY", 1, "sad", 1),
+			total: 4,
+			moods: []models.MoodCountDTO{{Mood: "Happy", Count: 3}, {Mood: "sad", Count: 1}},
+			top:   "Happy",
+			// (3*1 + 1*-1) / 4
+			score: &half,
+		},
+		{
+			name:  "ties by name",
+			tally: tally("tired", 2, "calm", 2),
+			total: 4,
+			moods: []models.MoodCountDTO{{Mood: "calm", Count: 2}, {Mood: "tired", Count: 2}},
+			top:   "calm",
+			// tired has no valence, so only calm is averaged
+			score: &quarter,
+		},
+		{
+			name:  "no valences",
+			tally: tally("tired", 2, "bored", 1),
+			total: 3,
+			moods: []models.MoodCountDTO{{Mood: "tired", Count: 2}, {Mood: "bored", Count: 1}},
+			top:   "tired",
+		},
+	}
+
+	valences := map[string]float64{"happy": 1, "sad": -1, "calm": 0.25}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.tally.total != tt.total {
+				t.Errorf("total = %d, want %d", tt.tally.total, tt.total)
+			}
+			got := tt.tally.summary(valences)
+			if got.Entries != tt.total || got.TopMood != tt.top || !reflect.DeepEqual(got.Moods, tt.moods) {
+				t.Errorf("summary() = %d entries, top %q, moods %v; want %d, %q, %v",
+					got.Entries, got.TopMood, got.Moods, tt.total, tt.top, tt.moods)
+			}
+			if !sameFloat(got.AverageScore, tt.score) {
+				t.Errorf("summary().AverageScore = %v, want %v", got.AverageScore, tt.score)
+			}
+		})
+	}
+}
+
+func TestMoodCorrelations(t *testing.T) {
+	// 10 entries: Happy 60%, sad 30%, calm 10%
+	baseline := tally("Happy", 6, "sad", 3, "calm", 1)
+
+	type correlation struct {
+		name        string
+		mood        string
+		entries     int64
+		moodEntries int64
+		lift        float64
+	}
+	tests := []struct {
+		name     string
+		baseline *moodTally
+		rows     []moodGroupRow
+		want     []correlation
+	}{
+		{
+			name:     "no baseline",
+			baseline: tally(),
+			rows:     []moodGroupRow{{ID: 1, Name: "work", Mood: "sad", Entries: 5}},
+			want:     nil,
+		},
+		{
+			name:     "no rows",
+			baseline: baseline,
+			want:     nil,
+		},
+		{
+			name:     "lift against the baseline share",
+			baseline: baseline,
+			rows: []moodGroupRow{
+				{ID: 1, Name: "work", Mood: "happy", Entries: 1},
+				{ID: 1, Name: "work", Mood: "sad", Entries: 4},
+			},
+			// sad: 4/5 = 0.8 against 0.3; happy: 1/5 = 0.2 against 0.6;
+			// calm is neither seen nor expected (5 * 0.1) twice
+			want: []correlation{
+				{name: "work", mood: "sad", entries: 5, moodEntries: 4, lift: 0.8/0.3 - 1},
+				{name: "work", mood: "Happy", entries: 5, moodEntries: 1, lift: 0.2/0.6 - 1},
+			},
+		},
+		{
+			name:     "groups below the minimum are skipped",
+			baseline: baseline,
+			rows: []moodGroupRow{
+				{ID: 2, Name: "gym", Mood: "happy", Entries: 4},
+				{ID: 3, Name: "walks", Mood: "happy", Entries: 3},
+				{ID: 3, Name: "walks", Mood: "CALM", Entries: 2},
+			},
+			// gym has 4 entries, one short of minCorrelationEntries. In
+			// walks, sad is expected only 1.5 times and never seen.
+			want: []correlation{
+				{name: "walks", mood: "calm", entries: 5, moodEntries: 2, lift: 0.4/0.1 - 1},
+				{name: "walks", mood: "Happy", entries: 5, moodEntries: 3, lift: 0},
+			},
+		},
+		{
+			name:     "mood missing from the baseline",
+			baseline: baseline,
+			rows: []moodGroupRow{
+				{ID: 4, Name: "travel", Mood: "excited", Entries: 5},
+				{ID: 4, Name: "travel", Mood: "happy", Entries: 0},
+			},
+			// excited has no baseline share to divide by, and happy
+			// is expected 3 times but never seen
+			want: []correlation{
+				{name: "travel", mood: "Happy", entries: 5, moodEntries: 0, lift: -1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := moodCorrelations(tt.rows, tt.baseline)
+			if got == nil {
+				t.Fatal("moodCorrelations() = nil, want a list")
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("moodCorrelations() = %+v, want %d correlations", got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				c := got[i]
+				if c.Name != w.name || c.Mood != w.mood || c.Entries != w.entries || c.MoodEntries != w.moodEntries ||
+					math.IsNaN(c.Lift) || math.Abs(c.Lift-w.lift) > 1e-9 {
+					t.Errorf("correlation %d = %+v, want %+v", i, c, w)
+				}
+				if want := float64(c.MoodEntries) / float64(c.Entries); c.Share != want {
+					t.Errorf("correlation %d share = %v, want %v", i, c.Share, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMoodCorrelationsCapped(t *testing.T) {
+	baseline := tally("happy", 50, "sad", 50)
+	var rows []moodGroupRow
+	for id := uint(1); id <= maxMoodCorrelations; id++ {
+		name := fmt.Sprintf("tag%02d", id)
+		rows = append(rows,
+			moodGroupRow{ID: id, Name: name, Mood: "happy", Entries: int64(id)},
+			moodGroupRow{ID: id, Name: name, Mood: "sad", Entries: 5})
+	}
+
+	got := moodCorrelations(rows, baseline)
+	if len(got) != maxMoodCorrelations {
+		t.Fatalf("moodCorrelations() returned %d correlations, want %d", len(got), maxMoodCorrelations)
+	}
+	for i := 1; i < len(got); i++ {
+		if math.Abs(got[i].Lift) > math.Abs(got[i-1].Lift) {
+			t.Errorf("correlation %d lift %v is stronger than the one before, %v", i, got[i].Lift, got[i-1].Lift)
+		}
+	}
+}
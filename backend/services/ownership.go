@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"journal/models"
+	"journal/policy"
+
+	"gorm.io/gorm"
+)
+
+// ownedResources lists the models that can be referenced by ID from another
+// resource, keyed by the name used in error messages
+var ownedResources = map[string]interface{}{
+	"entry":    &models.JournalEntry{},
+	"category": &models.Category{},
+	"tag":      &models.Tag{},
+}
+
+// requireOwned checks that every id refers to a resource of the given kind
+// owned by userID, returning a not-found policy error for the first one that
+// is not. References are always resolved against the owner of the resource
+// being written, even when an admin is doing the writing.
+func requireOwned(db *gorm.DB, userID uint, resource string, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	model, ok := ownedResources[resource]
+	if !ok {
+		return fmt.Errorf("unknown resource %q", resource)
+	}
+
+	var owned []uint
+	if err := db.Model(model).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Pluck("id", &owned).Error; err != nil {
+		return err
+	}
+
+	found := make(map[uint]bool, len(owned))
+	for _, id := range owned {
+		found[id] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return policy.NotFound(resource, id)
+		}
+	}
+	return nil
+}
+
+// requireOwnedCategory is requireOwned for an optional category reference
+func requireOwnedCategory(db *gorm.DB, userID uint, categoryID *uint) error {
+	if categoryID == nil {
+		return nil
+	}
+	return requireOwned(db, userID, "category", *categoryID)
+}
+
+// requireAssignableCategory is requireOwnedCategory for the category given to
+// an entry whose category is currently current. Archived categories cannot be
+// assigned, but an entry may keep the one it already has.
+func requireAssignableCategory(db *gorm.DB, userID uint, categoryID, current *uint) error {
+	if categoryID == nil {
+		return nil
+	}
+
+	var category models.Category
+	if err := db.Select("id", "archived_at").
+		Where("user_id = ?", userID).
+		First(&category, *categoryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return policy.NotFound("category", *categoryID)
+		}
+		return err
+	}
+	if category.ArchivedAt != nil && (current == nil || *current != category.ID) {
+		return ErrCategoryArchived
+	}
+	return nil
+}
+
+// loadAuthorized loads the resource with the given ID into resource and lets
+// check decide whether the actor may use it
+func loadAuthorized(db *gorm.DB, actor policy.Actor, check policy.Check, resource policy.Resource, id uint) error {
+	if err := db.First(resource, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return policy.NotFound(resource.ResourceName(), id)
+		}
+		return err
+	}
+	return check(actor, resource)
+}
+
+// loadEntry loads an entry with its readers so shared access can be checked
+func loadEntry(db *gorm.DB, actor policy.Actor, check policy.Check, id uint, entry *models.JournalEntry) error {
+	return loadAuthorized(db.Preload("Shares"), actor, check, entry, id)
+}
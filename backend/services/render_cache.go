@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// renderCacheTTL keeps rendered entries around long enough to be reused
+// across a reading session without holding on to ones nobody opens
+const renderCacheTTL = 24 * time.Hour
+
+// rendererVersion is part of every key, so bumping it after changing the
+// renderer stops older output from being served
+const rendererVersion = 2
+
+// RenderCache caches the HTML rendered from each entry's Markdown. Writes to
+// an entry call Invalidate; a nil RenderCache, or one without a backing
+// Cache, caches nothing, and cache errors are logged rather than failing the
+// request.
+type RenderCache struct {
+	cache Cache
+}
+
+func NewRenderCache(cache Cache) *RenderCache {
+	return &RenderCache{cache: cache}
+}
+
+// cachedRender remembers which content it was rendered from, so HTML stored
+// by a read that raced an update is never served for the new content
+type cachedRender struct {
+	ContentHash string `json:"contentHash"`
+	HTML        string `json:"html"`
+}
+
+func renderKey(entryID uint) string {
+	return fmt.Sprintf("render:v%d:entry:%d", rendererVersion, entryID)
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the cached HTML for entryID if it was rendered from content
+func (c *RenderCache) get(entryID uint, content string) (string, bool) {
+	if c == nil || c.cache == nil {
+		return "", false
+	}
+
+	data, found, err := c.cache.Get(context.Background(), renderKey(entryID))
+	if err != nil {
+		log.Printf("render cache: get for entry %d: %v", entryID, err)
+		return "", false
+	}
+	if !found {
+		return "", false
+	}
+
+	var cached cachedRender
+	if json.Unmarshal(data, &cached) != nil || cached.ContentHash != contentHash(content) {
+		return "", false
+	}
+	return cached.HTML, true
+}
+
+// set stores the HTML rendered from content for entryID
+func (c *RenderCache) set(entryID uint, content, html string) {
+	if c == nil || c.cache == nil {
+		return
+	}
+
+	data, err := json.Marshal(cachedRender{ContentHash: contentHash(content), HTML: html})
+	if err != nil {
+		return
+	}
+	if err := c.cache.Set(context.Background(), renderKey(entryID), data, renderCacheTTL); err != nil {
+		log.Printf("render cache: set for entry %d: %v", entryID, err)
+	}
+}
+
+// Invalidate drops the cached HTML for entryID
+func (c *RenderCache) Invalidate(entryID uint) {
+	if c == nil || c.cache == nil {
+		return
+	}
+
+	if err := c.cache.Delete(context.Background(), renderKey(entryID)); err != nil {
+		log.Printf("render cache: invalidate for entry %d: %v", entryID, err)
+	}
+}
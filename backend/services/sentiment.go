@@ -0,0 +1,57 @@
+package services
+
+import (
+	"log"
+	"math"
+	"strings"
+
+	"journal/models"
+
+	"gorm.io/gorm"
+)
+
+// withSuggestedMood offers a mood for an entry that has none. Failing to find
+// one is not worth failing the request over, so errors are only logged.
+func (s *JournalService) withSuggestedMood(dto *models.JournalEntryDTO, userID uint) *models.JournalEntryDTO {
+	if dto.Mood != "" || dto.Sentiment == nil {
+		return dto
+	}
+
+	mood, err := suggestMood(s.db, userID, *dto.Sentiment)
+	if err != nil {
+		log.Printf("Failed to suggest a mood for entry %d: %v", dto.ID, err)
+		return dto
+	}
+	dto.SuggestedMood = mood
+	return dto
+}
+
+// suggestMood picks the user's mood whose valence is closest to score scaled
+// to the valence range, preferring the mood they use most among equally
+// close ones. It returns "" when the user has no moods.
+func suggestMood(db *gorm.DB, userID uint, score float64) (string, error) {
+	var moods []models.Mood
+	if err := db.Where("user_id = ?", userID).Order("name").Find(&moods).Error; err != nil {
+		return "", err
+	}
+	if len(moods) == 0 {
+		return "", nil
+	}
+
+	counts, err := moodUsage(db, userID)
+	if err != nil {
+		return "", err
+	}
+
+	target := score * maxMoodValence
+	best := moods[0]
+	for _, mood := range moods[1:] {
+		distance := math.Abs(float64(mood.Valence) - target)
+		bestDistance := math.Abs(float64(best.Valence) - target)
+		if distance < bestDistance ||
+			(distance == bestDistance && counts[strings.ToLower(mood.Name)] > counts[strings.ToLower(best.Name)]) {
+			best = mood
+		}
+	}
+	return best.Name, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"time"
+
+	"journal/models"
+
+	"gorm.io/gorm"
+)
+
+// inCategories restricts a journal_entries query to entries in any of categoryIDs
+func inCategories(categoryIDs []uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("journal_entries.category_id IN ?", categoryIDs)
+	}
+}
+
+// sliceStats summarizes userID's published entries matching scopes. The
+// monthly trend covers every month from the first to the last entry, with
+// empty months reported as zero.
+func sliceStats(db *gorm.DB, userID uint, scopes ...func(*gorm.DB) *gorm.DB) (*models.SliceStatsDTO, error) {
+	entries := func() *gorm.DB {
+		return db.Model(&models.JournalEntry{}).
+			Scopes(publishedOnly).
+			Scopes(scopes...).
+			Where("journal_entries.user_id = ?", userID)
+	}
+
+	var totals struct {
+		EntryCount int64
+		TotalWords int64
+		FirstDate  *time.Time
+		LastDate   *time.Time
+	}
+	if err := entries().
+		Select("COUNT(*) as entry_count, COALESCE(SUM(word_count), 0) as total_words, " +
+			"MIN(entry_date) as first_date, MAX(entry_date) as last_date").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	stats := &models.SliceStatsDTO{
+		EntryCount:       totals.EntryCount,
+		TotalWords:       totals.TotalWords,
+		MoodDistribution: []models.MoodCountDTO{},
+		MonthlyTrend:     []models.MonthlyTrendDTO{},
+	}
+	if totals.EntryCount == 0 {
+		return stats, nil
+	}
+
+	stats.AvgWordsPerEntry = float64(totals.TotalWords) / float64(totals.EntryCount)
+	if totals.FirstDate != nil {
+		first := totals.FirstDate.Format("2006-01-02")
+		stats.FirstEntryDate = &first
+	}
+	if totals.LastDate != nil {
+		last := totals.LastDate.Format("2006-01-02")
+		stats.LastEntryDate = &last
+	}
+
+	if err := entries().
+		Select("mood, COUNT(*) as count").
+		Group("mood").
+		Order("count DESC, mood").
+		Scan(&stats.MoodDistribution).Error; err != nil {
+		return nil, err
+	}
+
+	var months []models.MonthlyTrendDTO
+	if err := entries().
+		Select("DATE_FORMAT(entry_date, '%Y-%m') as month, COUNT(*) as entries, COALESCE(SUM(word_count), 0) as words").
+		Group("month").
+		Order("month").
+		Scan(&months).Error; err != nil {
+		return nil, err
+	}
+	if totals.FirstDate != nil && totals.LastDate != nil {
+		stats.MonthlyTrend = fillMonths(months, *totals.FirstDate, *totals.LastDate)
+	}
+
+	return stats, nil
+}
+
+// fillMonths returns one trend point per month from first to last, taking
+// counts from months where there are any
+func fillMonths(months []models.MonthlyTrendDTO, first, last time.Time) []models.MonthlyTrendDTO {
+	byMonth := make(map[string]models.MonthlyTrendDTO, len(months))
+	for _, m := range months {
+		byMonth[m.Month] = m
+	}
+
+	var trend []models.MonthlyTrendDTO
+	end := time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for month := time.Date(first.Year(), first.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(end); month = month.AddDate(0, 1, 0) {
+		key := month.Format("2006-01")
+		point, ok := byMonth[key]
+		if !ok {
+			point = models.MonthlyTrendDTO{Month: key}
+		}
+		trend = append(trend, point)
+	}
+	return trend
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Cache is a key/value store for computed results. *redis.Client implements it.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// statsCacheTTL bounds how stale cached stats can get through changes that
+// do not invalidate them, such as the day rolling over for streaks
+const statsCacheTTL = 10 * time.Minute
+
+// StatsCache caches each user's overall entry stats. Services that change
+// anything the stats depend on call Invalidate. A nil StatsCache, or one
+// without a backing Cache, caches nothing, and cache errors are logged
+// rather than failing the request.
+type StatsCache struct {
+	cache Cache
+}
+
+func NewStatsCache(cache Cache) *StatsCache {
+	return &StatsCache{cache: cache}
+}
+
+func statsKey(userID uint) string {
+	return fmt.Sprintf("stats:user:%d", userID)
+}
+
+// get decodes the cached stats for userID into dest, reporting whether there were any
+func (c *StatsCache) get(userID uint, dest interface{}) bool {
+	if c == nil || c.cache == nil {
+		return false
+	}
+
+	data, found, err := c.cache.Get(context.Background(), statsKey(userID))
+	if err != nil {
+		log.Printf("stats cache: get for user %d: %v", userID, err)
+		return false
+	}
+	if !found {
+		return false
+	}
+	return json.Unmarshal(data, dest) == nil
+}
+
+// set stores stats for userID
+func (c *StatsCache) set(userID uint, stats interface{}) {
+	if c == nil || c.cache == nil {
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return
+	}
+	if err := c.cache.Set(context.Background(), statsKey(userID), data, statsCacheTTL); err != nil {
+		log.Printf("stats cache: set for user %d: %v", userID, err)
+	}
+}
+
+// Invalidate drops the cached stats for userID
+func (c *StatsCache) Invalidate(userID uint) {
+	if c == nil || c.cache == nil {
+		return
+	}
+
+	if err := c.cache.Delete(context.Background(), statsKey(userID)); err != nil {
+		log.Printf("stats cache: invalidate for user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"journal/models"
+	"journal/policy"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTagNameTaken   = errors.New("tag name already in use")
+	ErrTagInUse       = errors.New("tag is still attached to entries")
+	ErrInvalidTagName = errors.New("invalid tag name")
+	ErrTagHasChildren = errors.New("tag has child tags")
+)
+
+// tagPathSeparator splits hierarchical tag names such as "project/alpha"
+const tagPathSeparator = "/"
+
+// joinLiveEntries joins a query on journal_entry_tags to the tagged entries
+// that count as uses of a tag: those neither deleted nor drafts
+const joinLiveEntries = "LEFT JOIN journal_entries ON journal_entries.id = journal_entry_tags.entry_id " +
+	"AND journal_entries.deleted_at IS NULL AND journal_entries.is_draft = FALSE"
+
+type TagService struct {
+	db    *gorm.DB
+	stats *StatsCache
+}
+
+func NewTagService(db *gorm.DB, stats *StatsCache) *TagService {
+	return &TagService{db: db, stats: stats}
+}
+
+// GetTags retrieves all tags for a user along with how many published
+// entries use each
+func (s *TagService) GetTags(userID uint) ([]models.TagUsageDTO, error) {
+	var tags []models.TagUsageDTO
+	if err := s.db.Model(&models.Tag{}).
+		Where("tags.user_id = ?", userID).
+		Joins("LEFT JOIN journal_entry_tags ON journal_entry_tags.tag_id = tags.id").
+		Joins(joinLiveEntries).
+		Select("tags.id, tags.name, tags.parent_id, COUNT(journal_entries.id) as entry_count").
+		Group("tags.id, tags.name, tags.parent_id").
+		Order("tags.name").
+		Scan(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// GetTagTree returns the user's tags nested under their parents. Each node's
+// TotalCount includes entries tagged with any of its descendants.
+func (s *TagService) GetTagTree(userID uint) ([]models.TagTreeDTO, error) {
+	tags, err := s.GetTags(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]models.TagUsageDTO)
+	var roots []models.TagUsageDTO
+	for _, tag := range tags {
+		if tag.ParentID == nil {
+			roots = append(roots, tag)
+		} else {
+			children[*tag.ParentID] = append(children[*tag.ParentID], tag)
+		}
+	}
+
+	var build func(tag models.TagUsageDTO) models.TagTreeDTO
+	build = func(tag models.TagUsageDTO) models.TagTreeDTO {
+		node := models.TagTreeDTO{
+			ID:         tag.ID,
+			Name:       tag.Name,
+			Label:      tag.Name[strings.LastIndex(tag.Name, tagPathSeparator)+1:],
+			EntryCount: tag.EntryCount,
+			TotalCount: tag.EntryCount,
+			Children:   []models.TagTreeDTO{},
+		}
+		for _, child := range children[tag.ID] {
+			childNode := build(child)
+			node.TotalCount += childNode.TotalCount
+			node.Children = append(node.Children, childNode)
+		}
+		return node
+	}
+
+	tree := make([]models.TagTreeDTO, 0, len(roots))
+	for _, root := range roots {
+		tree = append(tree, build(root))
+	}
+	return tree, nil
+}
+
+// GetTagStats summarizes the published entries carrying a tag, or when
+// includeSubtags is set, the tag or any of its descendants
+func (s *TagService) GetTagStats(tagID uint, actor policy.Actor, includeSubtags bool) (*models.TagStatsDTO, error) {
+	var tag models.Tag
+	if err := loadAuthorized(s.db, actor, policy.CanRead, &tag, tagID); err != nil {
+		return nil, err
+	}
+
+	tagIDs := []uint{tag.ID}
+	if includeSubtags {
+		var err error
+		if tagIDs, err = tagSubtreeIDs(s.db, tag.UserID, tag.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	stats, err := sliceStats(s.db, tag.UserID, taggedWith(tagIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TagStatsDTO{
+		Tag:             models.TagDTO{ID: tag.ID, Name: tag.Name},
+		IncludesSubtags: includeSubtags,
+		Stats:           *stats,
+	}, nil
+}
+
+// RenameTag changes a tag's name. If another tag already has the name (ignoring
+// case) the rename fails with ErrTagNameTaken, unless merge is set, in which
+// case this tag is folded into the existing one.
+func (s *TagService) RenameTag(tagID uint, actor policy.Actor, name string, merge bool) (*models.TagDTO, error) {
+	names := normalizeTagNames([]string{name})
+	if len(names) == 0 {
+		return nil, ErrInvalidTagName
+	}
+	name = names[0]
+
+	var result *models.TagDTO
+	var userID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		tag, err := findTag(tx, actor, tagID)
+		if err != nil {
+			return err
+		}
+		userID = tag.UserID
+
+		var existing models.Tag
+		err = tx.Where("user_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", userID, name, tagID).
+			First(&existing).Error
+		if err == nil {
+			if !merge {
+				return ErrTagNameTaken
+			}
+			nested, err := hasChildren(tx, tag.ID)
+			if err != nil {
+				return err
+			}
+			if nested {
+				return ErrTagHasChildren
+			}
+			if err := mergeTags(tx, []uint{tag.ID}, existing.ID); err != nil {
+				return err
+			}
+			result = &models.TagDTO{ID: existing.ID, Name: existing.Name}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// A tag cannot be moved underneath itself
+		if strings.HasPrefix(name, strings.ToLower(tag.Name)+tagPathSeparator) {
+			return ErrInvalidTagName
+		}
+
+		// Descendants move along with the tag, so their new paths must be free too
+		var clashes int64
+		if err := tx.Model(&models.Tag{}).
+			Where("user_id = ? AND LOWER(name) LIKE ? AND LOWER(name) NOT LIKE ?",
+				userID, likePrefix(name+tagPathSeparator), likePrefix(strings.ToLower(tag.Name)+tagPathSeparator)).
+			Count(&clashes).Error; err != nil {
+			return err
+		}
+		if clashes > 0 {
+			nested, err := hasChildren(tx, tag.ID)
+			if err != nil {
+				return err
+			}
+			if nested {
+				return ErrTagNameTaken
+			}
+		}
+
+		parentID, err := ensureParent(tx, userID, name)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Exec(
+			"UPDATE tags SET name = CONCAT(?, SUBSTRING(name, ?)) WHERE user_id = ? AND name LIKE ?",
+			name+tagPathSeparator, utf8.RuneCountInString(tag.Name)+2, userID, likePrefix(tag.Name+tagPathSeparator),
+		).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(tag).Updates(map[string]interface{}{"name": name, "parent_id": parentID}).Error; err != nil {
+			return err
+		}
+		result = &models.TagDTO{ID: tag.ID, Name: name}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.stats.Invalidate(userID)
+
+	return result, nil
+}
+
+// MergeTags moves every entry tagged with one of sourceIDs onto targetID and
+// removes the source tags
+func (s *TagService) MergeTags(actor policy.Actor, sourceIDs []uint, targetID uint) (*models.TagDTO, error) {
+	var target *models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		target, err = findTag(tx, actor, targetID)
+		if err != nil {
+			return err
+		}
+
+		var sources []uint
+		for _, id := range sourceIDs {
+			if id == targetID {
+				continue
+			}
+			// Sources must belong to the same user as the target
+			source, err := findTag(tx, actor, id)
+			if err != nil {
+				return err
+			}
+			if source.UserID != target.UserID {
+				return policy.NotFound("tag", id)
+			}
+			nested, err := hasChildren(tx, id)
+			if err != nil {
+				return err
+			}
+			if nested {
+				return ErrTagHasChildren
+			}
+			sources = append(sources, id)
+		}
+
+		return mergeTags(tx, sources, targetID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.stats.Invalidate(target.UserID)
+
+	return &models.TagDTO{ID: target.ID, Name: target.Name}, nil
+}
+
+// DeleteTag removes a tag. A tag that is still on published entries is only
+// deleted when detach is set; it is removed from all of its entries first.
+func (s *TagService) DeleteTag(tagID uint, actor policy.Actor, detach bool) error {
+	var userID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		tag, err := findTag(tx, actor, tagID)
+		if err != nil {
+			return err
+		}
+		userID = tag.UserID
+
+		nested, err := hasChildren(tx, tag.ID)
+		if err != nil {
+			return err
+		}
+		if nested {
+			return ErrTagHasChildren
+		}
+
+		var usage int64
+		if err := tx.Model(&models.JournalEntryTag{}).
+			Joins(joinLiveEntries).
+			Where("journal_entry_tags.tag_id = ? AND journal_entries.id IS NOT NULL", tag.ID).
+			Count(&usage).Error; err != nil {
+			return err
+		}
+		if usage > 0 && !detach {
+			return ErrTagInUse
+		}
+
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.JournalEntryTag{}).Error; err != nil {
+			return err
+		}
+
+		// Hard delete so the name can be reused under unique_tag_per_user
+		return tx.Unscoped().Delete(tag).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.stats.Invalidate(userID)
+	return nil
+}
+
+// findTag loads a tag the actor may change
+func findTag(tx *gorm.DB, actor policy.Actor, tagID uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := loadAuthorized(tx, actor, policy.CanWrite, &tag, tagID); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// mergeTags re-points journal_entry_tags rows from sourceIDs to targetID,
+// skipping entries that already carry the target, then deletes the sources
+func mergeTags(tx *gorm.DB, sourceIDs []uint, targetID uint) error {
+	if len(sourceIDs) == 0 {
+		return nil
+	}
+
+	if err := tx.Exec(
+		"INSERT IGNORE INTO journal_entry_tags (entry_id, tag_id) "+
+			"SELECT DISTINCT entry_id, ? FROM journal_entry_tags WHERE tag_id IN ?",
+		targetID, sourceIDs,
+	).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("tag_id IN ?", sourceIDs).Delete(&models.JournalEntryTag{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Where("id IN ?", sourceIDs).Delete(&models.Tag{}).Error
+}
+
+// normalizeTagNames trims and lower-cases tag names, dropping blanks and
+// duplicates while keeping the caller's order. Each segment of a hierarchical
+// name is trimmed and empty segments are removed, so " Project / alpha/" becomes
+// "project/alpha".
+func normalizeTagNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		var segments []string
+		for _, segment := range strings.Split(strings.ToLower(name), tagPathSeparator) {
+			if segment = strings.TrimSpace(segment); segment != "" {
+				segments = append(segments, segment)
+			}
+		}
+		name = strings.Join(segments, tagPathSeparator)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	return normalized
+}
+
+// resolveTags returns the user's tags for names, creating any that are missing
+// along with their ancestors. Creation is a single insert that ignores rows
+// another request created concurrently, so it never trips unique_tag_per_user.
+func resolveTags(tx *gorm.DB, userID uint, names []string) ([]models.Tag, error) {
+	names = normalizeTagNames(names)
+	if len(names) == 0 {
+		return []models.Tag{}, nil
+	}
+
+	// Include every ancestor path so the hierarchy is complete
+	var paths []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		segments := strings.Split(name, tagPathSeparator)
+		for i := range segments {
+			path := strings.Join(segments[:i+1], tagPathSeparator)
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	newTags := make([]models.Tag, 0, len(paths))
+	for _, path := range paths {
+		newTags = append(newTags, models.Tag{UserID: userID, Name: path})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Omit(clause.Associations).
+		Create(&newTags).Error; err != nil {
+		return nil, err
+	}
+
+	var existing []models.Tag
+	if err := tx.Where("user_id = ? AND LOWER(name) IN ?", userID, paths).
+		Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]models.Tag, len(existing))
+	for _, tag := range existing {
+		byName[strings.ToLower(tag.Name)] = tag
+	}
+
+	// Link freshly created tags to their parents
+	for _, tag := range existing {
+		parent, ok := byName[parentPath(strings.ToLower(tag.Name))]
+		if !ok || (tag.ParentID != nil && *tag.ParentID == parent.ID) {
+			continue
+		}
+		if err := tx.Model(&tag).Update("parent_id", parent.ID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		if tag, ok := byName[name]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// ensureParent makes sure the parent path of name exists and returns its ID,
+// or nil for top-level names
+func ensureParent(tx *gorm.DB, userID uint, name string) (*uint, error) {
+	parent := parentPath(name)
+	if parent == "" {
+		return nil, nil
+	}
+
+	tags, err := resolveTags(tx, userID, []string{parent})
+	if err != nil {
+		return nil, err
+	}
+	return &tags[0].ID, nil
+}
+
+// parentPath returns "project" for "project/alpha" and "" for top-level names
+func parentPath(name string) string {
+	if i := strings.LastIndex(name, tagPathSeparator); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// hasChildren reports whether any tag is nested directly under tagID
+func hasChildren(tx *gorm.DB, tagID uint) (bool, error) {
+	var count int64
+	if err := tx.Model(&models.Tag{}).Where("parent_id = ?", tagID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// tagSubtreeIDs returns tagID together with the IDs of all its descendants
+func tagSubtreeIDs(db *gorm.DB, userID, tagID uint) ([]uint, error) {
+	var tag models.Tag
+	if err := db.Where("id = ? AND user_id = ?", tagID, userID).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, policy.NotFound("tag", tagID)
+		}
+		return nil, err
+	}
+
+	ids := []uint{tag.ID}
+	var descendants []uint
+	if err := db.Model(&models.Tag{}).
+		Where("user_id = ? AND name LIKE ?", userID, likePrefix(tag.Name+tagPathSeparator)).
+		Pluck("id", &descendants).Error; err != nil {
+		return nil, err
+	}
+	return append(ids, descendants...), nil
+}
+
+// likePrefix builds a LIKE pattern matching strings that start with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+// setEntryTags makes tags the exact tag set of an entry
+func setEntryTags(tx *gorm.DB, entryID uint, tags []models.Tag) error {
+	if err := tx.Where("entry_id = ?", entryID).Delete(&models.JournalEntryTag{}).Error; err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	links := make([]models.JournalEntryTag, 0, len(tags))
+	for _, tag := range tags {
+		links = append(links, models.JournalEntryTag{EntryID: entryID, TagID: tag.ID})
+	}
+	return tx.Omit(clause.Associations).Create(&links).Error
+}
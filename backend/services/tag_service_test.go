@@ -0,0 +1,67 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTagNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{name: "nil", names: nil, want: []string{}},
+		{name: "trims and lower-cases", names: []string{"  Work ", "TRAVEL"}, want: []string{"work", "travel"}},
+		{name: "drops blanks", names: []string{"", "   ", "/", " / "}, want: []string{}},
+		{name: "drops duplicates keeping order", names: []string{"b", "a", "B", " a "}, want: []string{"b", "a"}},
+		{name: "hierarchical segments", names: []string{" Project / alpha/"}, want: []string{"project/alpha"}},
+		{name: "empty segments", names: []string{"a//b", "/a/b"}, want: []string{"a/b"}},
+		{name: "inner spaces kept", names: []string{"road trip"}, want: []string{"road trip"}},
+		{name: "unicode", names: []string{"Über", "ÜBER"}, want: []string{"über"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeTagNames(tt.names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTagNames(%q) = %q, want %q", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParentPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"work", ""},
+		{"project/alpha", "project"},
+		{"a/b/c", "a/b"},
+	}
+
+	for _, tt := range tests {
+		if got := parentPath(tt.name); got != tt.want {
+			t.Errorf("parentPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLikePrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"", "%"},
+		{"work/", "work/%"},
+		{"100%", `100\%%`},
+		{"snake_case", `snake\_case%`},
+		{`back\slash`, `back\\slash%`},
+	}
+
+	for _, tt := range tests {
+		if got := likePrefix(tt.prefix); got != tt.want {
+			t.Errorf("likePrefix(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"journal/models"
+	"journal/policy"
+)
+
+const (
+	// suggestionCorpusSize caps how many past entries are compared against
+	suggestionCorpusSize = 500
+	// similarEntryCount is how many of the most similar entries contribute tags
+	similarEntryCount  = 10
+	mentionWeight      = 1.0
+	coOccurrenceWeight = 0.5
+)
+
+// stopWords are ignored when comparing entry content
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true,
+	"you": true, "all": true, "any": true, "can": true, "had": true, "her": true,
+	"was": true, "one": true, "our": true, "out": true, "has": true, "him": true,
+	"his": true, "how": true, "its": true, "may": true, "new": true, "now": true,
+	"old": true, "see": true, "two": true, "who": true, "did": true, "get": true,
+	"got": true, "let": true, "say": true, "she": true, "too": true, "use": true,
+	"that": true, "with": true, "have": true, "this": true, "will": true, "your": true,
+	"from": true, "they": true, "been": true, "were": true, "said": true, "each": true,
+	"which": true, "their": true, "there": true, "what": true, "about": true, "would": true,
+	"these": true, "into": true, "than": true, "then": true, "them": true, "some": true,
+	"could": true, "when": true, "just": true, "very": true, "also": true, "more": true,
+	"today": true, "really": true, "because": true, "after": true, "before": true,
+}
+
+// SuggestTags autocompletes tag names starting with prefix, ranking tags used
+// on more entries first and breaking ties by how recently they were used
+func (s *TagService) SuggestTags(userID uint, prefix string, limit int) ([]models.TagUsageDTO, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+
+	var tags []models.TagUsageDTO
+	if err := s.db.Model(&models.Tag{}).
+		Where("tags.user_id = ? AND tags.name LIKE ?", userID, likePrefix(prefix)).
+		Joins("LEFT JOIN journal_entry_tags ON journal_entry_tags.tag_id = tags.id").
+		Joins(joinLiveEntries).
+		Select("tags.id, tags.name, COUNT(journal_entries.id) as entry_count, MAX(journal_entries.entry_date) as last_used_at").
+		Group("tags.id, tags.name").
+		Order("entry_count DESC, last_used_at DESC, tags.name").
+		Limit(limit).
+		Scan(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// SuggestTagsForEntry proposes existing tags that are not yet on the entry,
+// based on tags mentioned in its text, tags on past entries with similar
+// content, and tags that are often used together with the entry's current tags
+func (s *TagService) SuggestTagsForEntry(entryID uint, actor policy.Actor, limit int) ([]models.TagSuggestionDTO, error) {
+	var entry models.JournalEntry
+	if err := loadEntry(s.db.Preload("Tags"), actor, policy.CanWrite, entryID, &entry); err != nil {
+		return nil, err
+	}
+	userID := entry.UserID
+
+	var corpus []models.JournalEntry
+	if err := s.db.Preload("Tags").
+		Scopes(publishedOnly).
+		Where("user_id = ? AND id <> ?", userID, entryID).
+		Order("entry_date DESC").
+		Limit(suggestionCorpusSize).
+		Find(&corpus).Error; err != nil {
+		return nil, err
+	}
+
+	var userTags []models.Tag
+	if err := s.db.Where("user_id = ?", userID).Find(&userTags).Error; err != nil {
+		return nil, err
+	}
+
+	return suggestTags(entry, corpus, userTags, limit), nil
+}
+
+type tagScore struct {
+	tag     models.Tag
+	score   float64
+	reasons map[string]float64
+}
+
+func suggestTags(entry models.JournalEntry, corpus []models.JournalEntry, userTags []models.Tag, limit int) []models.TagSuggestionDTO {
+	current := make(map[uint]bool, len(entry.Tags))
+	for _, tag := range entry.Tags {
+		current[tag.ID] = true
+	}
+
+	scores := make(map[uint]*tagScore)
+	add := func(tag models.Tag, score float64, reason string) {
+		if current[tag.ID] || score <= 0 {
+			return
+		}
+		ts, ok := scores[tag.ID]
+		if !ok {
+			ts = &tagScore{tag: tag, reasons: map[string]float64{}}
+			scores[tag.ID] = ts
+		}
+		ts.score += score
+		ts.reasons[reason] += score
+	}
+
+	entryTokens := tokenize(entry.Title + " " + entry.Content)
+
+	// Tags whose words all appear in the entry
+	for _, tag := range userTags {
+		words := tokenize(tag.Name)
+		if len(words) == 0 {
+			continue
+		}
+		mentioned := true
+		for word := range words {
+			if entryTokens[word] == 0 {
+				mentioned = false
+				break
+			}
+		}
+		if mentioned {
+			add(tag, mentionWeight, "Mentioned in this entry")
+		}
+	}
+
+	// Tags on the most similar past entries, weighted by similarity
+	docs := make([]map[string]int, len(corpus))
+	for i, past := range corpus {
+		docs[i] = tokenize(past.Title + " " + past.Content)
+	}
+	idf := inverseDocumentFrequency(append(docs, entryTokens))
+	target := weigh(entryTokens, idf)
+
+	type similar struct {
+		index int
+		score float64
+	}
+	var ranked []similar
+	for i, doc := range docs {
+		if score := cosine(target, weigh(doc, idf)); score > 0 {
+			ranked = append(ranked, similar{index: i, score: score})
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	if len(ranked) > similarEntryCount {
+		ranked = ranked[:similarEntryCount]
+	}
+	for _, r := range ranked {
+		for _, tag := range corpus[r.index].Tags {
+			add(tag, r.score, "Used on similar entries")
+		}
+	}
+
+	// Tags that co-occur with the entry's current tags
+	if len(current) > 0 {
+		withCurrent := 0
+		coCounts := make(map[uint]int)
+		byID := make(map[uint]models.Tag)
+		for _, past := range corpus {
+			hasCurrent := false
+			for _, tag := range past.Tags {
+				if current[tag.ID] {
+					hasCurrent = true
+					break
+				}
+			}
+			if !hasCurrent {
+				continue
+			}
+			withCurrent++
+			for _, tag := range past.Tags {
+				coCounts[tag.ID]++
+				byID[tag.ID] = tag
+			}
+		}
+		for id, count := range coCounts {
+			add(byID[id], coOccurrenceWeight*float64(count)/float64(withCurrent), "Often used with this entry's tags")
+		}
+	}
+
+	results := make([]*tagScore, 0, len(scores))
+	for _, ts := range scores {
+		results = append(results, ts)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].tag.Name < results[j].tag.Name
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	suggestions := make([]models.TagSuggestionDTO, 0, len(results))
+	for _, ts := range results {
+		suggestions = append(suggestions, models.TagSuggestionDTO{
+			ID:     ts.tag.ID,
+			Name:   ts.tag.Name,
+			Score:  math.Round(ts.score*1000) / 1000,
+			Reason: strongestReason(ts.reasons),
+		})
+	}
+	return suggestions
+}
+
+// tokenize lower-cases text and counts its words, ignoring short words and stop words
+func tokenize(text string) map[string]int {
+	tokens := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len([]rune(word)) < 3 || stopWords[word] {
+			continue
+		}
+		tokens[word]++
+	}
+	return tokens
+}
+
+func inverseDocumentFrequency(docs []map[string]int) map[string]float64 {
+	df := make(map[string]int)
+	for _, doc := range docs {
+		for word := range doc {
+			df[word]++
+		}
+	}
+
+	idf := make(map[string]float64, len(df))
+	for word, count := range df {
+		idf[word] = math.Log(float64(len(docs)+1) / float64(count+1))
+	}
+	return idf
+}
+
+func weigh(tokens map[string]int, idf map[string]float64) map[string]float64 {
+	vector := make(map[string]float64, len(tokens))
+	for word, count := range tokens {
+		vector[word] = float64(count) * idf[word]
+	}
+	return vector
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for word, weight := range a {
+		dot += weight * b[word]
+		normA += weight * weight
+	}
+	for _, weight := range b {
+		normB += weight * weight
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func strongestReason(reasons map[string]float64) string {
+	best, bestScore := "", -1.0
+	for reason, score := range reasons {
+		if score > bestScore || (score == bestScore && reason < best) {
+			best, bestScore = reason, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+	"journal/models"
+)
+
+func testTag(id uint, name string) models.Tag {
+	return models.Tag{Model: gorm.Model{ID: id}, Name: name}
+}
+
+func pastEntry(content string, tags ...models.Tag) models.JournalEntry {
+	return models.JournalEntry{Content: content, Tags: tags}
+}
+
+func TestSuggestTags(t *testing.T) {
+	outdoors := testTag(1, "outdoors")
+	finance := testTag(2, "finance")
+	friends := testTag(3, "friends")
+	work := testTag(4, "work")
+	meetings := testTag(5, "meetings")
+	travel := testTag(6, "travel")
+	userTags := []models.Tag{outdoors, finance, friends, work, meetings, travel}
+
+	hike := models.JournalEntry{Title: "Saturday", Content: "A long mountain trail hike with friends."}
+	history := []models.JournalEntry{
+		pastEntry("Mountain trail hike at dawn", outdoors),
+		pastEntry("Quarterly invoices and taxes", finance),
+	}
+
+	tests := []struct {
+		name    string
+		entry   models.JournalEntry
+		corpus  []models.JournalEntry
+		tags    []models.Tag
+		limit   int
+		want    []string
+		reasons []string
+	}{
+		{
+			name:  "no tags and no history",
+			entry: hike,
+			limit: 5,
+			want:  []string{},
+		},
+		{
+			name:    "empty history still finds mentions",
+			entry:   hike,
+			tags:    userTags,
+			limit:   5,
+			want:    []string{"friends"},
+			reasons: []string{"Mentioned in this entry"},
+		},
+		{
+			name:    "mentions rank above similar entries",
+			entry:   hike,
+			corpus:  history,
+			tags:    userTags,
+			limit:   5,
+			want:    []string{"friends", "outdoors"},
+			reasons: []string{"Mentioned in this entry", "Used on similar entries"},
+		},
+		{
+			name:    "limit keeps the best",
+			entry:   hike,
+			corpus:  history,
+			tags:    userTags,
+			limit:   1,
+			want:    []string{"friends"},
+			reasons: []string{"Mentioned in this entry"},
+		},
+		{
+			name: "attached tags are left out",
+			entry: models.JournalEntry{
+				Content: "A long mountain trail hike with friends.",
+				Tags:    []models.Tag{friends, outdoors},
+			},
+			corpus: history,
+			tags:   userTags,
+			limit:  5,
+			want:   []string{},
+		},
+		{
+			name:    "equal scores by name",
+			entry:   models.JournalEntry{Content: "Work trip: travel day"},
+			tags:    userTags,
+			limit:   5,
+			want:    []string{"travel", "work"},
+			reasons: []string{"Mentioned in this entry", "Mentioned in this entry"},
+		},
+		{
+			name:  "often used together",
+			entry: models.JournalEntry{Content: "ok", Tags: []models.Tag{work}},
+			corpus: []models.JournalEntry{
+				pastEntry("ok", work, meetings),
+				pastEntry("ok", work, meetings),
+				pastEntry("ok", work, travel),
+				pastEntry("ok", travel, finance),
+			},
+			tags:    userTags,
+			limit:   5,
+			want:    []string{"meetings", "travel"},
+			reasons: []string{"Often used with this entry's tags", "Often used with this entry's tags"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := suggestTags(tt.entry, tt.corpus, tt.tags, tt.limit)
+			names := []string{}
+			var reasons []string
+			for _, s := range got {
+				names = append(names, s.Name)
+				reasons = append(reasons, s.Reason)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Fatalf("suggestTags() = %q, want %q", names, tt.want)
+			}
+			if !reflect.DeepEqual(reasons, tt.reasons) {
+				t.Errorf("suggestTags() reasons = %q, want %q", reasons, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestSuggestTagsScores(t *testing.T) {
+	work := testTag(1, "work")
+	meetings := testTag(2, "meetings")
+	travel := testTag(3, "travel")
+	hiking := testTag(4, "hiking")
+
+	entry := models.JournalEntry{Content: "Hiking after work", Tags: []models.Tag{work}}
+	corpus := []models.JournalEntry{
+		pastEntry("ok", work, meetings),
+		pastEntry("ok", work, meetings),
+		pastEntry("ok", work, travel),
+	}
+
+	got := suggestTags(entry, corpus, []models.Tag{work, meetings, travel, hiking}, 5)
+	// A mention is worth 1; meetings is on 2 and travel on 1 of the 3 past
+	// entries with work, at half weight
+	want := []models.TagSuggestionDTO{
+		{ID: 4, Name: "hiking", Score: 1, Reason: "Mentioned in this entry"},
+		{ID: 2, Name: "meetings", Score: 0.333, Reason: "Often used with this entry's tags"},
+		{ID: 3, Name: "travel", Score: 0.167, Reason: "Often used with this entry's tags"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("suggestTags() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"journal/models"
+)
+
+var (
+	ErrInvalidInterval   = errors.New("invalid stats interval")
+	ErrInvalidStatsRange = errors.New("invalid stats date range")
+)
+
+// maxTimeSeriesBuckets keeps a single request from covering decades of days
+const maxTimeSeriesBuckets = 1000
+
+// defaultTimeSeriesSpan is how far back a series goes when no from date is given
+var defaultTimeSeriesSpan = map[string]func(to time.Time) time.Time{
+	"day":   func(to time.Time) time.Time { return to.AddDate(0, 0, -29) },
+	"week":  func(to time.Time) time.Time { return to.AddDate(0, 0, -7*11) },
+	"month": func(to time.Time) time.Time { return to.AddDate(0, -11, 0) },
+}
+
+// GetEntryTimeSeries buckets the user's published entries by day, week
+// (starting Monday) or month of their entry date. to defaults to today in
+// the user's timezone; from defaults to a span that suits the interval.
+// Every bucket in the range is returned, including empty ones.
+func (s *JournalService) GetEntryTimeSeries(userID uint, interval string, from, to *time.Time) (*models.TimeSeriesDTO, error) {
+	start, end, err := s.statsRange(userID, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lay out the empty buckets first so gaps show up as zeros
+	var buckets []models.TimeSeriesBucketDTO
+	index := make(map[string]int)
+	for b := bucketStart(start, interval); !b.After(end); b = nextBucket(b, interval) {
+		if len(buckets) == maxTimeSeriesBuckets {
+			return nil, ErrInvalidStatsRange
+		}
+		key := b.Format("2006-01-02")
+		index[key] = len(buckets)
+		buckets = append(buckets, models.TimeSeriesBucketDTO{
+			Start:      key,
+			Moods:      []models.MoodCountDTO{},
+			Categories: []models.CategoryCountDTO{},
+		})
+	}
+
+	var rows []struct {
+		EntryDate        time.Time
+		Mood             string
+		CategoryID       *uint
+		Category         string
+		Entries          int64
+		Words            int64
+		SentimentSum     float64
+		SentimentEntries int64
+	}
+	if err := s.db.Model(&models.DailyEntryStats{}).
+		Where("daily_entry_stats.user_id = ?", userID).
+		Where("daily_entry_stats.entry_date BETWEEN ? AND ?", start, end).
+		Joins("LEFT JOIN categories ON daily_entry_stats.category_id = categories.id AND categories.user_id = daily_entry_stats.user_id").
+		Select("daily_entry_stats.entry_date, daily_entry_stats.mood, categories.id as category_id, " +
+			"COALESCE(categories.name, 'Uncategorized') as category, " +
+			"SUM(daily_entry_stats.entries) as entries, SUM(daily_entry_stats.words) as words, " +
+			"SUM(daily_entry_stats.sentiment_sum) as sentiment_sum, SUM(daily_entry_stats.sentiment_entries) as sentiment_entries").
+		Group("daily_entry_stats.entry_date, daily_entry_stats.mood, categories.id, categories.name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	moods := make([]map[string]int64, len(buckets))
+	sentimentSums := make([]float64, len(buckets))
+	sentimentEntries := make([]int64, len(buckets))
+	categories := make([]map[string]*models.CategoryCountDTO, len(buckets))
+	for _, row := range rows {
+		i, ok := index[bucketStart(calendarDate(row.EntryDate), interval).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+
+		buckets[i].Entries += row.Entries
+		buckets[i].Words += row.Words
+		sentimentSums[i] += row.SentimentSum
+		sentimentEntries[i] += row.SentimentEntries
+
+		if moods[i] == nil {
+			moods[i] = make(map[string]int64)
+			categories[i] = make(map[string]*models.CategoryCountDTO)
+		}
+		moods[i][row.Mood] += row.Entries
+
+		count, ok := categories[i][row.Category]
+		if !ok {
+			count = &models.CategoryCountDTO{CategoryID: row.CategoryID, Name: row.Category}
+			categories[i][row.Category] = count
+		}
+		count.Count += row.Entries
+	}
+
+	for i := range buckets {
+		if sentimentEntries[i] > 0 {
+			average := sentimentSums[i] / float64(sentimentEntries[i])
+			buckets[i].AverageSentiment = &average
+		}
+
+		for mood, count := range moods[i] {
+			buckets[i].Moods = append(buckets[i].Moods, models.MoodCountDTO{Mood: mood, Count: count})
+		}
+		sortMoodCounts(buckets[i].Moods)
+
+		for _, count := range categories[i] {
+			buckets[i].Categories = append(buckets[i].Categories, *count)
+		}
+		sort.Slice(buckets[i].Categories, func(a, b int) bool {
+			ca, cb := buckets[i].Categories[a], buckets[i].Categories[b]
+			if ca.Count != cb.Count {
+				return ca.Count > cb.Count
+			}
+			return ca.Name < cb.Name
+		})
+	}
+
+	return &models.TimeSeriesDTO{
+		Interval: interval,
+		From:     start.Format("2006-01-02"),
+		To:       end.Format("2006-01-02"),
+		Buckets:  buckets,
+	}, nil
+}
+
+// statsRange resolves the inclusive date range of a bucketed stats request.
+// to defaults to today in the user's timezone and from to a span that suits
+// the interval.
+func (s *JournalService) statsRange(userID uint, interval string, from, to *time.Time) (start, end time.Time, err error) {
+	span, ok := defaultTimeSeriesSpan[interval]
+	if !ok {
+		return start, end, ErrInvalidInterval
+	}
+
+	end = calendarDate(time.Now().In(userLocation(s.db, userID)))
+	if to != nil {
+		end = calendarDate(*to)
+	}
+	start = span(end)
+	if from != nil {
+		start = calendarDate(*from)
+	}
+	if start.After(end) {
+		return start, end, ErrInvalidStatsRange
+	}
+	return start, end, nil
+}
+
+// bucketStart returns the first day of the bucket containing date
+func bucketStart(date time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		// time.Weekday counts from Sunday; weeks here start on Monday
+		offset := (int(date.Weekday()) + 6) % 7
+		return date.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
+
+// nextBucket returns the first day of the bucket after the one starting at start
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
@@ -2,19 +2,31 @@ package services
 
 import (
 	"errors"
+	"time"
 
 	"journal/models"
+	"journal/pkg/blobstore"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// ErrInvalidTimezone is returned when a preference names an unknown IANA zone
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+// ErrIncorrectPassword is returned when a password confirming an action is wrong
+var ErrIncorrectPassword = errors.New("incorrect password")
+
+// defaultTimezone is used for users who have not picked a timezone
+const defaultTimezone = "UTC"
+
 type UserService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	blobs blobstore.BlobStore
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, blobs blobstore.BlobStore) *UserService {
+	return &UserService{db: db, blobs: blobs}
 }
 
 func (s *UserService) CreateUser(email, password, firstName, lastName string) (*models.UserDTO, error) {
@@ -38,15 +50,30 @@ func (s *UserService) CreateUser(email, password, firstName, lastName string) (*
 		LastName:     lastName,
 	}
 
-	if err := s.db.Create(&user).Error; err != nil {
-		return nil, err
-	}
+	// The user, their preferences and their moods are created together, so a
+	// failure never leaves an account without them. Entries shared with the
+	// email before it had an account are shared with the new user.
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
 
-	// Create default preferences
-	preferences := models.UserPreferences{
-		UserID: user.ID,
-	}
-	if err := s.db.Create(&preferences).Error; err != nil {
+		// Create default preferences
+		preferences := models.UserPreferences{
+			UserID: user.ID,
+		}
+		if err := tx.Create(&preferences).Error; err != nil {
+			return err
+		}
+
+		// Start with the default mood vocabulary
+		if err := createDefaultMoods(tx, user.ID); err != nil {
+			return err
+		}
+
+		return acceptEntryInvites(tx, user.ID, email)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -112,7 +139,67 @@ func (s *UserService) UpdateUser(id uint, firstName, lastName string) (*models.U
 	}, nil
 }
 
-func (s *UserService) UpdateUserPreferences(userID uint, prefsData models.UserPreferences) (*models.UserPreferences, error) {
+// DeleteUser deletes an account and everything in it once the password has
+// been confirmed. Rows owned by the user go with it through the database's
+// cascading foreign keys; attachment files are deleted afterwards.
+func (s *UserService) DeleteUser(userID uint, password string) error {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrIncorrectPassword
+	}
+
+	var attachmentKeys []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Attachment{}).
+			Unscoped().
+			Where("user_id = ?", user.ID).
+			Pluck("storage_key", &attachmentKeys).Error; err != nil {
+			return err
+		}
+
+		// Tags reference their parent without cascading, so unlink them
+		// first or deleting a parent before its children would fail
+		if err := tx.Model(&models.Tag{}).
+			Unscoped().
+			Where("user_id = ? AND parent_id IS NOT NULL", user.ID).
+			Update("parent_id", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&user).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	deleteBlobs(s.blobs, attachmentKeys)
+	return nil
+}
+
+// PreferencesInput is an update to a user's preferences. Timezone and
+// HideLocation are left alone when nil, since clients that predate them send
+// only the other fields.
+type PreferencesInput struct {
+	Theme              string
+	DefaultView        string
+	DateFormat         string
+	EmailNotifications bool
+	Timezone           *string
+	HideLocation       *bool
+}
+
+// UpdateUserPreferences saves a user's preferences, creating them with the
+// default timezone when they do not exist yet
+func (s *UserService) UpdateUserPreferences(userID uint, input PreferencesInput) (*models.UserPreferences, error) {
+	if input.Timezone != nil && *input.Timezone != "" {
+		if _, err := time.LoadLocation(*input.Timezone); err != nil {
+			return nil, ErrInvalidTimezone
+		}
+	}
+
 	// Get existing preferences
 	var prefs models.UserPreferences
 	result := s.db.Where("user_id = ?", userID).First(&prefs)
@@ -120,13 +207,8 @@ func (s *UserService) UpdateUserPreferences(userID uint, prefsData models.UserPr
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			// Create preferences if not found
-			prefs = models.UserPreferences{
-				UserID:             userID,
-				Theme:              prefsData.Theme,
-				DefaultView:        prefsData.DefaultView,
-				DateFormat:         prefsData.DateFormat,
-				EmailNotifications: prefsData.EmailNotifications,
-			}
+			prefs = models.UserPreferences{UserID: userID, Timezone: defaultTimezone}
+			input.applyTo(&prefs)
 			if err := s.db.Create(&prefs).Error; err != nil {
 				return nil, err
 			}
@@ -135,11 +217,7 @@ func (s *UserService) UpdateUserPreferences(userID uint, prefsData models.UserPr
 		}
 	} else {
 		// Update existing preferences
-		prefs.Theme = prefsData.Theme
-		prefs.DefaultView = prefsData.DefaultView
-		prefs.DateFormat = prefsData.DateFormat
-		prefs.EmailNotifications = prefsData.EmailNotifications
-
+		input.applyTo(&prefs)
 		if err := s.db.Save(&prefs).Error; err != nil {
 			return nil, err
 		}
@@ -148,6 +226,21 @@ func (s *UserService) UpdateUserPreferences(userID uint, prefsData models.UserPr
 	return &prefs, nil
 }
 
+// applyTo copies the input onto prefs. An empty timezone keeps the one
+// prefs already has.
+func (input PreferencesInput) applyTo(prefs *models.UserPreferences) {
+	prefs.Theme = input.Theme
+	prefs.DefaultView = input.DefaultView
+	prefs.DateFormat = input.DateFormat
+	prefs.EmailNotifications = input.EmailNotifications
+	if input.Timezone != nil && *input.Timezone != "" {
+		prefs.Timezone = *input.Timezone
+	}
+	if input.HideLocation != nil {
+		prefs.HideLocation = *input.HideLocation
+	}
+}
+
 func (s *UserService) GetUserPreferences(userID uint) (*models.UserPreferences, error) {
 	var prefs models.UserPreferences
 	if err := s.db.Where("user_id = ?", userID).First(&prefs).Error; err != nil {
@@ -159,6 +252,7 @@ func (s *UserService) GetUserPreferences(userID uint) (*models.UserPreferences,
 				DefaultView:        "list",
 				DateFormat:         "MM/DD/YYYY",
 				EmailNotifications: false,
+				Timezone:           defaultTimezone,
 			}
 			if err := s.db.Create(&prefs).Error; err != nil {
 				return nil, err
@@ -169,3 +263,23 @@ func (s *UserService) GetUserPreferences(userID uint) (*models.UserPreferences,
 	}
 	return &prefs, nil
 }
+
+// userLocation returns the timezone the user has chosen for day boundaries,
+// falling back to UTC when there is no valid preference
+func userLocation(db *gorm.DB, userID uint) *time.Location {
+	var zone string
+	db.Model(&models.UserPreferences{}).
+		Where("user_id = ?", userID).
+		Select("timezone").
+		Scan(&zone)
+
+	if zone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}